@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -10,10 +11,22 @@ import (
 	"time"
 
 	"github.com/nekogravitycat/linkhub/internal/api"
+	"github.com/nekogravitycat/linkhub/internal/blocklist"
+	"github.com/nekogravitycat/linkhub/internal/botdetect"
+	"github.com/nekogravitycat/linkhub/internal/clicks"
 	"github.com/nekogravitycat/linkhub/internal/config"
 	"github.com/nekogravitycat/linkhub/internal/database"
+	"github.com/nekogravitycat/linkhub/internal/domains"
+	domainsHttp "github.com/nekogravitycat/linkhub/internal/domains/http"
+	"github.com/nekogravitycat/linkhub/internal/fallback"
+	"github.com/nekogravitycat/linkhub/internal/geoip"
 	"github.com/nekogravitycat/linkhub/internal/links"
 	linksHttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/qrcode"
+	"github.com/nekogravitycat/linkhub/internal/ratelimit"
+	"github.com/nekogravitycat/linkhub/internal/slugs"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+	"github.com/nekogravitycat/linkhub/internal/wellknown"
 )
 
 const SERVER_SHUTDOWN_TIMEOUT = 5 * time.Second
@@ -36,13 +49,202 @@ func main() {
 	}
 	defer pool.Close()
 
+	// Start Click Recorder
+	clickRecorder := clicks.NewRecorder(clicks.NewRepository(pool), clicks.RecorderOptions{
+		BufferSize:    cfg.ClickBufferSize,
+		BatchSize:     cfg.ClickBatchSize,
+		FlushInterval: cfg.ClickFlushInterval,
+	})
+	expvar.Publish("clicks", expvar.Func(func() any { return clickRecorder.Stats() }))
+
+	// Files reloaded on SIGHUP
+	var reloaders []reloader
+
+	// Open GeoIP Database
+	var geoResolver geoip.Resolver
+	if cfg.GeoIPDatabase != "" {
+		geoDB, err := geoip.Open(cfg.GeoIPDatabase)
+		if err != nil {
+			log.Fatalf("Failed to open GeoIP database: %v", err)
+		}
+		defer geoDB.Close()
+		geoResolver = geoDB
+
+		// e.g. after geoipupdate replaced the file
+		reloaders = append(reloaders, reloader{"GeoIP database", geoDB.Reload})
+	} else {
+		log.Println("GEOIP_DATABASE is not set; country rules are ignored")
+	}
+
+	// Load Bot Patterns
+	bots := botdetect.Default()
+	if cfg.BotPatternsFile != "" {
+		bots, err = botdetect.Open(cfg.BotPatternsFile)
+		if err != nil {
+			log.Fatalf("Failed to load bot patterns: %v", err)
+		}
+		reloaders = append(reloaders, reloader{"Bot patterns", bots.Reload})
+	}
+
+	fallbackPages, err := fallback.New(fallback.Options{
+		Dir: cfg.FallbackTemplatesDir,
+		URLs: map[fallback.Kind]string{
+			fallback.NotFound: cfg.FallbackNotFoundURL,
+			fallback.Inactive: cfg.FallbackInactiveURL,
+			fallback.Expired:  cfg.FallbackExpiredURL,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to load fallback templates: %v", err)
+	}
+	if cfg.FallbackTemplatesDir != "" {
+		reloaders = append(reloaders, reloader{"Fallback templates", fallbackPages.Reload})
+	}
+
+	wellKnownFiles, err := wellknown.Open(map[string]string{
+		wellknown.AppleAppSiteAssociation: cfg.AppleAppSiteAssociationFile,
+		wellknown.AssetLinks:              cfg.AssetLinksFile,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load app association files: %v", err)
+	}
+	if cfg.AppleAppSiteAssociationFile != "" || cfg.AssetLinksFile != "" {
+		reloaders = append(reloaders, reloader{"App association files", wellKnownFiles.Reload})
+	}
+
+	// Load Blocklists
+	var blockedHosts *blocklist.List
+	if len(cfg.BlocklistFiles) > 0 {
+		blockedHosts, err = blocklist.Open(cfg.BlocklistFiles)
+		if err != nil {
+			log.Fatalf("Failed to load blocklist: %v", err)
+		}
+		log.Printf("Blocklist loaded (%d entries)", blockedHosts.Stats().Blocked)
+		expvar.Publish("blocklist", expvar.Func(func() any { return blockedHosts.Stats() }))
+
+		reloaders = append(reloaders, reloader{"Blocklist", blockedHosts.Reload})
+		if cfg.BlocklistWatchInterval > 0 {
+			go blockedHosts.Watch(ctx, cfg.BlocklistWatchInterval)
+		}
+	}
+
+	go reloadOnHangup(ctx, reloaders)
+
+	// Load QR Code Logo
+	var qrLogo *qrcode.Logo
+	if cfg.QRLogo != "" {
+		qrLogo, err = qrcode.LoadLogo(cfg.QRLogo)
+		if err != nil {
+			log.Fatalf("Failed to load QR code logo: %v", err)
+		}
+	}
+
 	// Initialize Layers
+	domainService := domains.NewService(domains.NewRepository(pool), cfg.RedirectDomain)
+	if err := domainService.Reload(ctx); err != nil {
+		log.Fatalf("Failed to load domains: %v", err)
+	}
+	// Domains changed by other instances are reloaded when announced
+	domainListener := &database.Listener{
+		DSN:       cfg.DatabaseDSN,
+		Channel:   domains.NotifyChannel,
+		OnNotify:  func(string) { reloadDomains(ctx, domainService) },
+		OnConnect: func() { reloadDomains(ctx, domainService) },
+	}
+	go domainListener.Run(ctx)
+
 	linkRepo := links.NewRepository(pool)
-	linkService := links.NewService(linkRepo, cfg.RedirectDomain)
-	linkHandler := linksHttp.NewHandler(linkService)
+	var linkCache *links.ResolveCache
+	if cfg.RedirectCacheSize > 0 {
+		linkCache = links.NewResolveCache(links.CacheOptions{
+			Size:        cfg.RedirectCacheSize,
+			TTL:         cfg.RedirectCacheTTL,
+			NegativeTTL: cfg.RedirectCacheNegativeTTL,
+		})
+		expvar.Publish("redirect_cache", expvar.Func(func() any { return linkCache.Stats() }))
+
+		// The cache is only used while invalidations are being received
+		listener := &database.Listener{
+			DSN:          cfg.DatabaseDSN,
+			Channel:      links.NotifyChannel,
+			OnNotify:     linkCache.Invalidate,
+			OnConnect:    func() { linkCache.SetActive(true) },
+			OnDisconnect: func() { linkCache.SetActive(false) },
+		}
+		go listener.Run(ctx)
+	}
+	// Rate Limit Redirects
+	var rateLimiter *ratelimit.Limiter
+	if cfg.RateLimitStore != "off" {
+		var store ratelimit.Store
+		if cfg.RateLimitStore == "postgres" {
+			store = ratelimit.NewPostgresStore(pool)
+			go ratelimit.SweepPostgres(ctx, pool)
+		} else {
+			store = ratelimit.NewMemoryStore()
+		}
+		rateLimiter = ratelimit.New(store, ratelimit.Options{
+			Requests: ratelimit.PerMinute(cfg.RateLimitPerMinute, cfg.RateLimitBurst),
+			NotFound: ratelimit.PerMinute(cfg.RateLimitNotFoundPerMinute, cfg.RateLimitNotFoundBurst),
+		})
+		expvar.Publish("rate_limit", expvar.Func(func() any { return rateLimiter.Stats() }))
+	}
+
+	urlPolicy, err := urlpolicy.New(urlpolicy.Options{
+		Schemes:      cfg.URLSchemes,
+		AllowPrivate: cfg.URLAllowPrivate,
+		AllowHosts:   cfg.URLAllowHosts,
+		DenyHosts:    cfg.URLDenyHosts,
+		Blocklist:    blockedHosts,
+		Shorteners:   cfg.ShortenerHosts,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load URL policy: %v", err)
+	}
+
+	slugGenerator, err := slugs.New(slugs.Options{
+		Strategy: cfg.SlugStrategy,
+		Size:     cfg.SlugLength,
+		Salt:     cfg.SlugSalt,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up slug generation: %v", err)
+	}
+
+	// Variant hits are written with the same delay as clicks
+	hitCounter := links.NewHitCounter(linkRepo, cfg.ClickFlushInterval)
+
+	linkService := links.NewServiceWithOptions(linkRepo, cfg.RedirectDomain, links.ServiceOptions{
+		Cache:         linkCache,
+		Policy:        urlPolicy,
+		Domains:       domainService,
+		MaxChainDepth: cfg.LinkChainMaxDepth,
+		Slugs:         slugGenerator,
+		Hits:          hitCounter,
+	})
+	linkHandler := linksHttp.NewHandler(linkService, linksHttp.Options{
+		Recorder:     clickRecorder,
+		UnlockSecret: []byte(cfg.UnlockCookieSecret),
+		UnlockTTL:    cfg.UnlockCookieTTL,
+
+		DefaultRedirectStatus: cfg.DefaultRedirectStatus,
+		GeoIP:                 geoResolver,
+		ShortURLBase:          cfg.RedirectScheme + "://" + cfg.RedirectDomain,
+		Domains:               domainService,
+		QRLogo:                qrLogo,
+		Bots:                  bots,
+		Fallback:              fallbackPages,
+		RootRedirectURL:       cfg.RootRedirectURL,
+		WellKnown:             wellKnownFiles,
+		RateLimiter:           rateLimiter,
+		Blocklist:             blockedHosts,
+	})
+	if cfg.UnlockCookieSecret == "" {
+		log.Println("UNLOCK_COOKIE_SECRET is not set; password unlocks will not survive restarts")
+	}
 
 	// Setup Server
-	r := api.NewRouter(cfg, linkHandler)
+	r := api.NewRouter(cfg, linkHandler, domainsHttp.NewHandler(domainService))
 
 	// Setup HTTP Server
 	srv := &http.Server{
@@ -58,6 +260,36 @@ func main() {
 		}
 	}()
 
+	// Start Redirect Server
+	var redirectSrv *http.Server
+	if cfg.RedirectPort != "" {
+		redirectSrv = &http.Server{
+			Addr:    ":" + cfg.RedirectPort,
+			Handler: api.NewRedirectRouter(cfg, linkHandler),
+		}
+		go func() {
+			log.Printf("Starting redirect server on port %s...", cfg.RedirectPort)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start redirect server: %v", err)
+			}
+		}()
+	}
+
+	// Start Metrics Server
+	var metricsSrv *http.Server
+	if cfg.MetricsPort != "" {
+		metricsSrv = &http.Server{
+			Addr:    ":" + cfg.MetricsPort,
+			Handler: api.NewMetricsRouter(cfg),
+		}
+		go func() {
+			log.Printf("Starting metrics server on port %s...", cfg.MetricsPort)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start metrics server: %v", err)
+			}
+		}()
+	}
+
 	// Wait for Interrupt Signal
 	<-ctx.Done()
 	log.Println("Shutdown signal received")
@@ -71,4 +303,67 @@ func main() {
 	} else {
 		log.Println("Server exited gracefully")
 	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Redirect server forced to shutdown: %v", err)
+		} else {
+			log.Println("Redirect server exited gracefully")
+		}
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Metrics server forced to shutdown: %v", err)
+		}
+	}
+
+	// Flush buffered clicks once no more requests can come in
+	if err := clickRecorder.Close(shutdownCtx); err != nil {
+		log.Printf("Failed to flush clicks: %v", err)
+	}
+	stats := clickRecorder.Stats()
+	log.Printf("Click recorder stopped (flushed: %d, dropped: %d, failed: %d)", stats.Flushed, stats.Dropped, stats.Failed)
+	if err := hitCounter.Close(shutdownCtx); err != nil {
+		log.Printf("Failed to flush variant hits: %v", err)
+	}
+}
+
+// reloadDomains refreshes the domains kept in memory; on failure, the
+// previous ones stay in use.
+func reloadDomains(ctx context.Context, service domains.Service) {
+	if err := service.Reload(ctx); err != nil {
+		log.Printf("Failed to reload domains: %v", err)
+	}
+}
+
+// reloader re-reads a file the server depends on.
+type reloader struct {
+	name   string
+	reload func() error
+}
+
+// reloadOnHangup reloads every file on SIGHUP, e.g. after an update
+// replaced it, until ctx is done.
+func reloadOnHangup(ctx context.Context, reloaders []reloader) {
+	if len(reloaders) == 0 {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			for _, r := range reloaders {
+				if err := r.reload(); err != nil {
+					log.Printf("Failed to reload %s: %v", r.name, err)
+					continue
+				}
+				log.Printf("%s reloaded", r.name)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
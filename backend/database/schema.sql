@@ -10,17 +10,106 @@ CREATE EXTENSION IF NOT EXISTS pg_trgm;
 -- Tables
 -- =============================================
 
+-- Short domains served besides the primary redirect domain (REDIRECT_DOMAIN).
+-- Each domain has its own namespace of slugs and its own defaults.
+CREATE TABLE IF NOT EXISTS domains (
+    id BIGSERIAL PRIMARY KEY,
+    -- As sent in the Host header: lower case, with an optional port
+    host TEXT NOT NULL UNIQUE,
+    -- Redirect status of links without their own; NULL means the server default
+    redirect_status SMALLINT CHECK (redirect_status IN (301, 302, 307, 308)),
+    -- Where unknown or unavailable slugs on the domain send visitors; NULL
+    -- means the server's fallbacks
+    fallback_url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 CREATE TABLE IF NOT EXISTS links (
     id BIGSERIAL PRIMARY KEY,
-    -- Slug must be unique. Using TEXT is preferred over VARCHAR in Postgres
-    -- as there is no performance penalty and it offers flexibility.
-    slug TEXT NOT NULL UNIQUE,
+    -- Domain the link is served on; NULL is the primary redirect domain.
+    -- Domains cannot be deleted while they have links.
+    domain_id BIGINT REFERENCES domains(id) ON DELETE RESTRICT,
+    -- Slug must be unique per domain. Using TEXT is preferred over VARCHAR in
+    -- Postgres as there is no performance penalty and it offers flexibility.
+    slug TEXT NOT NULL,
     url TEXT NOT NULL,
     is_active BOOLEAN DEFAULT TRUE,
+    -- Optional activation window: the link only redirects between
+    -- active_from and active_until. Either bound may be left open.
+    active_from TIMESTAMP WITH TIME ZONE,
+    active_until TIMESTAMP WITH TIME ZONE,
+    -- Optional usage limits: the link stops redirecting once past expires_at
+    -- or once click_count reaches max_clicks. click_count is only maintained
+    -- for links that have a max_clicks limit.
+    expires_at TIMESTAMP WITH TIME ZONE,
+    max_clicks BIGINT CHECK (max_clicks > 0),
+    click_count BIGINT NOT NULL DEFAULT 0,
+    -- bcrypt hash of the unlock password; NULL when the link is public
+    password_hash TEXT,
+    -- HTTP status used for the redirect; NULL means the server default
+    redirect_status SMALLINT CHECK (redirect_status IN (301, 302, 307, 308)),
+    -- How the incoming query string is carried over to the destination
+    query_mode TEXT NOT NULL DEFAULT 'off' CHECK (query_mode IN ('off', 'append', 'override', 'preserve')),
+    -- Prefix link: the path after the slug is appended to the destination
+    forward_path BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Per-country destination overrides: [{"country": "TW", "url": "..."}]
+    country_rules JSONB NOT NULL DEFAULT '[]'::jsonb,
+    -- Platform destination overrides, checked in order: [{"os": "ios", "device": "mobile", "browser": "safari", "url": "..."}]
+    device_rules JSONB NOT NULL DEFAULT '[]'::jsonb,
+    -- Accept-Language destination overrides: [{"language": "zh-TW", "url": "..."}]
+    language_rules JSONB NOT NULL DEFAULT '[]'::jsonb,
+    -- Mobile app deep link, tried on iOS and Android before falling back to
+    -- the store or the web: {"ios_url": "myapp://...", "ios_store_url": "...", "android_url": "...", "android_store_url": "..."}
+    deep_link JSONB,
+    -- Card shown by chat apps and social networks instead of the
+    -- destination's; NULL fields are left out
+    og_title TEXT,
+    og_description TEXT,
+    og_image_url TEXT,
+    -- Keep returning visitors on the variant they were first assigned
+    sticky_variants BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (active_from IS NULL OR active_until IS NULL OR active_from < active_until),
+    -- Links on the primary domain (NULL) share one namespace too
+    UNIQUE NULLS NOT DISTINCT (domain_id, slug)
+);
+
+-- Weighted alternative destinations of a link (A/B tests). When a link has
+-- variants, traffic is split among them by weight instead of going to 'url'.
+CREATE TABLE IF NOT EXISTS link_variants (
+    id BIGSERIAL PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    weight INTEGER NOT NULL CHECK (weight >= 0),
+    hit_count BIGINT NOT NULL DEFAULT 0,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Every redirect served is recorded here by the asynchronous click recorder.
+CREATE TABLE IF NOT EXISTS clicks (
+    id BIGSERIAL PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    clicked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    referrer TEXT,
+    user_agent TEXT,
+    client_ip INET,
+    accept_language TEXT,
+    -- Redirects served to bots, crawlers and link previews; analytics
+    -- usually exclude them
+    is_bot BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- Token buckets of RATE_LIMIT_STORE=postgres, shared by all instances: each
+-- row is the time a client's bucket is full again. Rows are disposable, so
+-- the table skips the WAL.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    full_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
 -- =============================================
 -- Automation Logic (Triggers)
 -- =============================================
@@ -35,12 +124,98 @@ END;
 $$ language 'plpgsql';
 
 -- Trigger to execute the function before any update on the 'links' table
+-- Consuming a click is not an edit, so it leaves 'updated_at' untouched.
 DROP TRIGGER IF EXISTS update_links_updated_at ON links;
 CREATE TRIGGER update_links_updated_at
     BEFORE UPDATE ON links
     FOR EACH ROW
+    WHEN (OLD.click_count IS NOT DISTINCT FROM NEW.click_count)
     EXECUTE FUNCTION update_updated_at_column();
 
+-- Cache key of a link: its slug, prefixed with '{domain_id}/' for links not
+-- on the primary domain.
+CREATE OR REPLACE FUNCTION link_cache_key(domain_id BIGINT, slug TEXT)
+RETURNS TEXT AS $$
+    SELECT COALESCE(domain_id || '/', '') || slug;
+$$ language 'sql' IMMUTABLE;
+
+-- Announce changed links on the 'link_changes' channel, so every backend
+-- instance can drop them from its redirect cache. Consuming a click is not
+-- announced: the click limit is enforced by the database itself.
+CREATE OR REPLACE FUNCTION notify_link_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('link_changes', link_cache_key(OLD.domain_id, OLD.slug));
+    ELSE
+        PERFORM pg_notify('link_changes', link_cache_key(NEW.domain_id, NEW.slug));
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_links_insert_delete ON links;
+CREATE TRIGGER notify_links_insert_delete
+    AFTER INSERT OR DELETE ON links
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_link_change();
+
+DROP TRIGGER IF EXISTS notify_links_update ON links;
+CREATE TRIGGER notify_links_update
+    AFTER UPDATE ON links
+    FOR EACH ROW
+    WHEN (OLD.click_count IS NOT DISTINCT FROM NEW.click_count)
+    EXECUTE FUNCTION notify_link_change();
+
+-- Variants are cached with their link, so changing one announces the link.
+-- Hit counters are not announced.
+CREATE OR REPLACE FUNCTION notify_link_variant_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    link_key TEXT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        SELECT link_cache_key(domain_id, slug) INTO link_key FROM links WHERE id = OLD.link_id;
+    ELSE
+        SELECT link_cache_key(domain_id, slug) INTO link_key FROM links WHERE id = NEW.link_id;
+    END IF;
+    -- Variants deleted along with their link were announced by the link
+    IF link_key IS NOT NULL THEN
+        PERFORM pg_notify('link_changes', link_key);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_link_variants_insert_delete ON link_variants;
+CREATE TRIGGER notify_link_variants_insert_delete
+    AFTER INSERT OR DELETE ON link_variants
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_link_variant_change();
+
+DROP TRIGGER IF EXISTS notify_link_variants_update ON link_variants;
+CREATE TRIGGER notify_link_variants_update
+    AFTER UPDATE ON link_variants
+    FOR EACH ROW
+    WHEN (OLD.url IS DISTINCT FROM NEW.url OR OLD.weight IS DISTINCT FROM NEW.weight)
+    EXECUTE FUNCTION notify_link_variant_change();
+
+-- Domains are kept in memory by every instance, which reloads them when
+-- announced on the 'domain_changes' channel.
+CREATE OR REPLACE FUNCTION notify_domain_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('domain_changes', '');
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_domains_change ON domains;
+CREATE TRIGGER notify_domains_change
+    AFTER INSERT OR UPDATE OR DELETE ON domains
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION notify_domain_change();
+
 -- =============================================
 -- Indexes (Performance Optimization)
 -- =============================================
@@ -54,3 +229,12 @@ CREATE INDEX IF NOT EXISTS idx_links_created_at_desc ON links(created_at DESC);
 -- Without these, searching 100k+ rows will result in slow full-table scans.
 CREATE INDEX IF NOT EXISTS idx_links_slug_trgm ON links USING gin (slug gin_trgm_ops);
 CREATE INDEX IF NOT EXISTS idx_links_url_trgm ON links USING gin (url gin_trgm_ops);
+
+-- Analytics Optimization
+-- Per-link click queries are always scoped by link and time range.
+CREATE INDEX IF NOT EXISTS idx_clicks_link_id_clicked_at ON clicks(link_id, clicked_at DESC);
+-- Most reports only count human clicks.
+CREATE INDEX IF NOT EXISTS idx_clicks_link_id_clicked_at_human ON clicks(link_id, clicked_at DESC) WHERE NOT is_bot;
+
+-- Variants are always loaded per link on redirect.
+CREATE INDEX IF NOT EXISTS idx_link_variants_link_id ON link_variants(link_id);
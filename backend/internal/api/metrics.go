@@ -0,0 +1,25 @@
+package api
+
+import (
+	"expvar"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/config"
+)
+
+// NewMetricsRouter serves the runtime metrics for the internal metrics
+// listener. They include the command line and memory statistics, so they are
+// kept off the public API and redirect ports.
+func NewMetricsRouter(cfg *config.Config) *gin.Engine {
+	if cfg.IsProduction {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// Runtime metrics (click recorder counters, etc.)
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+
+	return r
+}
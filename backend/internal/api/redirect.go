@@ -0,0 +1,24 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/config"
+	linksHttp "github.com/nekogravitycat/linkhub/internal/links/http"
+)
+
+// NewRedirectRouter serves short links at the root path for the native
+// redirect listener. Only visitors reach it, so it has no CORS, metrics or
+// admin routes.
+func NewRedirectRouter(cfg *config.Config, linkHandler *linksHttp.Handler) *gin.Engine {
+	if cfg.IsProduction {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	r := gin.New()
+	trustProxies(r, cfg)
+	r.Use(gin.Logger(), gin.Recovery())
+
+	linksHttp.RegisterRedirectRoutes(r, linkHandler)
+
+	return r
+}
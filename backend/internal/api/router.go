@@ -1,21 +1,24 @@
 package api
 
 import (
+	"log"
 	"slices"
 	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/nekogravitycat/linkhub/internal/config"
+	domainsHttp "github.com/nekogravitycat/linkhub/internal/domains/http"
 	linksHttp "github.com/nekogravitycat/linkhub/internal/links/http"
 )
 
-func NewRouter(cfg *config.Config, linkHandler *linksHttp.Handler) *gin.Engine {
+func NewRouter(cfg *config.Config, linkHandler *linksHttp.Handler, domainHandler *domainsHttp.Handler) *gin.Engine {
 	if cfg.IsProduction {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	r := gin.New()
+	trustProxies(r, cfg)
 
 	// Global Middleware
 	r.Use(gin.Logger(), gin.Recovery())
@@ -56,6 +59,16 @@ func NewRouter(cfg *config.Config, linkHandler *linksHttp.Handler) *gin.Engine {
 
 	// Register Routes
 	linksHttp.RegisterRoutes(r, linkHandler)
+	domainsHttp.RegisterRoutes(r, domainHandler)
 
 	return r
 }
+
+// trustProxies limits the proxies whose X-Forwarded-For is believed for the
+// client IP, which rate limits, unlock throttling, country rules and click
+// statistics are keyed on. Without any, the peer address is used.
+func trustProxies(r *gin.Engine, cfg *config.Config) {
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+// Package blocklist matches hosts against lists of malicious domains.
+//
+// A List is loaded from files in any mix of three formats, detected per
+// line:
+//
+//	evil.example             plain domains, optionally as *.evil.example
+//	0.0.0.0 evil.example     hosts files, any number of names per address
+//	||evil.example^          adblock patterns; @@||... are exceptions
+//
+// Every entry blocks the domain and its subdomains. Lines that are none of
+// these, like adblock rules for paths, are skipped.
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+)
+
+// Adblock options that still mean "block the whole domain".
+var blockingOptions = map[string]bool{"all": true, "document": true, "doc": true, "important": true}
+
+// List holds the entries of the blocklist files, which can be reloaded in
+// place.
+type List struct {
+	paths   []string
+	entries atomic.Pointer[entries]
+}
+
+// entries is an immutable snapshot of the files. Domains map to the index
+// of the file they come from, so a host is matched by looking up each of
+// its suffixes.
+type entries struct {
+	blocked    map[string]int
+	exceptions map[string]int
+	sources    []string
+	skipped    int
+	loadedAt   time.Time
+}
+
+// Stats describes the loaded entries.
+type Stats struct {
+	Blocked    int       `json:"blocked"`
+	Exceptions int       `json:"exceptions"`
+	Skipped    int       `json:"skipped"`
+	LoadedAt   time.Time `json:"loaded_at"`
+}
+
+// Open reads the files at paths.
+func Open(paths []string) (*List, error) {
+	l := &List{paths: paths}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload re-reads the files. If one cannot be read, the previous entries
+// stay in use.
+func (l *List) Reload() error {
+	e := &entries{
+		blocked:    make(map[string]int),
+		exceptions: make(map[string]int),
+		loadedAt:   time.Now(),
+	}
+	for i, path := range l.paths {
+		e.sources = append(e.sources, filepath.Base(path))
+		if err := e.load(path, i); err != nil {
+			return err
+		}
+	}
+	l.entries.Store(e)
+	return nil
+}
+
+// Match returns the entry blocking a normalized host (see
+// urlpolicy.NormalizeHost), described with the file it comes from. A nil
+// *List blocks nothing.
+func (l *List) Match(host string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	e := l.entries.Load()
+
+	// IP addresses have no parent domains
+	if _, err := netip.ParseAddr(host); err == nil {
+		if source, ok := e.blocked[host]; ok {
+			if _, ok := e.exceptions[host]; !ok {
+				return e.describe(host, source), true
+			}
+		}
+		return "", false
+	}
+
+	entry, source := "", -1
+	for suffix := host; ; {
+		if _, ok := e.exceptions[suffix]; ok {
+			return "", false
+		}
+		if i, ok := e.blocked[suffix]; ok && source < 0 {
+			entry, source = suffix, i
+		}
+
+		dot := strings.IndexByte(suffix, '.')
+		if dot < 0 {
+			break
+		}
+		suffix = suffix[dot+1:]
+	}
+	if source < 0 {
+		return "", false
+	}
+	return e.describe(entry, source), true
+}
+
+// Stats returns the counts of the loaded entries.
+func (l *List) Stats() Stats {
+	e := l.entries.Load()
+	return Stats{
+		Blocked:    len(e.blocked),
+		Exceptions: len(e.exceptions),
+		Skipped:    e.skipped,
+		LoadedAt:   e.loadedAt,
+	}
+}
+
+// Watch reloads the files whenever one of them changes, checking every
+// interval until ctx is done.
+func (l *List) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := l.fingerprint()
+	for {
+		select {
+		case <-ticker.C:
+			current := l.fingerprint()
+			if current == last {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				log.Printf("Failed to reload blocklist: %v", err)
+				continue
+			}
+			last = current
+			log.Printf("Blocklist reloaded (%d entries)", l.Stats().Blocked)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fingerprint identifies the current version of the files by their size
+// and modification time.
+func (l *List) fingerprint() string {
+	var b strings.Builder
+	for _, path := range l.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			b.WriteString("missing;")
+			continue
+		}
+		fmt.Fprintf(&b, "%d/%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+func (e *entries) describe(entry string, source int) string {
+	return entry + " in " + e.sources[source]
+}
+
+func (e *entries) load(path string, source int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+
+		domains, exception := parseLine(line)
+		if domains == nil {
+			e.skipped++
+			continue
+		}
+		for _, domain := range domains {
+			if exception {
+				e.exceptions[domain] = source
+			} else if _, ok := e.blocked[domain]; !ok {
+				e.blocked[domain] = source
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseLine returns the domains of a line, and whether they are exceptions.
+// It returns nil for lines that block nothing it can match.
+func parseLine(line string) ([]string, bool) {
+	if i := strings.Index(line, " #"); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+
+	if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@||") {
+		exception := strings.HasPrefix(line, "@@")
+		domain, ok := parseAdblock(strings.TrimPrefix(strings.TrimPrefix(line, "@@"), "||"))
+		if !ok {
+			return nil, false
+		}
+		return []string{domain}, exception
+	}
+
+	fields := strings.Fields(line)
+	if _, err := netip.ParseAddr(fields[0]); err == nil && len(fields) > 1 {
+		var domains []string
+		for _, field := range fields[1:] {
+			if domain, ok := normalizeDomain(field); ok {
+				domains = append(domains, domain)
+			}
+		}
+		return domains, false
+	}
+
+	if len(fields) != 1 {
+		return nil, false
+	}
+	domain := strings.TrimPrefix(strings.TrimPrefix(fields[0], "*"), ".")
+	if domain, ok := normalizeDomain(domain); ok {
+		return []string{domain}, false
+	}
+	return nil, false
+}
+
+// parseAdblock returns the domain of a pattern like "evil.example^", which
+// blocks the whole domain, and false for patterns that block less.
+func parseAdblock(pattern string) (string, bool) {
+	pattern, options, _ := strings.Cut(pattern, "$")
+	if options != "" {
+		for option := range strings.SplitSeq(options, ",") {
+			if !blockingOptions[option] {
+				return "", false
+			}
+		}
+	}
+	domain, ok := strings.CutSuffix(pattern, "^")
+	if !ok {
+		domain = strings.TrimSuffix(pattern, "/")
+	}
+	return normalizeDomain(domain)
+}
+
+// normalizeDomain normalizes a domain of a list and reports whether it can
+// be matched. Names without a dot, like "localhost" in hosts files, would
+// block a whole top-level domain and are skipped.
+func normalizeDomain(domain string) (string, bool) {
+	if !strings.Contains(domain, ".") {
+		return "", false
+	}
+	host, err := urlpolicy.NormalizeHost(domain)
+	if err != nil {
+		return "", false
+	}
+	for _, r := range host {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '_') {
+			return "", false
+		}
+	}
+	return host, true
+}
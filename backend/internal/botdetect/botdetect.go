@@ -0,0 +1,146 @@
+// Package botdetect tells bots, crawlers and link-unfurling services apart
+// from people following a link.
+package botdetect
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Reasons a request was classified as a bot.
+const (
+	ReasonUserAgent   = "user-agent"
+	ReasonNoUserAgent = "no-user-agent"
+	ReasonHead        = "head-request"
+	ReasonNoAccept    = "no-accept"
+)
+
+//go:embed patterns.txt
+var defaultPatterns string
+
+//go:embed previews.txt
+var previewPatterns string
+
+var previewPattern = mustCompile(previewPatterns)
+
+// Result is the classification of a request.
+type Result struct {
+	Bot bool
+	// Reason is one of the Reason constants for bots, empty for humans
+	Reason string
+}
+
+// Classifier classifies requests.
+type Classifier interface {
+	Classify(r *http.Request) Result
+}
+
+// Patterns is a Classifier matching User-Agents against a pattern list,
+// completed by request heuristics. The list can be reloaded in place.
+type Patterns struct {
+	path    string
+	pattern atomic.Pointer[regexp.Regexp]
+}
+
+// Default returns a classifier using the built-in pattern list.
+func Default() *Patterns {
+	p := &Patterns{}
+	p.pattern.Store(mustCompile(defaultPatterns + "\n" + previewPatterns))
+	return p
+}
+
+// Open returns a classifier using the pattern list in the file at path.
+func Open(path string) (*Patterns, error) {
+	p := &Patterns{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload re-reads the pattern file. The previous list stays in use if it
+// fails. Classifiers using the built-in list have nothing to reload.
+func (p *Patterns) Reload() error {
+	if p.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+
+	re, err := compile(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+	p.pattern.Store(re)
+	return nil
+}
+
+// Classify reports whether the request comes from a bot. Bots are
+// recognised by their User-Agent first; requests real browsers never make
+// (HEAD requests, or no Accept header) are treated as bots too.
+func (p *Patterns) Classify(r *http.Request) Result {
+	userAgent := r.UserAgent()
+
+	switch {
+	case userAgent == "":
+		return Result{Bot: true, Reason: ReasonNoUserAgent}
+	case p.pattern.Load().MatchString(userAgent):
+		return Result{Bot: true, Reason: ReasonUserAgent}
+	case r.Method == http.MethodHead:
+		return Result{Bot: true, Reason: ReasonHead}
+	case r.Header.Get("Accept") == "":
+		return Result{Bot: true, Reason: ReasonNoAccept}
+	}
+	return Result{}
+}
+
+// IsLinkPreview reports whether the User-Agent belongs to a chat app or
+// social network fetching a shared link to show it as a card.
+func IsLinkPreview(userAgent string) bool {
+	return userAgent != "" && previewPattern.MatchString(userAgent)
+}
+
+// mustCompile compiles a built-in list.
+func mustCompile(list string) *regexp.Regexp {
+	re, err := compile(list)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in bot patterns: %v", err))
+	}
+	return re
+}
+
+// compile joins the patterns of a list into one case-insensitive regexp.
+// Each pattern is checked on its own first, so errors name the line.
+func compile(list string) (*regexp.Regexp, error) {
+	var patterns []string
+
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		patterns = append(patterns, "(?:"+pattern+")")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(patterns) == 0 {
+		// Matches nothing
+		return regexp.MustCompile(`[^\x00-\x{10FFFF}]`), nil
+	}
+	return regexp.Compile("(?i)" + strings.Join(patterns, "|"))
+}
@@ -0,0 +1,27 @@
+package clicks
+
+import (
+	"net/netip"
+	"time"
+)
+
+// Click is a single redirect served for a link.
+type Click struct {
+	LinkID         int64
+	ClickedAt      time.Time
+	Referrer       string
+	UserAgent      string
+	ClientIP       netip.Addr
+	AcceptLanguage string
+	// IsBot marks redirects served to bots, crawlers and link previews
+	IsBot bool
+}
+
+// Stats reports the counters of a Recorder since it was started.
+type Stats struct {
+	Recorded int64 `json:"recorded"`
+	Dropped  int64 `json:"dropped"`
+	Flushed  int64 `json:"flushed"`
+	Failed   int64 `json:"failed"`
+	Pending  int   `json:"pending"`
+}
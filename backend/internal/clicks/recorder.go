@@ -0,0 +1,167 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const flushTimeout = 10 * time.Second
+
+var ErrRecorderClosed = errors.New("click recorder is closed")
+
+// Recorder buffers clicks in memory and writes them to the repository in
+// batches from a background goroutine, so callers never wait on the database.
+type Recorder interface {
+	// Record enqueues a click without blocking. It returns false if the
+	// click was dropped because the buffer is full or the recorder is closed.
+	Record(click *Click) bool
+	Stats() Stats
+	// Close stops accepting clicks and flushes everything still buffered.
+	Close(ctx context.Context) error
+}
+
+type RecorderOptions struct {
+	BufferSize    int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+type recorder struct {
+	repo  Repository
+	opts  RecorderOptions
+	queue chan *Click
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	recorded atomic.Int64
+	dropped  atomic.Int64
+	flushed  atomic.Int64
+	failed   atomic.Int64
+}
+
+func NewRecorder(repo Repository, opts RecorderOptions) Recorder {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	r := &recorder{
+		repo:  repo,
+		opts:  opts,
+		queue: make(chan *Click, opts.BufferSize),
+		done:  make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+func (r *recorder) Record(click *Click) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		r.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case r.queue <- click:
+		r.recorded.Add(1)
+		return true
+	default:
+		// Backpressure: never block the redirect, drop the click instead
+		r.dropped.Add(1)
+		return false
+	}
+}
+
+func (r *recorder) Stats() Stats {
+	return Stats{
+		Recorded: r.recorded.Load(),
+		Dropped:  r.dropped.Load(),
+		Flushed:  r.flushed.Load(),
+		Failed:   r.failed.Load(),
+		Pending:  len(r.queue),
+	}
+}
+
+func (r *recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRecorderClosed
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Click, 0, r.opts.BatchSize)
+	var lastDropped int64
+
+	for {
+		select {
+		case click, ok := <-r.queue:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= r.opts.BatchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+
+			if dropped := r.dropped.Load(); dropped > lastDropped {
+				log.Printf("click recorder dropped %d clicks (buffer full)", dropped-lastDropped)
+				lastDropped = dropped
+			}
+		}
+	}
+}
+
+func (r *recorder) flush(batch []*Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	n, err := r.repo.InsertBatch(ctx, batch)
+	if err != nil {
+		r.failed.Add(int64(len(batch)))
+		log.Printf("failed to write %d clicks: %v", len(batch), err)
+		return
+	}
+	r.flushed.Add(n)
+}
@@ -0,0 +1,94 @@
+package clicks
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository interface {
+	// InsertBatch stores the clicks and returns how many were stored. Clicks
+	// of links deleted since the redirect are skipped.
+	InsertBatch(ctx context.Context, clicks []*Click) (int64, error)
+}
+
+// Clicks are copied into a staging table first, so the few of a link
+// deleted between the redirect and the flush can be filtered out instead of
+// failing the whole batch on the foreign key. They would have been deleted
+// with the link anyway.
+const (
+	createStagingQuery = `
+CREATE TEMP TABLE clicks_staging (
+    link_id BIGINT NOT NULL,
+    clicked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    referrer TEXT,
+    user_agent TEXT,
+    client_ip INET,
+    accept_language TEXT,
+    is_bot BOOLEAN NOT NULL
+) ON COMMIT DROP`
+
+	moveStagingQuery = `
+INSERT INTO clicks (link_id, clicked_at, referrer, user_agent, client_ip, accept_language, is_bot)
+SELECT s.link_id, s.clicked_at, s.referrer, s.user_agent, s.client_ip, s.accept_language, s.is_bot
+FROM clicks_staging s
+WHERE EXISTS (SELECT 1 FROM links l WHERE l.id = s.link_id)`
+)
+
+type repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) InsertBatch(ctx context.Context, clicks []*Click) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, createStagingQuery); err != nil {
+		return 0, err
+	}
+
+	columns := []string{"link_id", "clicked_at", "referrer", "user_agent", "client_ip", "accept_language", "is_bot"}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"clicks_staging"}, columns, pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+		click := clicks[i]
+
+		var clientIP any
+		if click.ClientIP.IsValid() {
+			clientIP = click.ClientIP
+		}
+
+		return []any{
+			click.LinkID,
+			click.ClickedAt,
+			nullIfEmpty(click.Referrer),
+			nullIfEmpty(click.UserAgent),
+			clientIP,
+			nullIfEmpty(click.AcceptLanguage),
+			click.IsBot,
+		}, nil
+	}))
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, moveStagingQuery)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -3,19 +3,119 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// defaultTrustedProxies only believes X-Forwarded-For from a proxy on the
+// same host; anyone else could set it to dodge per-client limits.
+var defaultTrustedProxies = []string{"127.0.0.1", "::1"}
+
 type Config struct {
-	Port            string
+	Port string
+	// RedirectPort, if set, serves short links at the root path on a second
+	// listener, so no rewriting proxy is needed in front of the server
+	RedirectPort string
+	// MetricsPort, if set, serves runtime metrics at /debug/vars on an
+	// internal listener; they are not served otherwise
+	MetricsPort     string
 	DatabaseDSN     string
 	TestDatabaseDSN string
 	IsProduction    bool
 	AllowOrigins    []string
-	RedirectDomain  string
+	// TrustedProxies are the addresses or CIDRs allowed to set
+	// X-Forwarded-For; loopback addresses by default
+	TrustedProxies []string
+	RedirectDomain string
+	// RedirectScheme is the scheme short URLs are served on (http or https)
+	RedirectScheme string
+	// DefaultRedirectStatus is used for links without their own redirect status
+	DefaultRedirectStatus int
+
+	ClickBufferSize    int
+	ClickBatchSize     int
+	ClickFlushInterval time.Duration
+
+	UnlockCookieSecret string
+	UnlockCookieTTL    time.Duration
+
+	// RedirectCacheSize is the number of slugs kept in memory for
+	// redirects; 0 disables the cache
+	RedirectCacheSize        int
+	RedirectCacheTTL         time.Duration
+	RedirectCacheNegativeTTL time.Duration
+
+	// GeoIPDatabase is the path of a MaxMind-format .mmdb file used for
+	// country rules; empty disables them
+	GeoIPDatabase string
+
+	// QRLogo is the path of a PNG or JPEG image that QR codes may show in
+	// their centre; empty disables logos
+	QRLogo string
+
+	// BotPatternsFile replaces the built-in list of bot User-Agent patterns
+	BotPatternsFile string
+
+	// FallbackTemplatesDir may hold HTML templates replacing the built-in
+	// pages for unknown, inactive and expired links
+	FallbackTemplatesDir string
+	// Fallback*URL send visitors to a URL instead of rendering the page
+	FallbackNotFoundURL string
+	FallbackInactiveURL string
+	FallbackExpiredURL  string
+	// RootRedirectURL is where the bare redirect domain sends visitors
+	RootRedirectURL string
+
+	// AppleAppSiteAssociationFile and AssetLinksFile are served under
+	// /.well-known/ on the redirect domains, for universal links and App
+	// Links; empty serves none
+	AppleAppSiteAssociationFile string
+	AssetLinksFile              string
+
+	// RateLimitStore keeps the rate limits of redirects: "memory" per
+	// replica, "postgres" shared by all replicas, or "off"
+	RateLimitStore string
+	// RateLimitPerMinute and RateLimitBurst budget the redirects of a client;
+	// a rate of 0 disables the limit
+	RateLimitPerMinute int
+	RateLimitBurst     int
+	// RateLimitNotFound* budget the requests of a client that find no link;
+	// a rate of 0 disables the limit
+	RateLimitNotFoundPerMinute int
+	RateLimitNotFoundBurst     int
+
+	// URL policy of link destinations: allowed schemes, whether private
+	// network addresses are allowed, and host allow and deny lists
+	URLSchemes      []string
+	URLAllowPrivate bool
+	URLAllowHosts   []string
+	URLDenyHosts    []string
+	// ShortenerHosts are the link shorteners whose URLs are flagged; empty
+	// means the built-in list
+	ShortenerHosts []string
+	// LinkChainMaxDepth is how many short links in a row a destination may
+	// start; 0 rejects destinations on the short domains
+	LinkChainMaxDepth int
+
+	// BlocklistFiles are domain lists, hosts files or adblock lists of
+	// malicious hosts; BlocklistWatchInterval is how often they are checked
+	// for changes, 0 disables watching
+	BlocklistFiles         []string
+	BlocklistWatchInterval time.Duration
+
+	// SlugStrategy generates the slugs of links created without one:
+	// "random", "hashid" or "words". SlugLength is the initial length, in
+	// characters or words, 0 meaning the strategy's default; SlugSalt
+	// scrambles hashid slugs.
+	SlugStrategy string
+	SlugLength   int
+	SlugSalt     string
 }
 
 func Load() (*Config, error) {
@@ -30,22 +130,195 @@ func Load() (*Config, error) {
 		isProduction = false
 	}
 
-	allowOriginsRaw := getEnv("ALLOW_ORIGINS", "")
-	var allowOrigins []string
-	if allowOriginsRaw != "" {
-		origins := strings.SplitSeq(allowOriginsRaw, ",")
-		for origin := range origins {
-			allowOrigins = append(allowOrigins, strings.TrimSpace(origin))
+	allowOrigins := getEnvList("ALLOW_ORIGINS")
+
+	clickBufferSize, err := getEnvInt("CLICK_BUFFER_SIZE", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	clickBatchSize, err := getEnvInt("CLICK_BATCH_SIZE", 500)
+	if err != nil {
+		return nil, err
+	}
+
+	clickFlushInterval, err := getEnvDuration("CLICK_FLUSH_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRedirectStatus, err := getEnvInt("DEFAULT_REDIRECT_STATUS", 302)
+	if err != nil {
+		return nil, err
+	}
+	switch defaultRedirectStatus {
+	case 301, 302, 307, 308:
+	default:
+		return nil, fmt.Errorf("invalid DEFAULT_REDIRECT_STATUS: %d (must be 301, 302, 307 or 308)", defaultRedirectStatus)
+	}
+
+	redirectCacheSize, err := getEnvInt("REDIRECT_CACHE_SIZE", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	redirectCacheTTL, err := getEnvDuration("REDIRECT_CACHE_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	redirectCacheNegativeTTL, err := getEnvDuration("REDIRECT_CACHE_NEGATIVE_TTL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	redirectScheme := getEnv("REDIRECT_SCHEME", "https")
+	if redirectScheme != "http" && redirectScheme != "https" {
+		return nil, fmt.Errorf("invalid REDIRECT_SCHEME: %s (must be http or https)", redirectScheme)
+	}
+
+	unlockCookieTTL, err := getEnvDuration("UNLOCK_COOKIE_TTL", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies := getEnvList("TRUSTED_PROXIES")
+	if len(trustedProxies) == 0 {
+		trustedProxies = defaultTrustedProxies
+	}
+	for _, proxy := range trustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %s (must be IP addresses or CIDRs)", proxy)
+		}
+	}
+
+	rateLimitStore := getEnv("RATE_LIMIT_STORE", "memory")
+	switch rateLimitStore {
+	case "memory", "postgres", "off":
+	default:
+		return nil, fmt.Errorf("invalid RATE_LIMIT_STORE: %s (must be memory, postgres or off)", rateLimitStore)
+	}
+
+	rateLimitPerMinute, err := getEnvInt("RATE_LIMIT_PER_MINUTE", 600)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitBurst, err := getEnvInt("RATE_LIMIT_BURST", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitNotFoundPerMinute, err := getEnvInt("RATE_LIMIT_NOT_FOUND_PER_MINUTE", 20)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitNotFoundBurst, err := getEnvInt("RATE_LIMIT_NOT_FOUND_BURST", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	urlAllowPrivate, err := getEnvBool("URL_ALLOW_PRIVATE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	linkChainMaxDepth, err := getEnvInt("LINK_CHAIN_MAX_DEPTH", 0)
+	if err != nil {
+		return nil, err
+	}
+	if linkChainMaxDepth < 0 {
+		return nil, fmt.Errorf("invalid LINK_CHAIN_MAX_DEPTH: %d (must not be negative)", linkChainMaxDepth)
+	}
+
+	blocklistWatchInterval, err := getEnvDuration("BLOCKLIST_WATCH_INTERVAL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	slugStrategy := getEnv("SLUG_STRATEGY", "random")
+	switch slugStrategy {
+	case "random", "hashid", "words":
+	default:
+		return nil, fmt.Errorf("invalid SLUG_STRATEGY: %s (must be random, hashid or words)", slugStrategy)
+	}
+
+	slugLength, err := getEnvInt("SLUG_LENGTH", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbackURLs := make(map[string]string)
+	for _, key := range []string{"FALLBACK_NOT_FOUND_URL", "FALLBACK_INACTIVE_URL", "FALLBACK_EXPIRED_URL", "ROOT_REDIRECT_URL"} {
+		if fallbackURLs[key], err = getEnvURL(key); err != nil {
+			return nil, err
 		}
 	}
 
 	return &Config{
 		Port:            getEnv("PORT", "8080"),
+		RedirectPort:    getEnv("REDIRECT_PORT", ""),
+		MetricsPort:     getEnv("METRICS_PORT", ""),
 		DatabaseDSN:     buildDSN(getEnv("POSTGRES_DB", "linkhub")),
 		TestDatabaseDSN: buildDSN(getEnv("POSTGRES_TEST_DB", "linkhub_test")),
 		IsProduction:    isProduction,
 		AllowOrigins:    allowOrigins,
+		TrustedProxies:  trustedProxies,
 		RedirectDomain:  getEnv("REDIRECT_DOMAIN", "localhost:8003"),
+		RedirectScheme:  redirectScheme,
+
+		DefaultRedirectStatus: defaultRedirectStatus,
+
+		ClickBufferSize:    clickBufferSize,
+		ClickBatchSize:     clickBatchSize,
+		ClickFlushInterval: clickFlushInterval,
+
+		UnlockCookieSecret: getEnv("UNLOCK_COOKIE_SECRET", ""),
+		UnlockCookieTTL:    unlockCookieTTL,
+
+		RedirectCacheSize:        redirectCacheSize,
+		RedirectCacheTTL:         redirectCacheTTL,
+		RedirectCacheNegativeTTL: redirectCacheNegativeTTL,
+
+		GeoIPDatabase: getEnv("GEOIP_DATABASE", ""),
+
+		QRLogo: getEnv("QR_LOGO", ""),
+
+		BotPatternsFile: getEnv("BOT_PATTERNS_FILE", ""),
+
+		FallbackTemplatesDir: getEnv("FALLBACK_TEMPLATES_DIR", ""),
+		FallbackNotFoundURL:  fallbackURLs["FALLBACK_NOT_FOUND_URL"],
+		FallbackInactiveURL:  fallbackURLs["FALLBACK_INACTIVE_URL"],
+		FallbackExpiredURL:   fallbackURLs["FALLBACK_EXPIRED_URL"],
+		RootRedirectURL:      fallbackURLs["ROOT_REDIRECT_URL"],
+
+		AppleAppSiteAssociationFile: getEnv("APPLE_APP_SITE_ASSOCIATION_FILE", ""),
+		AssetLinksFile:              getEnv("ASSET_LINKS_FILE", ""),
+
+		RateLimitStore:             rateLimitStore,
+		RateLimitPerMinute:         rateLimitPerMinute,
+		RateLimitBurst:             rateLimitBurst,
+		RateLimitNotFoundPerMinute: rateLimitNotFoundPerMinute,
+		RateLimitNotFoundBurst:     rateLimitNotFoundBurst,
+
+		URLSchemes:      getEnvList("URL_SCHEMES"),
+		URLAllowPrivate: urlAllowPrivate,
+		URLAllowHosts:   getEnvList("URL_ALLOW_HOSTS"),
+		URLDenyHosts:    getEnvList("URL_DENY_HOSTS"),
+		ShortenerHosts:  getEnvList("SHORTENER_HOSTS"),
+
+		LinkChainMaxDepth: linkChainMaxDepth,
+
+		BlocklistFiles:         getEnvList("BLOCKLIST_FILES"),
+		BlocklistWatchInterval: blocklistWatchInterval,
+
+		SlugStrategy: slugStrategy,
+		SlugLength:   slugLength,
+		SlugSalt:     getEnv("SLUG_SALT", ""),
 	}, nil
 }
 
@@ -64,3 +337,66 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// getEnvBool returns true or false, or fallback if unset.
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %s (must be true or false)", key, value)
+	}
+	return b, nil
+}
+
+// getEnvList returns the comma-separated values of key, or nil if unset.
+func getEnvList(key string) []string {
+	raw := getEnv(key, "")
+	if raw == "" {
+		return nil
+	}
+	var values []string
+	for value := range strings.SplitSeq(raw, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+	return values
+}
+
+// getEnvURL returns an absolute http(s) URL, or an empty string if unset.
+func getEnvURL(key string) (string, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid %s: %s (must be an absolute http or https URL)", key, value)
+	}
+	return value, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
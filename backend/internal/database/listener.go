@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	listenerMinBackoff = 500 * time.Millisecond
+	listenerMaxBackoff = 30 * time.Second
+
+	// How often an idle listener checks that its connection is still alive
+	listenerPingInterval = 30 * time.Second
+)
+
+// Listener receives Postgres notifications on a dedicated connection (not
+// one from the pool, which would be handed to other queries), reconnecting
+// with exponential backoff when it is lost.
+type Listener struct {
+	DSN     string
+	Channel string
+	// OnNotify is called with the payload of every notification
+	OnNotify func(payload string)
+	// OnConnect is called once LISTEN is in effect, and OnDisconnect when
+	// the connection was lost. Notifications sent in between are missed.
+	OnConnect    func()
+	OnDisconnect func()
+}
+
+// Run listens until ctx is done.
+func (l *Listener) Run(ctx context.Context) {
+	backoff := listenerMinBackoff
+
+	for {
+		connected, err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = listenerMinBackoff
+		}
+		log.Printf("Listener on %s lost its connection (retrying in %s): %v", l.Channel, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, listenerMaxBackoff)
+	}
+}
+
+// listen holds one connection until it fails. It reports whether LISTEN
+// succeeded, so Run can reset its backoff.
+func (l *Listener) listen(ctx context.Context) (bool, error) {
+	conn, err := pgx.Connect(ctx, l.DSN)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.Channel}.Sanitize()); err != nil {
+		return false, err
+	}
+
+	if l.OnConnect != nil {
+		l.OnConnect()
+	}
+	if l.OnDisconnect != nil {
+		defer l.OnDisconnect()
+	}
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, listenerPingInterval)
+		notification, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		switch {
+		case err == nil:
+			if l.OnNotify != nil {
+				l.OnNotify(notification.Payload)
+			}
+		case ctx.Err() != nil:
+			return true, ctx.Err()
+		case pgconn.Timeout(err):
+			// Idle: make sure the connection did not silently die
+			if err := conn.Ping(ctx); err != nil {
+				return true, fmt.Errorf("ping failed: %w", err)
+			}
+		default:
+			return true, err
+		}
+	}
+}
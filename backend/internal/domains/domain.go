@@ -0,0 +1,71 @@
+package domains
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/pkg/request"
+)
+
+var ErrInvalidHost = errors.New("invalid host")
+
+// Domain is a short domain links can be served on, besides the primary
+// redirect domain. Each domain has its own namespace of slugs.
+type Domain struct {
+	ID   int64  `json:"id"`
+	Host string `json:"host"`
+	// RedirectStatus applies to links on the domain without their own
+	// redirect status; nil means the server default
+	RedirectStatus *int `json:"redirect_status"`
+	// FallbackURL is where visitors of unknown or unavailable slugs on the
+	// domain are sent; empty means the server's fallbacks
+	FallbackURL string    `json:"fallback_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CreateDomainInput struct {
+	Host           string
+	RedirectStatus *int
+	FallbackURL    string
+}
+
+type UpdateDomainInput struct {
+	RedirectStatus request.Nullable[int]
+	FallbackURL    request.Nullable[string]
+}
+
+var labelRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NormalizeHost returns the canonical form of a host name with an optional
+// port, as sent in the Host header: lower case, without a trailing dot.
+func NormalizeHost(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSpace(host))
+
+	name, port := host, ""
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		name, port = host[:i], host[i+1:]
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", ErrInvalidHost
+		}
+	}
+	name = strings.TrimSuffix(name, ".")
+
+	if name == "" || len(name) > 253 {
+		return "", ErrInvalidHost
+	}
+	for label := range strings.SplitSeq(name, ".") {
+		if !labelRegex.MatchString(label) {
+			return "", ErrInvalidHost
+		}
+	}
+
+	if port != "" {
+		return net.JoinHostPort(name, port), nil
+	}
+	return name, nil
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/domains"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/pkg/request"
+)
+
+type ByHost struct {
+	Host string `uri:"host" binding:"required,max=260"`
+}
+
+type CreateDomainRequest struct {
+	Host string `json:"host" binding:"required,max=260"`
+	// RedirectStatus is one of 301, 302, 307 or 308; omitted means the server default
+	RedirectStatus *int `json:"redirect_status"`
+	// FallbackURL receives visitors of unknown or unavailable slugs
+	FallbackURL string `json:"fallback_url"`
+}
+
+type UpdateDomainRequest struct {
+	// RedirectStatus null resets the domain to the server default
+	RedirectStatus request.Nullable[int] `json:"redirect_status"`
+	// FallbackURL null restores the server's fallbacks
+	FallbackURL request.Nullable[string] `json:"fallback_url"`
+}
+
+type DomainResponse struct {
+	ID             int64     `json:"id"`
+	Host           string    `json:"host"`
+	RedirectStatus *int      `json:"redirect_status"`
+	FallbackURL    *string   `json:"fallback_url"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func newDomainResponse(domain *domains.Domain) *DomainResponse {
+	resp := &DomainResponse{
+		ID:             domain.ID,
+		Host:           domain.Host,
+		RedirectStatus: domain.RedirectStatus,
+		CreatedAt:      domain.CreatedAt,
+		UpdatedAt:      domain.UpdatedAt,
+	}
+	if domain.FallbackURL != "" {
+		resp.FallbackURL = &domain.FallbackURL
+	}
+	return resp
+}
+
+type ListResponse struct {
+	Domains []*DomainResponse `json:"domains"`
+}
+
+func (r *CreateDomainRequest) Validate() error {
+	if err := validateRedirectStatus(r.RedirectStatus); err != nil {
+		return err
+	}
+	if r.FallbackURL != "" {
+		return validateFallbackURL(r.FallbackURL)
+	}
+	return nil
+}
+
+func (r *UpdateDomainRequest) Validate() error {
+	if err := validateRedirectStatus(r.RedirectStatus.Value); err != nil {
+		return err
+	}
+	if r.FallbackURL.Value != nil {
+		return validateFallbackURL(*r.FallbackURL.Value)
+	}
+	return nil
+}
+
+func validateRedirectStatus(status *int) error {
+	if status != nil && !links.ValidRedirectStatus(*status) {
+		return errors.New("redirect_status must be one of 301, 302, 307 or 308")
+	}
+	return nil
+}
+
+func validateFallbackURL(rawURL string) error {
+	if len(rawURL) > 2048 {
+		return errors.New("fallback_url is too long (max 2048 chars)")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("fallback_url must be an absolute http or https URL")
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/domains"
+)
+
+type Handler struct {
+	service domains.Service
+}
+
+func NewHandler(service domains.Service) *Handler {
+	return &Handler{service: service}
+}
+
+// Private: List
+func (h *Handler) List(c *gin.Context) {
+	list, err := h.service.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	response := ListResponse{Domains: make([]*DomainResponse, 0, len(list))}
+	for _, domain := range list {
+		response.Domains = append(response.Domains, newDomainResponse(domain))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Private: Get
+func (h *Handler) Get(c *gin.Context) {
+	var uri ByHost
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domain, err := h.service.Get(c.Request.Context(), uri.Host)
+	if err != nil {
+		if errors.Is(err, domains.ErrDomainNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("domain not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, newDomainResponse(domain))
+}
+
+// Private: Create
+func (h *Handler) Create(c *gin.Context) {
+	var req CreateDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domain, err := h.service.Create(c.Request.Context(), domains.CreateDomainInput{
+		Host:           req.Host,
+		RedirectStatus: req.RedirectStatus,
+		FallbackURL:    req.FallbackURL,
+	})
+	if err != nil {
+		if errors.Is(err, domains.ErrHostTaken) {
+			c.JSON(http.StatusConflict, errorBody("host already taken"))
+			return
+		}
+		if errors.Is(err, domains.ErrInvalidHost) {
+			c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, newDomainResponse(domain))
+}
+
+// Private: Update
+func (h *Handler) Update(c *gin.Context) {
+	var uri ByHost
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	var req UpdateDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domain, err := h.service.Update(c.Request.Context(), uri.Host, domains.UpdateDomainInput{
+		RedirectStatus: req.RedirectStatus,
+		FallbackURL:    req.FallbackURL,
+	})
+	if err != nil {
+		if errors.Is(err, domains.ErrDomainNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("domain not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, newDomainResponse(domain))
+}
+
+// Private: Delete (only domains without links)
+func (h *Handler) Delete(c *gin.Context) {
+	var uri ByHost
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	err := h.service.Delete(c.Request.Context(), uri.Host)
+	if err != nil {
+		if errors.Is(err, domains.ErrDomainNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("domain not found"))
+			return
+		}
+		if errors.Is(err, domains.ErrDomainInUse) {
+			c.JSON(http.StatusConflict, errorBody(err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func errorBody(msg string) gin.H {
+	return gin.H{"error": msg}
+}
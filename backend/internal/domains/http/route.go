@@ -0,0 +1,16 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRoutes(r *gin.Engine, h *Handler) {
+	domains := r.Group("/domains")
+	{
+		domains.GET("", h.List)
+		domains.POST("", h.Create)
+		domains.GET("/:host", h.Get)
+		domains.PATCH("/:host", h.Update)
+		domains.DELETE("/:host", h.Delete)
+	}
+}
@@ -0,0 +1,197 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrDomainNotFound = errors.New("domain not found")
+	ErrDomainInUse    = errors.New("domain still has links")
+)
+
+type Repository interface {
+	// Create returns ErrHostTaken if the host is already added.
+	Create(ctx context.Context, domain *Domain) error
+	GetByHost(ctx context.Context, host string) (*Domain, error)
+	List(ctx context.Context) ([]*Domain, error)
+	Update(ctx context.Context, domain *Domain) error
+	// Delete returns ErrDomainInUse while links are served on the domain.
+	Delete(ctx context.Context, host string) error
+}
+
+var domainColumns = []string{"id", "host", "redirect_status", "fallback_url", "created_at", "updated_at"}
+
+const (
+	// foreignKeyViolation is the Postgres error code for a row still being
+	// referenced
+	foreignKeyViolation = "23503"
+	// uniqueViolation is the Postgres error code for a duplicate key, like a
+	// host already added
+	uniqueViolation = "23505"
+)
+
+type repository struct {
+	db *pgxpool.Pool
+	sb sq.StatementBuilderType
+}
+
+func NewRepository(db *pgxpool.Pool) Repository {
+	return &repository{
+		db: db,
+		sb: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+func (r *repository) Create(ctx context.Context, domain *Domain) error {
+	query := r.sb.Insert("domains").
+		Columns("host", "redirect_status", "fallback_url").
+		Values(domain.Host, domain.RedirectStatus, nullIfEmpty(domain.FallbackURL)).
+		Suffix("RETURNING id, created_at, updated_at")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	err = r.db.QueryRow(ctx, sqlStr, args...).Scan(
+		&domain.ID,
+		&domain.CreatedAt,
+		&domain.UpdatedAt,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrHostTaken
+	}
+	return err
+}
+
+func (r *repository) GetByHost(ctx context.Context, host string) (*Domain, error) {
+	query := r.sb.Select(domainColumns...).
+		From("domains").
+		Where(sq.Eq{"host": host})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := scanDomain(r.db.QueryRow(ctx, sqlStr, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDomainNotFound
+		}
+		return nil, err
+	}
+
+	return domain, nil
+}
+
+func (r *repository) List(ctx context.Context) ([]*Domain, error) {
+	query := r.sb.Select(domainColumns...).
+		From("domains").
+		OrderBy("host ASC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []*Domain{}
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, rows.Err()
+}
+
+func (r *repository) Update(ctx context.Context, domain *Domain) error {
+	query := r.sb.Update("domains").
+		Set("redirect_status", domain.RedirectStatus).
+		Set("fallback_url", nullIfEmpty(domain.FallbackURL)).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"id": domain.ID}).
+		Suffix("RETURNING updated_at")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	err = r.db.QueryRow(ctx, sqlStr, args...).Scan(&domain.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDomainNotFound
+	}
+	return err
+}
+
+func (r *repository) Delete(ctx context.Context, host string) error {
+	query := r.sb.Delete("domains").
+		Where(sq.Eq{"host": host})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return ErrDomainInUse
+		}
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrDomainNotFound
+	}
+
+	return nil
+}
+
+func scanDomain(row pgx.Row) (*Domain, error) {
+	var domain Domain
+	var fallbackURL *string
+
+	err := row.Scan(
+		&domain.ID,
+		&domain.Host,
+		&domain.RedirectStatus,
+		&fallbackURL,
+		&domain.CreatedAt,
+		&domain.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if fallbackURL != nil {
+		domain.FallbackURL = *fallbackURL
+	}
+
+	return &domain, nil
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
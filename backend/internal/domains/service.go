@@ -0,0 +1,203 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// NotifyChannel is the Postgres channel on which the schema's triggers
+// announce changed domains.
+const NotifyChannel = "domain_changes"
+
+var ErrHostTaken = errors.New("host already taken")
+
+type Service interface {
+	Create(ctx context.Context, input CreateDomainInput) (*Domain, error)
+	Get(ctx context.Context, host string) (*Domain, error)
+	List(ctx context.Context) ([]*Domain, error)
+	Update(ctx context.Context, host string, input UpdateDomainInput) (*Domain, error)
+	Delete(ctx context.Context, host string) error
+
+	// Lookup returns the domain serving a request's Host header, or nil
+	// for the primary domain and unknown hosts. It is served from memory;
+	// the domain is shared and must not be modified.
+	Lookup(host string) *Domain
+	// ByID returns a shared domain from memory, or nil if there is none.
+	ByID(id int64) *Domain
+	// Reload refreshes the domains kept in memory. Changes made through
+	// the service take effect right away; changes made by other instances
+	// must be followed by a Reload (see NotifyChannel).
+	Reload(ctx context.Context) error
+}
+
+// registry is an immutable snapshot of all domains.
+type registry struct {
+	byHost map[string]*Domain
+	byID   map[int64]*Domain
+}
+
+type service struct {
+	repo        Repository
+	primaryHost string
+	domains     atomic.Pointer[registry]
+}
+
+// NewService returns a Service with no domains in memory until Reload is
+// called. primaryHost is the redirect domain links without a domain are
+// served on; it cannot be added as a domain.
+func NewService(repo Repository, primaryHost string) Service {
+	s := &service{
+		repo:        repo,
+		primaryHost: strings.ToLower(primaryHost),
+	}
+	s.domains.Store(newRegistry(nil))
+	return s
+}
+
+func (s *service) Create(ctx context.Context, input CreateDomainInput) (*Domain, error) {
+	host, err := NormalizeHost(input.Host)
+	if err != nil {
+		return nil, err
+	}
+	if host == s.primaryHost {
+		return nil, ErrHostTaken
+	}
+
+	domain := &Domain{
+		Host:           host,
+		RedirectStatus: input.RedirectStatus,
+		FallbackURL:    input.FallbackURL,
+	}
+	if err := s.repo.Create(ctx, domain); err != nil {
+		return nil, err
+	}
+
+	s.remember(domain)
+	return domain, nil
+}
+
+func (s *service) Get(ctx context.Context, host string) (*Domain, error) {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return nil, ErrDomainNotFound
+	}
+	return s.repo.GetByHost(ctx, host)
+}
+
+func (s *service) List(ctx context.Context) ([]*Domain, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *service) Update(ctx context.Context, host string, input UpdateDomainInput) (*Domain, error) {
+	domain, err := s.Get(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.RedirectStatus.Set {
+		domain.RedirectStatus = input.RedirectStatus.Value
+	}
+	if input.FallbackURL.Set {
+		domain.FallbackURL = ""
+		if input.FallbackURL.Value != nil {
+			domain.FallbackURL = *input.FallbackURL.Value
+		}
+	}
+
+	if err := s.repo.Update(ctx, domain); err != nil {
+		return nil, err
+	}
+
+	s.remember(domain)
+	return domain, nil
+}
+
+func (s *service) Delete(ctx context.Context, host string) error {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return ErrDomainNotFound
+	}
+
+	if err := s.repo.Delete(ctx, host); err != nil {
+		return err
+	}
+
+	s.forget(host)
+	return nil
+}
+
+func (s *service) Lookup(host string) *Domain {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	domains := s.domains.Load()
+	if domain, ok := domains.byHost[host]; ok {
+		return domain
+	}
+
+	// Domains registered without a port also serve non-default ports
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		return domains.byHost[strings.TrimSuffix(host[:i], ".")]
+	}
+	return nil
+}
+
+func (s *service) ByID(id int64) *Domain {
+	return s.domains.Load().byID[id]
+}
+
+func (s *service) Reload(ctx context.Context) error {
+	list, err := s.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	s.domains.Store(newRegistry(list))
+	return nil
+}
+
+// remember adds or replaces a domain in memory.
+func (s *service) remember(domain *Domain) {
+	copied := *domain
+
+	for {
+		old := s.domains.Load()
+		list := make([]*Domain, 0, len(old.byID)+1)
+		for _, d := range old.byID {
+			if d.ID != copied.ID {
+				list = append(list, d)
+			}
+		}
+		if s.domains.CompareAndSwap(old, newRegistry(append(list, &copied))) {
+			return
+		}
+	}
+}
+
+// forget removes a domain from memory.
+func (s *service) forget(host string) {
+	for {
+		old := s.domains.Load()
+		list := make([]*Domain, 0, len(old.byID))
+		for _, d := range old.byID {
+			if d.Host != host {
+				list = append(list, d)
+			}
+		}
+		if s.domains.CompareAndSwap(old, newRegistry(list)) {
+			return
+		}
+	}
+}
+
+func newRegistry(list []*Domain) *registry {
+	r := &registry{
+		byHost: make(map[string]*Domain, len(list)),
+		byID:   make(map[int64]*Domain, len(list)),
+	}
+	for _, domain := range list {
+		r.byHost[domain.Host] = domain
+		r.byID[domain.ID] = domain
+	}
+	return r
+}
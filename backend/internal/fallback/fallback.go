@@ -0,0 +1,110 @@
+// Package fallback serves what visitors see instead of a redirect when a
+// link cannot be followed: either a redirect to a configured URL, or an
+// HTML page rendered from a template.
+package fallback
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Kind is the reason a link cannot be followed.
+type Kind string
+
+const (
+	// NotFound: the slug does not exist
+	NotFound Kind = "not_found"
+	// Inactive: the link was deactivated or is not active yet
+	Inactive Kind = "inactive"
+	// Expired: the link is past its deadline or out of clicks
+	Expired Kind = "expired"
+	// Blocked: the link's destination is on the blocklist
+	Blocked Kind = "blocked"
+)
+
+// Kinds lists every Kind; each has a template named after it.
+var Kinds = []Kind{NotFound, Inactive, Expired, Blocked}
+
+//go:embed templates/*.html
+var defaultFS embed.FS
+
+// Options configures the fallbacks. The zero value renders the built-in
+// pages for every case.
+type Options struct {
+	// Dir may hold not_found.html, inactive.html, expired.html and
+	// blocked.html, which replace the built-in pages. Missing files keep the built-in ones.
+	Dir string
+	// URLs sends visitors to a URL instead of rendering a page
+	URLs map[Kind]string
+}
+
+// Page is the data templates are rendered with.
+type Page struct {
+	Slug string
+	// Status is the HTTP status the page is served with
+	Status int
+}
+
+// Pages holds the fallback configuration and the parsed templates, which
+// can be reloaded in place.
+type Pages struct {
+	dir       string
+	urls      map[Kind]string
+	templates atomic.Pointer[map[Kind]*template.Template]
+}
+
+func New(opts Options) (*Pages, error) {
+	p := &Pages{dir: opts.Dir, urls: opts.URLs}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload re-reads the templates from disk. The previous templates stay in
+// use if any of them fails to parse.
+func (p *Pages) Reload() error {
+	templates := make(map[Kind]*template.Template, len(Kinds))
+
+	for _, kind := range Kinds {
+		name := string(kind) + ".html"
+
+		tmpl, err := template.ParseFS(defaultFS, "templates/"+name)
+		if err != nil {
+			return err
+		}
+
+		if p.dir != "" {
+			path := filepath.Join(p.dir, name)
+			custom, err := template.ParseFiles(path)
+			switch {
+			case err == nil:
+				tmpl = custom
+			case !errors.Is(err, fs.ErrNotExist):
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+		}
+
+		templates[kind] = tmpl
+	}
+
+	p.templates.Store(&templates)
+	return nil
+}
+
+// URL returns the URL visitors are redirected to for kind, or an empty
+// string if a page is rendered instead.
+func (p *Pages) URL(kind Kind) string {
+	return p.urls[kind]
+}
+
+// Render writes the page for kind.
+func (p *Pages) Render(w io.Writer, kind Kind, page Page) error {
+	return (*p.templates.Load())[kind].Execute(w, page)
+}
@@ -0,0 +1,107 @@
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// Resolver maps a client IP address to its country.
+type Resolver interface {
+	// Country returns the upper-case ISO 3166-1 alpha-2 code for addr, or
+	// an empty string when it is unknown.
+	Country(addr netip.Addr) string
+}
+
+// Database is a Resolver backed by a MaxMind-format .mmdb file (GeoLite2
+// Country/City, DB-IP Lite, ...) that can be reloaded in place after the
+// file was updated.
+type Database interface {
+	Resolver
+	// Reload reopens the file. The previous data stays in use if it fails.
+	Reload() error
+	Close() error
+}
+
+type database struct {
+	path string
+
+	mu     sync.RWMutex
+	reader *maxminddb.Reader
+}
+
+// countryRecord is the subset of the GeoIP2 country schema we read.
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func Open(path string) (Database, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+
+	return &database{path: path, reader: reader}, nil
+}
+
+func (d *database) Country(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.reader == nil {
+		return ""
+	}
+
+	var record countryRecord
+	if err := d.reader.Lookup(addr.Unmap()).Decode(&record); err != nil {
+		return ""
+	}
+
+	code := record.Country.ISOCode
+	if code == "" {
+		code = record.RegisteredCountry.ISOCode
+	}
+	return strings.ToUpper(code)
+}
+
+func (d *database) Reload() error {
+	reader, err := maxminddb.Open(d.path)
+	if err != nil {
+		return fmt.Errorf("failed to reload geoip database: %w", err)
+	}
+
+	d.mu.Lock()
+	old := d.reader
+	d.reader = reader
+	d.mu.Unlock()
+
+	// No lookup can still be using the old reader once the lock is released
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+func (d *database) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.reader == nil {
+		return nil
+	}
+	err := d.reader.Close()
+	d.reader = nil
+	return err
+}
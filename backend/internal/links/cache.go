@@ -0,0 +1,152 @@
+package links
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/lru"
+)
+
+// NotifyChannel is the Postgres channel on which the schema's triggers
+// announce the cache key of every changed link.
+const NotifyChannel = "link_changes"
+
+// CacheOptions configures a ResolveCache.
+type CacheOptions struct {
+	// Size is the maximum number of slugs kept
+	Size int
+	// TTL bounds how long a link is served from memory
+	TTL time.Duration
+	// NegativeTTL bounds how long an unknown slug is remembered
+	NegativeTTL time.Duration
+}
+
+// ResolveCache keeps the links loaded by Service.Resolve in memory, so
+// redirects do not need a database round-trip. Unknown slugs are cached as
+// well. Entries are invalidated by key when links change, which must be
+// reported through Invalidate (see NotifyChannel).
+//
+// A link's key is its slug, prefixed with its domain ID and a slash for
+// links not on the primary domain.
+//
+// The cache starts inactive and passes every lookup through until it is
+// activated, i.e. once invalidations are known to be delivered.
+type ResolveCache struct {
+	entries     *lru.Cache[string, *Link] // nil values are unknown slugs
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	active atomic.Bool
+
+	// epoch counts invalidations. A load that raced with one is not
+	// stored, since it may have read the data from before the change.
+	mu            sync.Mutex
+	epoch         uint64
+	invalidations uint64
+}
+
+// CacheStats are the counters of a ResolveCache.
+type CacheStats struct {
+	lru.Stats
+	HitRatio      float64 `json:"hit_ratio"`
+	Invalidations uint64  `json:"invalidations"`
+	Active        bool    `json:"active"`
+}
+
+func NewResolveCache(opts CacheOptions) *ResolveCache {
+	return &ResolveCache{
+		entries:     lru.New[string, *Link](opts.Size),
+		ttl:         opts.TTL,
+		negativeTTL: opts.NegativeTTL,
+	}
+}
+
+// SetActive turns the cache on or off. Either way it starts empty, as
+// invalidations may have been missed while it was off.
+func (c *ResolveCache) SetActive(active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active.Store(active)
+	c.epoch++
+	c.entries.Purge()
+}
+
+// Invalidate drops the cached state of a link by its key.
+func (c *ResolveCache) Invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	c.invalidations++
+	c.entries.Delete(key)
+}
+
+func (c *ResolveCache) Stats() CacheStats {
+	c.mu.Lock()
+	invalidations := c.invalidations
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Stats:         c.entries.Stats(),
+		Invalidations: invalidations,
+		Active:        c.active.Load(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// get returns the link for key from the cache, or from load on a miss.
+// Callers get their own copy of the link.
+func (c *ResolveCache) get(key string, load func() (*Link, error)) (*Link, error) {
+	if c == nil || !c.active.Load() {
+		return load()
+	}
+
+	if link, ok := c.entries.Get(key); ok {
+		if link == nil {
+			return nil, ErrLinkNotFound
+		}
+		copied := *link
+		return &copied, nil
+	}
+
+	c.mu.Lock()
+	epoch := c.epoch
+	c.mu.Unlock()
+
+	link, err := load()
+	if err != nil && !errors.Is(err, ErrLinkNotFound) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.epoch == epoch {
+		if link == nil {
+			c.entries.Set(key, nil, c.negativeTTL)
+		} else {
+			copied := *link
+			c.entries.Set(key, &copied, c.ttl)
+		}
+	}
+	c.mu.Unlock()
+
+	return link, err
+}
+
+// cacheKey matches the keys announced by the schema's link_cache_key.
+func cacheKey(domainID int64, slug string) string {
+	if domainID == 0 {
+		return slug
+	}
+	return strconv.FormatInt(domainID, 10) + "/" + slug
+}
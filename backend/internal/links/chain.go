@@ -0,0 +1,166 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/nekogravitycat/linkhub/internal/domains"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+)
+
+// DomainLookup finds the short domain served on a host; domains.Service is
+// the usual one.
+type DomainLookup interface {
+	// Lookup returns the domain for host, or nil for the primary domain
+	// and unknown hosts
+	Lookup(host string) *domains.Domain
+}
+
+// linkKey identifies a link by its domain and slug.
+type linkKey struct {
+	domainID int64
+	slug     string
+}
+
+// shortLink reports whether u is on one of the short domains the service's
+// links are served on, and the link it names. The slug is empty for URLs
+// on a short domain that name no link, like the bare domain.
+func (s *service) shortLink(u *url.URL) (linkKey, bool) {
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return linkKey{}, false
+	}
+	name, err := urlpolicy.NormalizeHost(u.Hostname())
+	if err != nil {
+		return linkKey{}, false
+	}
+
+	// Domains are written without the default port, like Host headers
+	host, port := name, u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(name, port)
+	}
+
+	slug, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if name == s.redirectHost && (s.redirectPort == "" || port == s.redirectPort) {
+		return linkKey{slug: slug}, true
+	}
+	if s.domains != nil {
+		if domain := s.domains.Lookup(host); domain != nil {
+			return linkKey{domainID: domain.ID, slug: slug}, true
+		}
+	}
+	return linkKey{}, false
+}
+
+// splitDomain returns the normalized host name and the port of a domain
+// like "go.example.com" or "localhost:8003". A domain without a port
+// serves every port of its host, as domains.Service.Lookup does.
+func splitDomain(domain string) (name, port string) {
+	u := &url.URL{Host: domain}
+	name, err := urlpolicy.NormalizeHost(u.Hostname())
+	if err != nil {
+		name = strings.ToLower(u.Hostname())
+	}
+	return name, u.Port()
+}
+
+// checkChain checks a destination of the link from that is the short link
+// to. Unless chaining is enabled, short links are rejected as loops.
+// Otherwise the chain of short links starting at to is followed, and
+// rejected if it leads back to from or is longer than maxChainDepth.
+// Links that do not exist yet end the chain; creating them is checked in
+// turn.
+func (s *service) checkChain(ctx context.Context, from, to linkKey) error {
+	if s.maxChainDepth == 0 || to.slug == "" {
+		return ErrRedirectLoop
+	}
+
+	// The deepest each link has been reached at; reaching it again less
+	// deep cannot make the chain longer
+	reached := make(map[linkKey]int)
+
+	var follow func(key linkKey, depth int) error
+	follow = func(key linkKey, depth int) error {
+		if key == from {
+			return ErrRedirectCycle
+		}
+		if depth > s.maxChainDepth {
+			return ErrChainTooLong
+		}
+		if d, ok := reached[key]; ok && d >= depth {
+			return nil
+		}
+		reached[key] = depth
+
+		link, err := s.repo.GetBySlug(ctx, key.domainID, key.slug)
+		if errors.Is(err, ErrLinkNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		link.Variants, err = s.repo.ListVariants(ctx, link.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, destination := range link.destinations() {
+			u, err := url.Parse(destination)
+			if err != nil {
+				continue
+			}
+			if next, ok := s.shortLink(u); ok && next.slug != "" {
+				if err := follow(next, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return follow(to, 1)
+}
+
+// checkChains checks the destinations of link that are short links against
+// the link's own key. Create checks them before a generated slug is picked,
+// when no chain can lead back to the link yet.
+func (s *service) checkChains(ctx context.Context, link *Link) error {
+	from := linkKey{link.DomainID, link.Slug}
+	for _, destination := range link.destinations() {
+		u, err := url.Parse(destination)
+		if err != nil {
+			continue
+		}
+		if to, ok := s.shortLink(u); ok {
+			if err := s.checkChain(ctx, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// destinations returns every URL the link may redirect a browser to. The
+// app URLs of its deep link are left out, since they are never short links.
+func (l *Link) destinations() []string {
+	urls := []string{l.URL}
+	for _, rule := range l.CountryRules {
+		urls = append(urls, rule.URL)
+	}
+	for _, rule := range l.DeviceRules {
+		urls = append(urls, rule.URL)
+	}
+	for _, rule := range l.LanguageRules {
+		urls = append(urls, rule.URL)
+	}
+	for _, variant := range l.Variants {
+		urls = append(urls, variant.URL)
+	}
+	return urls
+}
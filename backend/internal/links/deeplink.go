@@ -0,0 +1,134 @@
+package links
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/nekogravitycat/linkhub/internal/useragent"
+)
+
+// maxDeepLinkURLLength bounds every URL of a deep link.
+const maxDeepLinkURLLength = 2048
+
+var schemeRegex = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// Schemes that would run code in, or read from, the visitor's browser
+// instead of opening an app.
+var unsafeSchemes = map[string]bool{
+	"javascript": true,
+	"vbscript":   true,
+	"data":       true,
+	"file":       true,
+	"blob":       true,
+	"about":      true,
+}
+
+// DeepLink opens the link in a mobile app. Visitors on iOS and Android get a
+// page that tries the app URL and, if the app does not open, falls back to
+// the store, or to the link's web destination without a store URL. Other
+// visitors are redirected as usual.
+type DeepLink struct {
+	// IOSURL is a custom scheme (myapp://item/42) or universal link URL
+	IOSURL      string `json:"ios_url,omitempty"`
+	IOSStoreURL string `json:"ios_store_url,omitempty"`
+	// AndroidURL is a custom scheme, intent:// or App Link URL
+	AndroidURL      string `json:"android_url,omitempty"`
+	AndroidStoreURL string `json:"android_store_url,omitempty"`
+}
+
+// ForOS returns the app and store URLs for visitors on os, one of
+// useragent.OSes. The app URL is empty when the link has none for os.
+func (d *DeepLink) ForOS(os string) (app, store string) {
+	if d == nil {
+		return "", ""
+	}
+	switch os {
+	case useragent.OSiOS:
+		return d.IOSURL, d.IOSStoreURL
+	case useragent.OSAndroid:
+		return d.AndroidURL, d.AndroidStoreURL
+	}
+	return "", ""
+}
+
+// urls returns every URL of the deep link, for the checks applied to all
+// destinations.
+func (d *DeepLink) urls() []string {
+	var urls []string
+	for _, u := range []string{d.IOSURL, d.IOSStoreURL, d.AndroidURL, d.AndroidStoreURL} {
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// normalizeDeepLink trims the URLs and validates them: app URLs may use any
+// scheme but those that run in the browser, store URLs must be http(s). A
+// deep link without any URL is removed.
+func normalizeDeepLink(link *DeepLink) (*DeepLink, error) {
+	if link == nil {
+		return nil, nil
+	}
+
+	normalized := DeepLink{
+		IOSURL:          strings.TrimSpace(link.IOSURL),
+		IOSStoreURL:     strings.TrimSpace(link.IOSStoreURL),
+		AndroidURL:      strings.TrimSpace(link.AndroidURL),
+		AndroidStoreURL: strings.TrimSpace(link.AndroidStoreURL),
+	}
+	if len(normalized.urls()) == 0 {
+		return nil, nil
+	}
+	if normalized.IOSURL == "" && normalized.AndroidURL == "" {
+		return nil, fmt.Errorf("%w: ios_url or android_url is required", ErrInvalidDeepLink)
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+		store bool
+	}{
+		{"ios_url", normalized.IOSURL, false},
+		{"ios_store_url", normalized.IOSStoreURL, true},
+		{"android_url", normalized.AndroidURL, false},
+		{"android_store_url", normalized.AndroidStoreURL, true},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if err := validateDeepLinkURL(field.value, field.store); err != nil {
+			return nil, fmt.Errorf("%w: %s %v", ErrInvalidDeepLink, field.name, err)
+		}
+	}
+
+	return &normalized, nil
+}
+
+func validateDeepLinkURL(raw string, store bool) error {
+	if len(raw) > maxDeepLinkURLLength {
+		return fmt.Errorf("is too long (max %d chars)", maxDeepLinkURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return errors.New("is not a valid URL")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !schemeRegex.MatchString(scheme) {
+		return errors.New("must be an absolute URL")
+	}
+	if store || scheme == "http" || scheme == "https" {
+		if (scheme != "http" && scheme != "https") || u.Host == "" {
+			return errors.New("must be an http or https URL")
+		}
+		return nil
+	}
+	if unsafeSchemes[scheme] {
+		return fmt.Errorf("cannot use the %s scheme", scheme)
+	}
+	return nil
+}
@@ -1,23 +1,199 @@
 package links
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/nekogravitycat/linkhub/internal/pkg/request"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Link struct {
-	ID        int64     `json:"id"`
-	Slug      string    `json:"slug"`
-	URL       string    `json:"url"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID int64 `json:"id"`
+	// DomainID is the short domain the link is served on; 0 is the primary
+	// redirect domain
+	DomainID    int64      `json:"domain_id"`
+	Slug        string     `json:"slug"`
+	URL         string     `json:"url"`
+	IsActive    bool       `json:"is_active"`
+	ActiveFrom  *time.Time `json:"active_from"`
+	ActiveUntil *time.Time `json:"active_until"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	MaxClicks   *int64     `json:"max_clicks"`
+	ClickCount  int64      `json:"click_count"`
+	// RedirectStatus is the HTTP status used for the redirect; nil means
+	// the server default
+	RedirectStatus *int `json:"redirect_status"`
+	// QueryMode controls how the incoming query string is carried over
+	QueryMode QueryMode `json:"query_mode"`
+	// ForwardPath makes this a prefix link: any path after the slug is
+	// appended to the destination
+	ForwardPath bool `json:"forward_path"`
+	// CountryRules override the destination for visitors from specific
+	// countries
+	CountryRules []CountryRule `json:"country_rules"`
+	// DeviceRules override the destination by OS, device class or browser
+	DeviceRules []DeviceRule `json:"device_rules"`
+	// LanguageRules override the destination by the visitor's
+	// Accept-Language preferences
+	LanguageRules []LanguageRule `json:"language_rules"`
+	// DeepLink opens the link in a mobile app when installed; nil sends
+	// every visitor to the web
+	DeepLink *DeepLink `json:"deep_link"`
+	// OG* override the card chat apps and social networks show for the
+	// link; empty fields are left out
+	OGTitle       string `json:"og_title"`
+	OGDescription string `json:"og_description"`
+	OGImageURL    string `json:"og_image_url"`
+	// StickyVariants keeps returning visitors on the same variant
+	StickyVariants bool `json:"sticky_variants"`
+	// Variants split the traffic among several destinations. They are only
+	// loaded by Service.Resolve.
+	Variants []Variant `json:"variants,omitempty"`
+	// PasswordHash is the bcrypt hash of the unlock password, empty when the
+	// link is not protected. It must never leave the server.
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ValidRedirectStatus reports whether status is a supported redirect code.
+func ValidRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// IsPermanentRedirect reports whether status tells clients to cache the
+// redirect indefinitely.
+func IsPermanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// HasCard reports whether the link overrides its card, in which case link
+// previews are served the card instead of the redirect.
+func (l *Link) HasCard() bool {
+	return l.OGTitle != "" || l.OGDescription != "" || l.OGImageURL != ""
+}
+
+func (l *Link) HasPassword() bool {
+	return l.PasswordHash != ""
+}
+
+// CheckPassword reports whether password unlocks the link.
+func (l *Link) CheckPassword(password string) bool {
+	if !l.HasPassword() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) == nil
+}
+
+// Status is the effective state of a link, combining the manual is_active
+// switch with its activation window and usage limits.
+type Status string
+
+const (
+	StatusDisabled  Status = "disabled"
+	StatusScheduled Status = "scheduled"
+	StatusLive      Status = "live"
+	StatusEnded     Status = "ended"
+)
+
+// Status computes the effective status of the link at the given time.
+func (l *Link) Status(now time.Time) Status {
+	switch err := l.Availability(now); err {
+	case nil:
+		return StatusLive
+	case ErrLinkInactive:
+		return StatusDisabled
+	case ErrLinkNotStarted:
+		return StatusScheduled
+	default:
+		return StatusEnded
+	}
+}
+
+// Availability reports why the link cannot be followed at the given time,
+// or nil if it can. The click limit is only checked against the last known
+// count; the authoritative check happens when the click is consumed.
+func (l *Link) Availability(now time.Time) error {
+	if !l.IsActive {
+		return ErrLinkInactive
+	}
+	if l.ActiveFrom != nil && now.Before(*l.ActiveFrom) {
+		return ErrLinkNotStarted
+	}
+	if l.ActiveUntil != nil && !now.Before(*l.ActiveUntil) {
+		return ErrLinkExpired
+	}
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return ErrLinkExpired
+	}
+	if l.MaxClicks != nil && l.ClickCount >= *l.MaxClicks {
+		return ErrLinkExhausted
+	}
+	return nil
+}
+
+type CreateLinkInput struct {
+	// DomainID is the domain to create the link on; 0 is the primary domain
+	DomainID    int64
+	Slug        string
+	URL         string
+	ActiveFrom  *time.Time
+	ActiveUntil *time.Time
+	ExpiresAt   *time.Time
+	MaxClicks   *int64
+	// Password is the plain-text unlock password; empty means no password
+	Password       string
+	RedirectStatus *int
+	QueryMode      QueryMode
+	ForwardPath    bool
+	CountryRules   []CountryRule
+	DeviceRules    []DeviceRule
+	DeepLink       *DeepLink
+	OGTitle        string
+	OGDescription  string
+	OGImageURL     string
+	StickyVariants bool
+}
+
+type UpdateLinkInput struct {
+	URL         *string
+	IsActive    *bool
+	ActiveFrom  request.Nullable[time.Time]
+	ActiveUntil request.Nullable[time.Time]
+	ExpiresAt   request.Nullable[time.Time]
+	MaxClicks   request.Nullable[int64]
+	// Password replaces the unlock password; an explicit null removes it
+	Password       request.Nullable[string]
+	RedirectStatus request.Nullable[int]
+	QueryMode      *QueryMode
+	ForwardPath    *bool
+	// CountryRules replaces all country overrides; an empty list removes them
+	CountryRules *[]CountryRule
+	// DeviceRules replaces all device rules; an empty list removes them
+	DeviceRules *[]DeviceRule
+	// DeepLink replaces the deep link; an explicit null removes it
+	DeepLink request.Nullable[DeepLink]
+	// OG* replace the card overrides; an explicit null or "" removes them
+	OGTitle        request.Nullable[string]
+	OGDescription  request.Nullable[string]
+	OGImageURL     request.Nullable[string]
+	StickyVariants *bool
 }
 
 type ListOptions struct {
 	request.ListParams
+	// DomainID only lists the links of one domain (0 is the primary
+	// domain); nil lists all
+	DomainID *int64
 	SortBy   string
 	Keyword  string
 	IsActive *bool
+	// Expired filters links past their deadline or out of clicks
+	Expired *bool
+	Status  Status
 }
@@ -0,0 +1,116 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrHitCounterClosed = errors.New("hit counter is closed")
+
+// HitCounter adds up the hits of variants in memory and writes them in one
+// statement per interval from a background goroutine, so redirects of split
+// links never wait on a row lock. Hits that fail to be written are kept for
+// the next flush.
+type HitCounter struct {
+	repo     Repository
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[int64]int64
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewHitCounter starts a HitCounter flushing every interval; a non-positive
+// interval means one second.
+func NewHitCounter(repo Repository, interval time.Duration) *HitCounter {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	h := &HitCounter{
+		repo:     repo,
+		interval: interval,
+		pending:  make(map[int64]int64),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go h.run()
+
+	return h
+}
+
+// Add counts a hit of the variant without blocking.
+func (h *HitCounter) Add(variantID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pending[variantID]++
+}
+
+// Close stops the background flushes and writes the hits still pending.
+func (h *HitCounter) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return ErrHitCounterClosed
+	}
+	h.closed = true
+	h.mu.Unlock()
+
+	close(h.stop)
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return h.flush(ctx)
+}
+
+func (h *HitCounter) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+			if err := h.flush(ctx); err != nil {
+				log.Printf("failed to write variant hits: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// flush writes the pending hits, putting them back if that fails.
+func (h *HitCounter) flush(ctx context.Context) error {
+	h.mu.Lock()
+	hits := h.pending
+	h.pending = make(map[int64]int64)
+	h.mu.Unlock()
+
+	if len(hits) == 0 {
+		return nil
+	}
+
+	err := h.repo.AddVariantHits(ctx, hits)
+	if err != nil {
+		h.mu.Lock()
+		for id, n := range hits {
+			h.pending[id] += n
+		}
+		h.mu.Unlock()
+	}
+	return err
+}
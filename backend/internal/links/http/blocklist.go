@@ -0,0 +1,43 @@
+package http
+
+import (
+	"log"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+)
+
+// blocked reports whether the host of target is on the blocklist. If it is,
+// the hit is logged for review and the visitor gets the warning page. Links
+// are checked when saved as well, so this catches destinations listed later.
+func (h *Handler) blocked(c *gin.Context, link *links.Link, target string) bool {
+	entry, blocked := h.blocklisted(target)
+	if !blocked {
+		return false
+	}
+
+	log.Printf("blocked redirect of %s/%s to %s (%s)", h.host(link.DomainID), link.Slug, target, entry)
+	h.abortBlocked(c)
+	return true
+}
+
+// blocklisted returns the blocklist entry matching the host of target, if
+// any.
+func (h *Handler) blocklisted(target string) (entry string, blocked bool) {
+	if h.blocklist == nil {
+		return "", false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	host, err := urlpolicy.NormalizeHost(u.Hostname())
+	if err != nil {
+		return "", false
+	}
+
+	return h.blocklist.Match(host)
+}
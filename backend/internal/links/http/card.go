@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/botdetect"
+	"github.com/nekogravitycat/linkhub/internal/links"
+)
+
+type cardPage struct {
+	Title       string
+	Description string
+	ImageURL    string
+	// URL is the short URL, so shares keep pointing at the link
+	URL      string
+	SiteName string
+}
+
+// serveCard answers chat apps and social networks unfurling a link that
+// overrides its card with the card's meta tags, instead of redirecting them
+// to the destination's. It reports whether it answered the request, which
+// it also does for blocked destinations. The page holds nothing
+// the owner did not write for sharing, so protected links get it too.
+func (h *Handler) serveCard(c *gin.Context, link *links.Link) bool {
+	if !link.HasCard() || !botdetect.IsLinkPreview(c.Request.UserAgent()) {
+		return false
+	}
+	if h.blocked(c, link, link.URL) {
+		return true
+	}
+
+	h.recordClick(c, link, true)
+
+	c.Writer.Header().Add("Vary", "User-Agent")
+	renderPage(c, http.StatusOK, "card.html", cardPage{
+		Title:       link.OGTitle,
+		Description: link.OGDescription,
+		ImageURL:    link.OGImageURL,
+		URL:         h.shortURL(link),
+		SiteName:    h.host(link.DomainID),
+	})
+	return true
+}
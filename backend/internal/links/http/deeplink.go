@@ -0,0 +1,77 @@
+package http
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/useragent"
+)
+
+// How long the deep link page waits for the app to open before falling back
+const deepLinkTimeout = 1500
+
+type deepLinkPage struct {
+	// AppURL may use a custom scheme, which html/template would otherwise
+	// filter out; links.DeepLink only accepts schemes that open apps.
+	AppURL      template.URL
+	FallbackURL string
+	// Store is set when the fallback is the app store rather than the web
+	Store         bool
+	TimeoutMillis int
+}
+
+// deepLinkPageFor returns the page opening the link's app for the visitor,
+// and false if they should be redirected to target as usual: the link has
+// no app for their platform, or the visitor is a bot or not a browser
+// navigation.
+func deepLinkPageFor(c *gin.Context, link *links.Link, target string, bot bool) (deepLinkPage, bool) {
+	if link.DeepLink == nil || bot || c.Request.Method != http.MethodGet {
+		return deepLinkPage{}, false
+	}
+
+	client := useragent.Parse(c.Request.UserAgent(), c.Request.Header)
+	app, store := link.DeepLink.ForOS(client.OS)
+	if app == "" {
+		return deepLinkPage{}, false
+	}
+
+	page := deepLinkPage{
+		AppURL:        template.URL(app),
+		FallbackURL:   target,
+		TimeoutMillis: deepLinkTimeout,
+	}
+	if store != "" {
+		page.FallbackURL = store
+		page.Store = true
+	}
+	return page, true
+}
+
+// deepLinkBlocked is blocked for the URLs the deep link page opens besides
+// the link's destination: the app store's, and the app URL when it is a web
+// URL, as universal links and app links are.
+func (h *Handler) deepLinkBlocked(c *gin.Context, link *links.Link, page deepLinkPage) bool {
+	if page.Store && h.blocked(c, link, page.FallbackURL) {
+		return true
+	}
+	app := string(page.AppURL)
+	if u, err := url.Parse(app); err == nil && (strings.EqualFold(u.Scheme, "http") || strings.EqualFold(u.Scheme, "https")) {
+		return h.blocked(c, link, app)
+	}
+	return false
+}
+
+// Public: WellKnown serves the app association files of the redirect domain.
+func (h *Handler) WellKnown(c *gin.Context) {
+	data, ok := h.wellKnown.Get(c.Param("file"))
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/json", data)
+}
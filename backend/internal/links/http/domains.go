@@ -0,0 +1,94 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/domains"
+	"github.com/nekogravitycat/linkhub/internal/links"
+)
+
+// requestDomain returns the domain a redirect was requested on, from the
+// Host header. It returns nil for the primary domain and unknown hosts,
+// which are served the primary domain's links.
+func (h *Handler) requestDomain(c *gin.Context) *domains.Domain {
+	if h.domains == nil {
+		return nil
+	}
+	return h.domains.Lookup(c.Request.Host)
+}
+
+// requestDomainID is the ID of requestDomain, 0 for the primary domain.
+func (h *Handler) requestDomainID(c *gin.Context) int64 {
+	if domain := h.requestDomain(c); domain != nil {
+		return domain.ID
+	}
+	return 0
+}
+
+// domainID returns the ID of the domain with the given host for the admin
+// API. The primary domain, also when host is empty, is 0.
+func (h *Handler) domainID(ctx context.Context, host string) (int64, error) {
+	if host == "" || strings.EqualFold(host, h.primaryHost) {
+		return 0, nil
+	}
+	if h.domains == nil {
+		return 0, domains.ErrDomainNotFound
+	}
+
+	domain, err := h.domains.Get(ctx, host)
+	if err != nil {
+		return 0, err
+	}
+	return domain.ID, nil
+}
+
+// queryDomain returns the ID of the domain named by the domain query
+// parameter of an admin request. It writes the error response itself and
+// reports whether the request should continue.
+func (h *Handler) queryDomain(c *gin.Context) (int64, bool) {
+	id, err := h.domainID(c.Request.Context(), c.Query("domain"))
+	if err != nil {
+		if errors.Is(err, domains.ErrDomainNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("domain not found"))
+			return 0, false
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return 0, false
+	}
+	return id, true
+}
+
+// host returns the host a link is served on, or an empty string if its
+// domain is not known (yet).
+func (h *Handler) host(domainID int64) string {
+	if domainID == 0 {
+		return h.primaryHost
+	}
+	if h.domains != nil {
+		if domain := h.domains.ByID(domainID); domain != nil {
+			return domain.Host
+		}
+	}
+	return ""
+}
+
+// shortURL is the public URL of a link.
+func (h *Handler) shortURL(link *links.Link) string {
+	host := h.host(link.DomainID)
+	if host == "" {
+		return ""
+	}
+	return h.shortURLScheme + "://" + host + "/" + link.Slug
+}
+
+func (h *Handler) linkResponse(link *links.Link, now time.Time) *LinkResponse {
+	resp := newLinkResponse(link, now)
+	resp.Domain = h.host(link.DomainID)
+	resp.ShortURL = h.shortURL(link)
+	return resp
+}
@@ -2,32 +2,130 @@ package http
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/nekogravitycat/linkhub/internal/links"
 	"github.com/nekogravitycat/linkhub/internal/pkg/request"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
 )
 
 type BySlug struct {
 	Slug string `uri:"slug" binding:"required"`
 }
 
+type ByVariant struct {
+	Slug string `uri:"slug" binding:"required"`
+	ID   int64  `uri:"id" binding:"required,min=1"`
+}
+
+type ByLanguage struct {
+	Slug     string `uri:"slug" binding:"required"`
+	Language string `uri:"language" binding:"required,max=16"`
+}
+
 type CreateLinkRequest struct {
-	Slug string `json:"slug" binding:"required"`
-	URL  string `json:"url" binding:"required,url"`
+	// Domain is the host to create the link on; omitted means the primary domain
+	Domain string `json:"domain" binding:"max=260"`
+	// Slug is generated when omitted
+	Slug        string     `json:"slug"`
+	URL         string     `json:"url" binding:"required,url"`
+	ActiveFrom  *time.Time `json:"active_from"`
+	ActiveUntil *time.Time `json:"active_until"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	MaxClicks   *int64     `json:"max_clicks"`
+	Password    string     `json:"password"`
+	// RedirectStatus is one of 301, 302, 307 or 308; omitted means the server default
+	RedirectStatus *int   `json:"redirect_status"`
+	QueryMode      string `json:"query_mode" binding:"omitempty,oneof=off append override preserve"`
+	// ForwardPath appends anything after /{slug}/ to the destination
+	ForwardPath  bool                 `json:"forward_path"`
+	CountryRules []CountryRuleRequest `json:"country_rules" binding:"omitempty,max=250,dive"`
+	DeviceRules  []DeviceRuleRequest  `json:"device_rules" binding:"omitempty,max=20,dive"`
+	// DeepLink opens the link in a mobile app when installed
+	DeepLink *DeepLinkRequest `json:"deep_link"`
+	// OG* override the card link previews show
+	OGTitle       string `json:"og_title"`
+	OGDescription string `json:"og_description"`
+	OGImageURL    string `json:"og_image_url"`
+	// StickyVariants keeps returning visitors on the same variant
+	StickyVariants bool `json:"sticky_variants"`
 }
 
 type UpdateLinkRequest struct {
-	URL      *string `json:"url" binding:"omitempty,url"`
-	IsActive *bool   `json:"is_active"`
+	URL         *string                     `json:"url" binding:"omitempty,url"`
+	IsActive    *bool                       `json:"is_active"`
+	ActiveFrom  request.Nullable[time.Time] `json:"active_from"`
+	ActiveUntil request.Nullable[time.Time] `json:"active_until"`
+	ExpiresAt   request.Nullable[time.Time] `json:"expires_at"`
+	MaxClicks   request.Nullable[int64]     `json:"max_clicks"`
+	Password    request.Nullable[string]    `json:"password"`
+	// RedirectStatus null resets the link to the server default
+	RedirectStatus request.Nullable[int] `json:"redirect_status"`
+	QueryMode      *string               `json:"query_mode" binding:"omitempty,oneof=off append override preserve"`
+	ForwardPath    *bool                 `json:"forward_path"`
+	// CountryRules replaces all country overrides; [] removes them
+	CountryRules *[]CountryRuleRequest `json:"country_rules" binding:"omitempty,max=250,dive"`
+	// DeviceRules replaces all device rules; [] removes them
+	DeviceRules *[]DeviceRuleRequest `json:"device_rules" binding:"omitempty,max=20,dive"`
+	// DeepLink replaces the deep link; null removes it
+	DeepLink request.Nullable[DeepLinkRequest] `json:"deep_link"`
+	// OG* replace the card overrides; null or "" removes them
+	OGTitle        request.Nullable[string] `json:"og_title"`
+	OGDescription  request.Nullable[string] `json:"og_description"`
+	OGImageURL     request.Nullable[string] `json:"og_image_url"`
+	StickyVariants *bool                    `json:"sticky_variants"`
+}
+
+type CountryRuleRequest struct {
+	Country string `json:"country" binding:"required,len=2,alpha"`
+	URL     string `json:"url" binding:"required,url,max=2048"`
+}
+
+type DeviceRuleRequest struct {
+	OS      string `json:"os" binding:"omitempty,oneof=ios android windows macos linux chromeos"`
+	Device  string `json:"device" binding:"omitempty,oneof=mobile tablet desktop"`
+	Browser string `json:"browser" binding:"omitempty,oneof=chrome safari firefox edge opera samsung"`
+	URL     string `json:"url" binding:"required,url,max=2048"`
+}
+
+// DeepLinkRequest accepts app URLs with custom schemes; the service checks
+// them, since the url validator only knows web URLs.
+type DeepLinkRequest struct {
+	IOSURL          string `json:"ios_url" binding:"max=2048"`
+	IOSStoreURL     string `json:"ios_store_url" binding:"omitempty,url,max=2048"`
+	AndroidURL      string `json:"android_url" binding:"max=2048"`
+	AndroidStoreURL string `json:"android_store_url" binding:"omitempty,url,max=2048"`
+}
+
+func (r *DeepLinkRequest) toDeepLink() *links.DeepLink {
+	if r == nil {
+		return nil
+	}
+	return &links.DeepLink{
+		IOSURL:          r.IOSURL,
+		IOSStoreURL:     r.IOSStoreURL,
+		AndroidURL:      r.AndroidURL,
+		AndroidStoreURL: r.AndroidStoreURL,
+	}
+}
+
+func newNullableDeepLink(req request.Nullable[DeepLinkRequest]) request.Nullable[links.DeepLink] {
+	return request.Nullable[links.DeepLink]{Set: req.Set, Value: req.Value.toDeepLink()}
 }
 
 type ListRequest struct {
 	request.ListParams
+	// Domain only lists the links on one host
+	Domain   string `form:"domain" binding:"max=260"`
 	SortBy   string `form:"sort_by" binding:"omitempty,oneof=created_at updated_at slug id"`
 	Keyword  string `form:"keyword"`
 	IsActive *bool  `form:"is_active"`
+	Expired  *bool  `form:"expired"`
+	Status   string `form:"status" binding:"omitempty,oneof=scheduled live ended disabled"`
 }
 
 func (r *ListRequest) Validate() error {
@@ -54,12 +152,89 @@ func (r *ListRequest) Validate() error {
 }
 
 type LinkResponse struct {
-	ID        int64     `json:"id"`
-	Slug      string    `json:"slug"`
-	URL       string    `json:"url"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID   int64  `json:"id"`
+	Slug string `json:"slug"`
+	// Domain is the host the link is served on
+	Domain string `json:"domain"`
+	// ShortURL is the full public URL of the link
+	ShortURL       string               `json:"short_url"`
+	URL            string               `json:"url"`
+	IsActive       bool                 `json:"is_active"`
+	Status         string               `json:"status"`
+	ActiveFrom     *time.Time           `json:"active_from"`
+	ActiveUntil    *time.Time           `json:"active_until"`
+	ExpiresAt      *time.Time           `json:"expires_at"`
+	MaxClicks      *int64               `json:"max_clicks"`
+	ClickCount     int64                `json:"click_count"`
+	HasPassword    bool                 `json:"has_password"`
+	RedirectStatus *int                 `json:"redirect_status"`
+	QueryMode      string               `json:"query_mode"`
+	ForwardPath    bool                 `json:"forward_path"`
+	CountryRules   []links.CountryRule  `json:"country_rules"`
+	DeviceRules    []links.DeviceRule   `json:"device_rules"`
+	LanguageRules  []links.LanguageRule `json:"language_rules"`
+	DeepLink       *links.DeepLink      `json:"deep_link"`
+	OGTitle        string               `json:"og_title"`
+	OGDescription  string               `json:"og_description"`
+	OGImageURL     string               `json:"og_image_url"`
+	StickyVariants bool                 `json:"sticky_variants"`
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	// Warnings are only set when the link is created
+	Warnings []PolicyWarning `json:"warnings,omitempty"`
+}
+
+func newLinkResponse(link *links.Link, now time.Time) *LinkResponse {
+	return &LinkResponse{
+		ID:             link.ID,
+		Slug:           link.Slug,
+		URL:            link.URL,
+		IsActive:       link.IsActive,
+		Status:         string(link.Status(now)),
+		ActiveFrom:     link.ActiveFrom,
+		ActiveUntil:    link.ActiveUntil,
+		ExpiresAt:      link.ExpiresAt,
+		MaxClicks:      link.MaxClicks,
+		ClickCount:     link.ClickCount,
+		HasPassword:    link.HasPassword(),
+		RedirectStatus: link.RedirectStatus,
+		QueryMode:      string(link.QueryMode),
+		ForwardPath:    link.ForwardPath,
+		CountryRules:   listResponse(link.CountryRules),
+		DeviceRules:    listResponse(link.DeviceRules),
+		LanguageRules:  listResponse(link.LanguageRules),
+		DeepLink:       link.DeepLink,
+		OGTitle:        link.OGTitle,
+		OGDescription:  link.OGDescription,
+		OGImageURL:     link.OGImageURL,
+		StickyVariants: link.StickyVariants,
+		CreatedAt:      link.CreatedAt,
+		UpdatedAt:      link.UpdatedAt,
+	}
+}
+
+// listResponse always returns a list, so clients never see null.
+func listResponse[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+func newCountryRules(reqs []CountryRuleRequest) []links.CountryRule {
+	rules := make([]links.CountryRule, len(reqs))
+	for i, r := range reqs {
+		rules[i] = links.CountryRule{Country: r.Country, URL: r.URL}
+	}
+	return rules
+}
+
+func newDeviceRules(reqs []DeviceRuleRequest) []links.DeviceRule {
+	rules := make([]links.DeviceRule, len(reqs))
+	for i, r := range reqs {
+		rules[i] = links.DeviceRule{OS: r.OS, Device: r.Device, Browser: r.Browser, URL: r.URL}
+	}
+	return rules
 }
 
 type ListResponse struct {
@@ -67,6 +242,113 @@ type ListResponse struct {
 	Total int64           `json:"total"`
 }
 
+// PolicyWarning flags a destination the URL policy allowed but that may
+// deceive visitors.
+type PolicyWarning struct {
+	// Code is one of the urlpolicy Code constants
+	Code   string `json:"code"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+func newPolicyWarnings(warnings []urlpolicy.Warning) []PolicyWarning {
+	if len(warnings) == 0 {
+		return nil
+	}
+	resp := make([]PolicyWarning, len(warnings))
+	for i, w := range warnings {
+		resp[i] = PolicyWarning{Code: w.Code, URL: w.URL, Reason: w.Reason}
+	}
+	return resp
+}
+
+// WarningsResponse answers updates, which return nothing else.
+type WarningsResponse struct {
+	Warnings []PolicyWarning `json:"warnings,omitempty"`
+}
+
+type CreateVariantRequest struct {
+	URL string `json:"url" binding:"required,url,max=2048"`
+	// Weight is required so that 0 (paused) is explicit
+	Weight *int `json:"weight" binding:"required,min=0,max=10000"`
+}
+
+type UpdateVariantRequest struct {
+	URL    *string `json:"url" binding:"omitempty,url,max=2048"`
+	Weight *int    `json:"weight" binding:"omitempty,min=0,max=10000"`
+}
+
+type VariantResponse struct {
+	links.Variant
+	Warnings []PolicyWarning `json:"warnings,omitempty"`
+}
+
+// PreviewResponse is the JSON form of the /{slug}+ preview page. URL and
+// Host are omitted for password-protected links.
+type PreviewResponse struct {
+	Slug      string    `json:"slug"`
+	URL       string    `json:"url,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Status    string    `json:"status"`
+	IsActive  bool      `json:"is_active"`
+	// Protected links need a password before redirecting
+	Protected bool `json:"protected"`
+	// Targeted links may send some visitors to other destinations
+	Targeted bool `json:"targeted"`
+}
+
+func newPreviewResponse(page previewPage) *PreviewResponse {
+	return &PreviewResponse{
+		Slug:      page.Slug,
+		URL:       page.URL,
+		Host:      page.Host,
+		CreatedAt: page.CreatedAt,
+		Status:    string(page.Status),
+		IsActive:  page.Active,
+		Protected: page.Protected,
+		Targeted:  page.Targeted,
+	}
+}
+
+type QRCodeRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=png svg"`
+	// Size is the width and height in pixels
+	Size int    `form:"size" binding:"omitempty,min=64,max=4096"`
+	ECC  string `form:"ecc" binding:"omitempty,oneof=l m q h L M Q H"`
+	// Margin is the quiet zone in modules; 0 is allowed, so nil means default
+	Margin     *int   `form:"margin" binding:"omitempty,min=0,max=16"`
+	Foreground string `form:"fg" binding:"omitempty,max=9"`
+	Background string `form:"bg" binding:"omitempty,max=9"`
+	Logo       bool   `form:"logo"`
+}
+
+type SetLanguageRuleRequest struct {
+	URL string `json:"url" binding:"required,url,max=2048"`
+}
+
+type LanguageRulesResponse struct {
+	LanguageRules []links.LanguageRule `json:"language_rules"`
+	Warnings      []PolicyWarning      `json:"warnings,omitempty"`
+}
+
+type VariantListResponse struct {
+	Variants    []links.Variant `json:"variants"`
+	TotalWeight int             `json:"total_weight"`
+	TotalHits   int64           `json:"total_hits"`
+}
+
+func newVariantListResponse(variants []links.Variant) *VariantListResponse {
+	resp := &VariantListResponse{
+		Variants:    listResponse(variants),
+		TotalWeight: links.TotalWeight(variants),
+	}
+	for _, v := range variants {
+		resp.TotalHits += v.HitCount
+	}
+	return resp
+}
+
 func (r *CreateLinkRequest) Validate() error {
 	if r.URL == "" {
 		return errors.New("url is required")
@@ -74,6 +356,26 @@ func (r *CreateLinkRequest) Validate() error {
 	if len(r.URL) > 2048 {
 		return errors.New("url is too long (max 2048 chars)")
 	}
+	if r.ActiveUntil != nil && !r.ActiveUntil.After(time.Now()) {
+		return errors.New("active_until must be in the future")
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	if err := validateMaxClicks(r.MaxClicks); err != nil {
+		return err
+	}
+	if r.Password != "" {
+		if err := validatePassword(r.Password); err != nil {
+			return err
+		}
+	}
+	if err := validateRedirectStatus(r.RedirectStatus); err != nil {
+		return err
+	}
+	if err := validateCard(&r.OGTitle, &r.OGDescription, &r.OGImageURL); err != nil {
+		return err
+	}
 	if r.Slug != "" {
 		return ValidateSlug(r.Slug)
 	}
@@ -89,6 +391,76 @@ func (r *UpdateLinkRequest) Validate() error {
 			return errors.New("url is too long (max 2048 chars)")
 		}
 	}
+	if err := validateMaxClicks(r.MaxClicks.Value); err != nil {
+		return err
+	}
+	if r.Password.Value != nil {
+		if err := validatePassword(*r.Password.Value); err != nil {
+			return err
+		}
+	}
+	if err := validateRedirectStatus(r.RedirectStatus.Value); err != nil {
+		return err
+	}
+	if err := validateCard(r.OGTitle.Value, r.OGDescription.Value, r.OGImageURL.Value); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateCard trims the card overrides and checks their length; the image
+// must be a web URL the previewing service can fetch. Nil fields are not
+// being set.
+func validateCard(title, description, imageURL *string) error {
+	for _, field := range []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"og_title", title, 200},
+		{"og_description", description, 1000},
+		{"og_image_url", imageURL, 2048},
+	} {
+		if field.value == nil {
+			continue
+		}
+		*field.value = strings.TrimSpace(*field.value)
+		if len(*field.value) > field.max {
+			return fmt.Errorf("%s is too long (max %d chars)", field.name, field.max)
+		}
+	}
+
+	if imageURL != nil && *imageURL != "" {
+		u, err := url.Parse(*imageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("og_image_url must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+func validateMaxClicks(maxClicks *int64) error {
+	if maxClicks != nil && *maxClicks < 1 {
+		return errors.New("max_clicks must be at least 1")
+	}
+	return nil
+}
+
+func validateRedirectStatus(status *int) error {
+	if status != nil && !links.ValidRedirectStatus(*status) {
+		return errors.New("redirect_status must be one of 301, 302, 307 or 308")
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < 4 {
+		return errors.New("password must be at least 4 characters long")
+	}
+	// bcrypt only uses the first 72 bytes
+	if len(password) > 72 {
+		return errors.New("password is too long (max 72 bytes)")
+	}
 	return nil
 }
 
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/fallback"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/ratelimit"
+)
+
+// Public: Root (the bare redirect domain). Domains with a fallback URL
+// send visitors there instead.
+func (h *Handler) Root(c *gin.Context) {
+	if h.rootRedirectURL != "" && h.domainFallbackURL(c) == "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, h.rootRedirectURL)
+		return
+	}
+	h.abortFallback(c, fallback.NotFound, http.StatusNotFound)
+}
+
+// fallbackFor picks the fallback and status for an unavailable link.
+// Deactivated links are gone for good, as are links that expired or ran out
+// of clicks; links that are not active yet may still come.
+func fallbackFor(err error) (fallback.Kind, int) {
+	switch {
+	case errors.Is(err, links.ErrLinkInactive):
+		return fallback.Inactive, http.StatusGone
+	case errors.Is(err, links.ErrLinkNotStarted):
+		return fallback.Inactive, http.StatusNotFound
+	case errors.Is(err, links.ErrLinkExpired), errors.Is(err, links.ErrLinkExhausted):
+		return fallback.Expired, http.StatusGone
+	default:
+		return fallback.NotFound, http.StatusNotFound
+	}
+}
+
+// abortFallback answers a request that cannot be redirected to its link.
+// The fallback URL of the requested domain takes precedence over the
+// server's fallbacks. Without either, a bare 404 is sent whatever the reason.
+func (h *Handler) abortFallback(c *gin.Context, kind fallback.Kind, status int) {
+	// Redirects to a fallback URL still spend the not-found rate limit
+	if kind == fallback.NotFound {
+		ratelimit.MarkNotFound(c)
+	}
+
+	if target := h.domainFallbackURL(c); target != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, target)
+		c.Abort()
+		return
+	}
+
+	if h.fallback == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+
+	if target := h.fallback.URL(kind); target != "" {
+		c.Redirect(http.StatusFound, target)
+		c.Abort()
+		return
+	}
+
+	h.renderFallback(c, kind, status)
+}
+
+// abortBlocked answers a request for a link whose destination is on the
+// blocklist with the warning page. Unlike other fallbacks, it is never
+// replaced by a redirect.
+func (h *Handler) abortBlocked(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	if h.fallback == nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	h.renderFallback(c, fallback.Blocked, http.StatusForbidden)
+}
+
+// renderFallback renders the page for kind and aborts the request.
+func (h *Handler) renderFallback(c *gin.Context, kind fallback.Kind, status int) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := h.fallback.Render(c.Writer, kind, fallback.Page{Slug: c.Param("slug"), Status: status}); err != nil {
+		log.Printf("failed to render %s fallback: %v", kind, err)
+	}
+	c.Abort()
+}
+
+// domainFallbackURL returns the fallback URL of the requested domain, if any.
+func (h *Handler) domainFallbackURL(c *gin.Context) string {
+	if domain := h.requestDomain(c); domain != nil {
+		return domain.FallbackURL
+	}
+	return ""
+}
@@ -2,51 +2,114 @@ package http
 
 import (
 	"errors"
-	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/blocklist"
+	"github.com/nekogravitycat/linkhub/internal/botdetect"
+	"github.com/nekogravitycat/linkhub/internal/clicks"
+	"github.com/nekogravitycat/linkhub/internal/domains"
+	"github.com/nekogravitycat/linkhub/internal/fallback"
+	"github.com/nekogravitycat/linkhub/internal/geoip"
 	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/qrcode"
+	"github.com/nekogravitycat/linkhub/internal/ratelimit"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+	"github.com/nekogravitycat/linkhub/internal/wellknown"
 )
 
 type Handler struct {
-	service links.Service
+	service         links.Service
+	recorder        clicks.Recorder
+	redirectStatus  int
+	unlocks         *unlockSigner
+	throttle        *unlockThrottle
+	geoip           geoip.Resolver
+	shortURLScheme  string
+	primaryHost     string
+	domains         domains.Service
+	qrLogo          *qrcode.Logo
+	bots            botdetect.Classifier
+	fallback        *fallback.Pages
+	rootRedirectURL string
+	wellKnown       *wellknown.Files
+	rateLimiter     *ratelimit.Limiter
+	blocklist       *blocklist.List
 }
 
-func NewHandler(service links.Service) *Handler {
-	return &Handler{service: service}
+// Options holds the optional dependencies and settings of the handler.
+// The zero value is usable.
+type Options struct {
+	// Recorder receives a click for every redirect; nil disables recording
+	Recorder clicks.Recorder
+	// UnlockSecret signs password unlock cookies. When empty, a random
+	// secret is used, so unlocks do not survive restarts or span replicas.
+	UnlockSecret []byte
+	UnlockTTL    time.Duration
+	// DefaultRedirectStatus applies to links without their own redirect
+	// status. Defaults to 302 Found.
+	DefaultRedirectStatus int
+	// GeoIP resolves visitor countries for country rules; nil disables them
+	GeoIP geoip.Resolver
+	// ShortURLBase is the scheme and host of the primary redirect domain,
+	// e.g. "https://sho.rt". Defaults to the development redirect domain.
+	ShortURLBase string
+	// Domains serves links on other domains, chosen by the Host header of
+	// redirects and the domain parameter of the API; nil serves the primary
+	// domain only
+	Domains domains.Service
+	// QRLogo is drawn in the centre of QR codes that ask for it; nil
+	// disables logos
+	QRLogo *qrcode.Logo
+	// Bots tells bots from people, so their redirects are not counted as
+	// human clicks; nil treats every visitor as human
+	Bots botdetect.Classifier
+	// Fallback answers requests for unknown or unavailable links with a
+	// page or a redirect; nil sends a bare 404
+	Fallback *fallback.Pages
+	// RootRedirectURL is where the bare redirect domain sends visitors;
+	// empty serves the not found fallback
+	RootRedirectURL string
+	// WellKnown holds the app association files served under
+	// /.well-known/; nil serves none
+	WellKnown *wellknown.Files
+	// RateLimiter throttles the clients of redirects and previews; nil
+	// disables rate limiting
+	RateLimiter *ratelimit.Limiter
+	// Blocklist stops redirects to the hosts it lists, showing a warning
+	// page instead; nil blocks nothing
+	Blocklist *blocklist.List
 }
 
-// Public: Redirect
-func (h *Handler) Redirect(c *gin.Context) {
-	var uri BySlug
-	if err := c.ShouldBindUri(&uri); err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
-	}
-
-	if err := ValidateSlug(uri.Slug); err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
+func NewHandler(service links.Service, opts Options) *Handler {
+	if !links.ValidRedirectStatus(opts.DefaultRedirectStatus) {
+		opts.DefaultRedirectStatus = http.StatusFound
 	}
-
-	link, err := h.service.Get(c.Request.Context(), uri.Slug)
-	if err != nil {
-		if errors.Is(err, links.ErrLinkNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		log.Printf("internal server error while redirecting: %v", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+	if opts.ShortURLBase == "" {
+		opts.ShortURLBase = "http://localhost:8003"
 	}
-
-	if !link.IsActive {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
+	scheme, primaryHost, _ := strings.Cut(opts.ShortURLBase, "://")
+
+	return &Handler{
+		service:         service,
+		recorder:        opts.Recorder,
+		redirectStatus:  opts.DefaultRedirectStatus,
+		unlocks:         newUnlockSigner(opts.UnlockSecret, opts.UnlockTTL),
+		throttle:        newUnlockThrottle(),
+		geoip:           opts.GeoIP,
+		shortURLScheme:  scheme,
+		primaryHost:     primaryHost,
+		domains:         opts.Domains,
+		qrLogo:          opts.QRLogo,
+		bots:            opts.Bots,
+		fallback:        opts.Fallback,
+		rootRedirectURL: opts.RootRedirectURL,
+		wellKnown:       opts.WellKnown,
+		rateLimiter:     opts.RateLimiter,
+		blocklist:       opts.Blocklist,
 	}
-
-	c.Redirect(http.StatusFound, link.URL)
 }
 
 // Private: List
@@ -67,6 +130,21 @@ func (h *Handler) List(c *gin.Context) {
 		SortBy:     req.SortBy,
 		Keyword:    req.Keyword,
 		IsActive:   req.IsActive,
+		Expired:    req.Expired,
+		Status:     links.Status(req.Status),
+	}
+
+	if req.Domain != "" {
+		domainID, err := h.domainID(c.Request.Context(), req.Domain)
+		if err != nil {
+			if errors.Is(err, domains.ErrDomainNotFound) {
+				c.JSON(http.StatusNotFound, errorBody("domain not found"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+			return
+		}
+		opts.DomainID = &domainID
 	}
 
 	list, total, err := h.service.List(c.Request.Context(), opts)
@@ -80,15 +158,9 @@ func (h *Handler) List(c *gin.Context) {
 		Total: total,
 	}
 
+	now := time.Now()
 	for _, link := range list {
-		response.Links = append(response.Links, &LinkResponse{
-			ID:        link.ID,
-			Slug:      link.Slug,
-			URL:       link.URL,
-			IsActive:  link.IsActive,
-			CreatedAt: link.CreatedAt,
-			UpdatedAt: link.UpdatedAt,
-		})
+		response.Links = append(response.Links, h.linkResponse(link, now))
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -107,7 +179,12 @@ func (h *Handler) Get(c *gin.Context) {
 		return
 	}
 
-	link, err := h.service.Get(c.Request.Context(), uri.Slug)
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	link, err := h.service.Get(c.Request.Context(), domainID, uri.Slug)
 	if err != nil {
 		if errors.Is(err, links.ErrLinkNotFound) {
 			c.JSON(http.StatusNotFound, errorBody("link not found"))
@@ -117,7 +194,7 @@ func (h *Handler) Get(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, link)
+	c.JSON(http.StatusOK, h.linkResponse(link, time.Now()))
 }
 
 // Private: Create
@@ -133,21 +210,57 @@ func (h *Handler) Create(c *gin.Context) {
 		return
 	}
 
-	err := h.service.Create(c.Request.Context(), req.Slug, req.URL)
+	domainID, err := h.domainID(c.Request.Context(), req.Domain)
+	if err != nil {
+		if errors.Is(err, domains.ErrDomainNotFound) {
+			c.JSON(http.StatusBadRequest, errorBody("domain not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	link, warnings, err := h.service.Create(c.Request.Context(), links.CreateLinkInput{
+		DomainID:       domainID,
+		Slug:           req.Slug,
+		URL:            req.URL,
+		ActiveFrom:     req.ActiveFrom,
+		ActiveUntil:    req.ActiveUntil,
+		ExpiresAt:      req.ExpiresAt,
+		MaxClicks:      req.MaxClicks,
+		Password:       req.Password,
+		RedirectStatus: req.RedirectStatus,
+		QueryMode:      links.QueryMode(req.QueryMode),
+		ForwardPath:    req.ForwardPath,
+		CountryRules:   newCountryRules(req.CountryRules),
+		DeviceRules:    newDeviceRules(req.DeviceRules),
+		DeepLink:       req.DeepLink.toDeepLink(),
+		OGTitle:        req.OGTitle,
+		OGDescription:  req.OGDescription,
+		OGImageURL:     req.OGImageURL,
+		StickyVariants: req.StickyVariants,
+	})
 	if err != nil {
 		if errors.Is(err, links.ErrSlugTaken) {
 			c.JSON(http.StatusConflict, errorBody("slug already taken"))
 			return
 		}
-		if errors.Is(err, links.ErrRedirectLoop) {
-			c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		if errors.Is(err, links.ErrNoFreeSlug) {
+			// The generated slugs are crowded; a custom slug still works
+			c.JSON(http.StatusServiceUnavailable, errorBody("no free slug could be generated, choose a slug"))
+			return
+		}
+		if isInvalidInput(err) {
+			c.JSON(http.StatusBadRequest, inputErrorBody(err))
 			return
 		}
 		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
 		return
 	}
 
-	c.Status(http.StatusCreated)
+	resp := h.linkResponse(link, time.Now())
+	resp.Warnings = newPolicyWarnings(warnings)
+	c.JSON(http.StatusCreated, resp)
 }
 
 // Private: Update
@@ -163,6 +276,11 @@ func (h *Handler) Update(c *gin.Context) {
 		return
 	}
 
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
 	var req UpdateLinkRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
@@ -174,21 +292,50 @@ func (h *Handler) Update(c *gin.Context) {
 		return
 	}
 
-	err := h.service.Update(c.Request.Context(), uri.Slug, req.URL, req.IsActive)
+	var countryRules *[]links.CountryRule
+	if req.CountryRules != nil {
+		rules := newCountryRules(*req.CountryRules)
+		countryRules = &rules
+	}
+	var deviceRules *[]links.DeviceRule
+	if req.DeviceRules != nil {
+		rules := newDeviceRules(*req.DeviceRules)
+		deviceRules = &rules
+	}
+
+	warnings, err := h.service.Update(c.Request.Context(), domainID, uri.Slug, links.UpdateLinkInput{
+		URL:            req.URL,
+		IsActive:       req.IsActive,
+		ActiveFrom:     req.ActiveFrom,
+		ActiveUntil:    req.ActiveUntil,
+		ExpiresAt:      req.ExpiresAt,
+		MaxClicks:      req.MaxClicks,
+		Password:       req.Password,
+		RedirectStatus: req.RedirectStatus,
+		QueryMode:      (*links.QueryMode)(req.QueryMode),
+		ForwardPath:    req.ForwardPath,
+		CountryRules:   countryRules,
+		DeviceRules:    deviceRules,
+		DeepLink:       newNullableDeepLink(req.DeepLink),
+		OGTitle:        req.OGTitle,
+		OGDescription:  req.OGDescription,
+		OGImageURL:     req.OGImageURL,
+		StickyVariants: req.StickyVariants,
+	})
 	if err != nil {
 		if errors.Is(err, links.ErrLinkNotFound) {
 			c.JSON(http.StatusNotFound, errorBody("link not found"))
 			return
 		}
-		if errors.Is(err, links.ErrRedirectLoop) {
-			c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		if isInvalidInput(err) {
+			c.JSON(http.StatusBadRequest, inputErrorBody(err))
 			return
 		}
 		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
 		return
 	}
 
-	c.Status(http.StatusOK)
+	c.JSON(http.StatusOK, WarningsResponse{Warnings: newPolicyWarnings(warnings)})
 }
 
 // Private: Delete
@@ -204,7 +351,12 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
-	err := h.service.Delete(c.Request.Context(), uri.Slug)
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	err := h.service.Delete(c.Request.Context(), domainID, uri.Slug)
 	if err != nil {
 		if errors.Is(err, links.ErrLinkNotFound) {
 			c.JSON(http.StatusNotFound, errorBody("link not found"))
@@ -217,6 +369,30 @@ func (h *Handler) Delete(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// isInvalidInput reports whether an error storing a link, its variants or
+// rules was caused by the request content rather than an internal failure.
+func isInvalidInput(err error) bool {
+	return errors.Is(err, links.ErrRedirectLoop) ||
+		errors.Is(err, links.ErrRedirectCycle) ||
+		errors.Is(err, links.ErrChainTooLong) ||
+		errors.Is(err, urlpolicy.ErrNotAllowed) ||
+		errors.Is(err, links.ErrInvalidWindow) ||
+		errors.Is(err, links.ErrInvalidCountryRule) ||
+		errors.Is(err, links.ErrInvalidDeviceRule) ||
+		errors.Is(err, links.ErrInvalidDeepLink)
+}
+
 func errorBody(msg string) gin.H {
 	return gin.H{"error": msg}
 }
+
+// inputErrorBody is the errorBody of an invalid input error. URLs rejected
+// by the URL policy add the code of the rule that fired.
+func inputErrorBody(err error) gin.H {
+	body := errorBody(err.Error())
+	var violation *urlpolicy.Violation
+	if errors.As(err, &violation) {
+		body["code"] = violation.Code
+	}
+	return body
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+)
+
+// Private: List Language Rules
+func (h *Handler) ListLanguageRules(c *gin.Context) {
+	var uri BySlug
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	rules, err := h.service.ListLanguageRules(c.Request.Context(), domainID, uri.Slug)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, LanguageRulesResponse{LanguageRules: listResponse(rules)})
+}
+
+// Private: Set Language Rule (creates the rule or replaces its URL)
+func (h *Handler) SetLanguageRule(c *gin.Context) {
+	var uri ByLanguage
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	var req SetLanguageRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	rules, warnings, err := h.service.SetLanguageRule(c.Request.Context(), domainID, uri.Slug, links.LanguageRule{
+		Language: uri.Language,
+		URL:      req.URL,
+	})
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		if isInvalidInput(err) || errors.Is(err, links.ErrInvalidLanguageRule) {
+			c.JSON(http.StatusBadRequest, inputErrorBody(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, LanguageRulesResponse{LanguageRules: listResponse(rules), Warnings: newPolicyWarnings(warnings)})
+}
+
+// Private: Delete Language Rule
+func (h *Handler) DeleteLanguageRule(c *gin.Context) {
+	var uri ByLanguage
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	err := h.service.DeleteLanguageRule(c.Request.Context(), domainID, uri.Slug, uri.Language)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		if errors.Is(err, links.ErrLanguageRuleNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("language rule not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,31 @@
+package http
+
+import (
+	"embed"
+	"html/template"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var pages = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+type unlockPage struct {
+	Slug  string
+	Error string
+}
+
+// renderPage writes an HTML page. Pages are always personalised, so they are
+// never cached.
+func renderPage(c *gin.Context, status int, name string, data any) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+
+	if err := pages.ExecuteTemplate(c.Writer, name, data); err != nil {
+		log.Printf("failed to render %s: %v", name, err)
+	}
+}
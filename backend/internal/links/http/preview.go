@@ -0,0 +1,118 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/fallback"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+)
+
+type previewPage struct {
+	Slug      string
+	URL       string
+	Host      string
+	CreatedAt time.Time
+	Status    links.Status
+	Active    bool
+	Protected bool
+	Targeted  bool
+}
+
+// Public: Preview shows where a link goes instead of redirecting. It is
+// served as /{slug}+ on the redirect domain. Clients asking for JSON (via
+// the Accept header or ?format=json) get a PreviewResponse instead of HTML.
+// Links to blocked destinations get the warning page instead, as when they
+// are followed.
+func (h *Handler) Preview(c *gin.Context) {
+	wantJSON := c.Query("format") == "json" ||
+		c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+
+	var uri BySlug
+	if err := c.ShouldBindUri(&uri); err != nil || ValidateSlug(uri.Slug) != nil {
+		h.previewNotFound(c, wantJSON)
+		return
+	}
+
+	link, err := h.service.Get(c.Request.Context(), h.requestDomainID(c), uri.Slug)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			h.previewNotFound(c, wantJSON)
+			return
+		}
+		log.Printf("internal server error while previewing: %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if entry, blocked := h.blocklisted(link.URL); blocked {
+		log.Printf("blocked preview of %s/%s to %s (%s)", h.host(link.DomainID), link.Slug, link.URL, entry)
+		if wantJSON {
+			body := errorBody("link destination is blocked")
+			body["code"] = urlpolicy.CodeBlocklisted
+			c.Header("Cache-Control", "no-store")
+			c.AbortWithStatusJSON(http.StatusForbidden, body)
+			return
+		}
+		h.abortBlocked(c)
+		return
+	}
+
+	// Variants are only loaded when resolving; a split link's destination
+	// depends on the visitor just like a targeted one's.
+	targeted := link.IsTargeted()
+	if !targeted && !link.HasPassword() {
+		variants, err := h.service.ListVariants(c.Request.Context(), link.DomainID, link.Slug)
+		if err != nil {
+			log.Printf("internal server error while previewing: %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		targeted = links.TotalWeight(variants) > 0
+	}
+
+	page := newPreviewPage(link, targeted, time.Now())
+
+	if wantJSON {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, newPreviewResponse(page))
+		return
+	}
+	renderPage(c, http.StatusOK, "preview.html", page)
+}
+
+// newPreviewPage describes the link for visitors. The destination of a
+// password-protected link is part of what the password protects, so it is
+// left out.
+func newPreviewPage(link *links.Link, targeted bool, now time.Time) previewPage {
+	page := previewPage{
+		Slug:      link.Slug,
+		CreatedAt: link.CreatedAt,
+		Status:    link.Status(now),
+		Protected: link.HasPassword(),
+		Targeted:  targeted,
+	}
+	page.Active = page.Status == links.StatusLive
+
+	if !page.Protected {
+		page.URL = link.URL
+		if u, err := url.Parse(link.URL); err == nil {
+			page.Host = u.Hostname()
+		}
+	}
+
+	return page
+}
+
+func (h *Handler) previewNotFound(c *gin.Context, wantJSON bool) {
+	if wantJSON {
+		c.AbortWithStatusJSON(http.StatusNotFound, errorBody("link not found"))
+		return
+	}
+	h.abortFallback(c, fallback.NotFound, http.StatusNotFound)
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/qrcode"
+)
+
+const (
+	defaultQRSize   = 512
+	defaultQRMargin = 4
+
+	// QR codes only depend on the short URL and the request, so clients may
+	// keep them for long and revalidate with the ETag afterwards
+	qrCacheControl = "public, max-age=86400"
+)
+
+// Private: QR Code for the link's short URL
+func (h *Handler) QRCode(c *gin.Context) {
+	var uri BySlug
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	var req QRCodeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	opts, err := h.qrOptions(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	link, err := h.service.Get(c.Request.Context(), domainID, uri.Slug)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	content := h.shortURL(link)
+	format := req.Format
+	if format == "" {
+		format = "png"
+	}
+
+	etag := qrETag(content, format, opts)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", qrCacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	var data []byte
+	var contentType string
+	if format == "svg" {
+		data, err = qrcode.SVG(content, opts)
+		contentType = "image/svg+xml"
+	} else {
+		data, err = qrcode.PNG(content, opts)
+		contentType = "image/png"
+	}
+	if err != nil {
+		log.Printf("failed to render QR code for %s: %v", link.Slug, err)
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// qrOptions fills in the defaults of a QR code request. Logos need a high
+// error correction level, which is therefore their default.
+func (h *Handler) qrOptions(req QRCodeRequest) (qrcode.Options, error) {
+	opts := qrcode.Options{
+		Size:   defaultQRSize,
+		Level:  qrcode.Level(strings.ToLower(req.ECC)),
+		Margin: defaultQRMargin,
+	}
+	if req.Size != 0 {
+		opts.Size = req.Size
+	}
+	if req.Margin != nil {
+		opts.Margin = *req.Margin
+	}
+
+	if req.Logo {
+		if h.qrLogo == nil {
+			return opts, errors.New("no QR code logo is configured")
+		}
+		opts.Logo = h.qrLogo
+		if opts.Level == "" {
+			opts.Level = qrcode.LevelHigh
+		}
+		if opts.Level != qrcode.LevelQuarter && opts.Level != qrcode.LevelHigh {
+			return opts, qrcode.ErrLogoNeedsHighLevel
+		}
+	}
+	if opts.Level == "" {
+		opts.Level = qrcode.LevelMedium
+	}
+
+	var err error
+	if opts.Foreground, err = parseQRColor(req.Foreground, "000000"); err != nil {
+		return opts, err
+	}
+	if opts.Background, err = parseQRColor(req.Background, "ffffff"); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+func parseQRColor(value, fallback string) (color.NRGBA, error) {
+	if value == "" {
+		value = fallback
+	}
+	return qrcode.ParseColor(value)
+}
+
+// qrETag identifies a QR code by everything it is rendered from.
+func qrETag(content, format string, opts qrcode.Options) string {
+	logo := ""
+	if opts.Logo != nil {
+		logo = opts.Logo.Digest()
+	}
+	key := fmt.Sprintf("%s|%s|%d|%s|%d|%v|%v|%s", content, format, opts.Size, opts.Level, opts.Margin, opts.Foreground, opts.Background, logo)
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison of If-None-Match.
+func etagMatches(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
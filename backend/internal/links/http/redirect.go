@@ -0,0 +1,322 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/clicks"
+	"github.com/nekogravitycat/linkhub/internal/fallback"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/useragent"
+)
+
+const (
+	// Request headers stored with a click are truncated to this length
+	maxClickHeaderLength = 1024
+
+	// How long clients and shared caches may keep a permanent redirect
+	permanentRedirectMaxAge = 24 * time.Hour
+)
+
+// Public: Redirect
+func (h *Handler) Redirect(c *gin.Context) {
+	link, ok := h.resolve(c)
+	if !ok {
+		return
+	}
+
+	if h.serveCard(c, link) {
+		return
+	}
+
+	if link.HasPassword() && !h.unlocks.verify(c, link, time.Now()) {
+		renderPage(c, http.StatusOK, "unlock.html", unlockPage{Slug: link.Slug})
+		return
+	}
+
+	h.follow(c, link, h.statusFor(link))
+}
+
+// Public: Unlock (password form submission). POST requests to links without
+// a password are redirected as usual, so 307/308 links can front POST endpoints.
+func (h *Handler) Unlock(c *gin.Context) {
+	link, ok := h.resolve(c)
+	if !ok {
+		return
+	}
+
+	if !link.HasPassword() {
+		h.follow(c, link, h.statusFor(link))
+		return
+	}
+
+	now := time.Now()
+	key := link.Slug + "|" + c.ClientIP()
+
+	// The attempt is counted before the slow password check, so parallel
+	// guesses are bounded too
+	if wait := h.throttle.reserve(key, now); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		renderPage(c, http.StatusTooManyRequests, "unlock.html", unlockPage{
+			Slug:  link.Slug,
+			Error: "Too many attempts. Please try again later.",
+		})
+		return
+	}
+
+	if !link.CheckPassword(c.PostForm("password")) {
+		renderPage(c, http.StatusUnauthorized, "unlock.html", unlockPage{
+			Slug:  link.Slug,
+			Error: "Incorrect password.",
+		})
+		return
+	}
+
+	h.throttle.reset(key)
+	h.unlocks.set(c, link, now)
+
+	// 303 turns the form POST into a GET on the destination
+	h.follow(c, link, http.StatusSeeOther)
+}
+
+// resolve looks up the link for the slug in the path. It writes the error
+// response itself and reports whether the request should continue.
+func (h *Handler) resolve(c *gin.Context) (*links.Link, bool) {
+	var uri BySlug
+	if err := c.ShouldBindUri(&uri); err != nil {
+		h.abortFallback(c, fallback.NotFound, http.StatusNotFound)
+		return nil, false
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		h.abortFallback(c, fallback.NotFound, http.StatusNotFound)
+		return nil, false
+	}
+
+	link, err := h.service.Resolve(c.Request.Context(), h.requestDomainID(c), uri.Slug)
+	if err != nil {
+		h.abortUnavailable(c, err)
+		return nil, false
+	}
+
+	// Only prefix links accept a path after the slug
+	if forwardedPath(c) != "" && !link.ForwardPath {
+		h.abortFallback(c, fallback.NotFound, http.StatusNotFound)
+		return nil, false
+	}
+
+	return link, true
+}
+
+// forwardedPath returns the path after /{slug}/, if any.
+func forwardedPath(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("path"), "/")
+}
+
+// follow spends a click and redirects to the link's destination. Bots are
+// redirected without spending one, so an unfurl cannot use up a link before
+// anyone opens it.
+func (h *Handler) follow(c *gin.Context, link *links.Link, status int) {
+	target, variant, err := h.destination(c, link)
+	if err != nil {
+		h.abortUnavailable(c, err)
+		return
+	}
+
+	bot := h.isBot(c)
+	page, deepLinked := deepLinkPageFor(c, link, target, bot)
+	if h.blocked(c, link, target) || deepLinked && h.deepLinkBlocked(c, link, page) {
+		return
+	}
+
+	if !bot {
+		if err := h.service.Consume(c.Request.Context(), link); err != nil {
+			h.abortUnavailable(c, err)
+			return
+		}
+	}
+
+	if variant != nil {
+		h.countVariantHit(c, link, variant, bot)
+	}
+	h.recordClick(c, link, bot)
+
+	if len(link.DeviceRules) > 0 || link.DeepLink != nil || link.HasCard() {
+		c.Writer.Header().Add("Vary", "User-Agent, Sec-CH-UA, Sec-CH-UA-Mobile, Sec-CH-UA-Platform")
+	}
+	if len(link.LanguageRules) > 0 {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+	}
+
+	if deepLinked {
+		renderPage(c, http.StatusOK, "deeplink.html", page)
+		return
+	}
+
+	c.Header("Cache-Control", cacheControl(link, status, time.Now()))
+	c.Redirect(status, target)
+}
+
+// destination builds the final URL for the request, plus the variant it was
+// taken from, if any. The base URL is the matching targeting rule's, else a
+// weighted variant's, else the link's own; the forwarded path and the
+// incoming query string are then added.
+func (h *Handler) destination(c *gin.Context, link *links.Link) (string, *links.Variant, error) {
+	target, matched := link.TargetURL(h.visitor(c, link))
+
+	var variant *links.Variant
+	if !matched {
+		target = link.URL
+		if variant = pickVariant(c, link); variant != nil {
+			target = variant.URL
+		}
+	}
+
+	if link.ForwardPath {
+		joined, err := links.JoinPath(target, forwardedPath(c))
+		if err != nil {
+			return "", nil, err
+		}
+		target = joined
+	}
+
+	withQuery, err := links.ApplyQuery(target, c.Request.URL.RawQuery, link.QueryMode)
+	if err != nil {
+		log.Printf("failed to apply query to destination of %s: %v", link.Slug, err)
+		return target, variant, nil
+	}
+	return withQuery, variant, nil
+}
+
+// visitor describes the client for the link's targeting rules. Only the
+// parts the link has rules for are looked up.
+func (h *Handler) visitor(c *gin.Context, link *links.Link) links.Visitor {
+	var v links.Visitor
+
+	if len(link.DeviceRules) > 0 {
+		v.Client = useragent.Parse(c.Request.UserAgent(), c.Request.Header)
+	}
+
+	if len(link.LanguageRules) > 0 {
+		v.Languages = links.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	}
+
+	if len(link.CountryRules) > 0 && h.geoip != nil {
+		if addr, err := netip.ParseAddr(c.ClientIP()); err == nil {
+			v.Country = h.geoip.Country(addr)
+		}
+	}
+
+	return v
+}
+
+// statusFor returns the link's redirect status, else its domain's, else
+// the server default.
+func (h *Handler) statusFor(link *links.Link) int {
+	if link.RedirectStatus != nil {
+		return *link.RedirectStatus
+	}
+	if link.DomainID != 0 && h.domains != nil {
+		if domain := h.domains.ByID(link.DomainID); domain != nil && domain.RedirectStatus != nil {
+			return *domain.RedirectStatus
+		}
+	}
+	return h.redirectStatus
+}
+
+// cacheControl lets clients cache permanent redirects, but only for links
+// whose every visit does not need to reach the server: a cached redirect
+// would bypass password checks and click limits, and outlive the link's
+// deadline. Targeted redirects and links with a card differ per visitor,
+// so shared caches must not store them; split links must count every hit.
+func cacheControl(link *links.Link, status int, now time.Time) string {
+	if !links.IsPermanentRedirect(status) || link.HasPassword() || link.MaxClicks != nil || len(link.Variants) > 0 {
+		return "no-store"
+	}
+
+	maxAge := permanentRedirectMaxAge
+	for _, deadline := range []*time.Time{link.ActiveUntil, link.ExpiresAt} {
+		if deadline != nil {
+			maxAge = min(maxAge, deadline.Sub(now))
+		}
+	}
+	if maxAge < time.Second {
+		return "no-store"
+	}
+
+	scope := "public"
+	if link.IsTargeted() || link.HasCard() {
+		scope = "private"
+	}
+	return scope + ", max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+}
+
+func (h *Handler) abortUnavailable(c *gin.Context, err error) {
+	if isUnavailable(err) {
+		kind, status := fallbackFor(err)
+		h.abortFallback(c, kind, status)
+		return
+	}
+	log.Printf("internal server error while redirecting: %v", err)
+	c.AbortWithStatus(http.StatusInternalServerError)
+}
+
+// isBot reports whether the visitor is a bot, crawler or link preview.
+// Bots are redirected like everyone else; only the statistics differ.
+func (h *Handler) isBot(c *gin.Context) bool {
+	if h.bots == nil {
+		return false
+	}
+	return h.bots.Classify(c.Request).Bot
+}
+
+// recordClick hands the click to the asynchronous recorder; it never blocks.
+func (h *Handler) recordClick(c *gin.Context, link *links.Link, bot bool) {
+	if h.recorder == nil {
+		return
+	}
+
+	clientIP, _ := netip.ParseAddr(c.ClientIP())
+
+	h.recorder.Record(&clicks.Click{
+		LinkID:         link.ID,
+		ClickedAt:      time.Now(),
+		Referrer:       truncate(c.Request.Referer(), maxClickHeaderLength),
+		UserAgent:      truncate(c.Request.UserAgent(), maxClickHeaderLength),
+		ClientIP:       clientIP.Unmap(),
+		AcceptLanguage: truncate(c.GetHeader("Accept-Language"), maxClickHeaderLength),
+		IsBot:          bot,
+	})
+}
+
+// isUnavailable reports whether a Resolve error means the link cannot be
+// followed, as opposed to an internal failure.
+func isUnavailable(err error) bool {
+	return errors.Is(err, links.ErrLinkNotFound) ||
+		errors.Is(err, links.ErrLinkInactive) ||
+		errors.Is(err, links.ErrLinkNotStarted) ||
+		errors.Is(err, links.ErrLinkExpired) ||
+		errors.Is(err, links.ErrLinkExhausted) ||
+		errors.Is(err, links.ErrInvalidPath)
+}
+
+// truncate shortens s to at most max bytes without splitting a character.
+// Headers may be invalid UTF-8, which Postgres rejects in text columns and
+// which would fail the whole batch of clicks, so such bytes are replaced.
+func truncate(s string, max int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
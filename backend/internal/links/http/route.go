@@ -1,11 +1,26 @@
 package http
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/ratelimit"
 )
 
 func RegisterRoutes(r *gin.Engine, h *Handler) {
-	r.GET("/redirect/:slug", h.Redirect)
+	// Public routes are rate limited per client
+	public := r.Group("", h.limiter().Middleware())
+	{
+		public.GET("/redirect", h.Root)
+		public.GET("/redirect/:slug", h.Redirect)
+		public.HEAD("/redirect/:slug", h.Redirect)
+		public.POST("/redirect/:slug", h.Unlock)
+		public.GET("/redirect/:slug/*path", h.Redirect)
+		public.HEAD("/redirect/:slug/*path", h.Redirect)
+		public.POST("/redirect/:slug/*path", h.Unlock)
+		public.GET("/preview/:slug", h.Preview)
+	}
+	r.GET("/.well-known/:file", h.WellKnown)
 
 	links := r.Group("/links")
 	{
@@ -14,5 +29,57 @@ func RegisterRoutes(r *gin.Engine, h *Handler) {
 		links.GET("/:slug", h.Get)
 		links.PATCH("/:slug", h.Update)
 		links.DELETE("/:slug", h.Delete)
+		links.GET("/:slug/qr", h.QRCode)
+
+		links.GET("/:slug/variants", h.ListVariants)
+		links.POST("/:slug/variants", h.CreateVariant)
+		links.PATCH("/:slug/variants/:id", h.UpdateVariant)
+		links.DELETE("/:slug/variants/:id", h.DeleteVariant)
+
+		links.GET("/:slug/languages", h.ListLanguageRules)
+		links.PUT("/:slug/languages/:language", h.SetLanguageRule)
+		links.DELETE("/:slug/languages/:language", h.DeleteLanguageRule)
+	}
+}
+
+// RegisterRedirectRoutes serves the public redirect flow at the root path,
+// the way nginx exposes it: / for the bare domain, /{slug}, /{slug}/path for
+// prefix links, /{slug}+ for previews and the app association files.
+func RegisterRedirectRoutes(r *gin.Engine, h *Handler) {
+	r.GET("/.well-known/:file", h.WellKnown)
+
+	public := r.Group("", h.limiter().Middleware())
+	{
+		public.GET("/", h.Root)
+		public.GET("/:slug", h.redirectOrPreview)
+		public.HEAD("/:slug", h.Redirect)
+		public.POST("/:slug", h.Unlock)
+		public.GET("/:slug/*path", h.Redirect)
+		public.HEAD("/:slug/*path", h.Redirect)
+		public.POST("/:slug/*path", h.Unlock)
+	}
+}
+
+// limiter returns the rate limiter of public routes. A nil Handler, as in
+// tests of the middleware alone, has none.
+func (h *Handler) limiter() *ratelimit.Limiter {
+	if h == nil {
+		return nil
+	}
+	return h.rateLimiter
+}
+
+// redirectOrPreview shows the preview for /{slug}+ and redirects otherwise.
+func (h *Handler) redirectOrPreview(c *gin.Context) {
+	slug, ok := strings.CutSuffix(c.Param("slug"), "+")
+	if !ok {
+		h.Redirect(c)
+		return
+	}
+	for i := range c.Params {
+		if c.Params[i].Key == "slug" {
+			c.Params[i].Value = slug
+		}
 	}
+	h.Preview(c)
 }
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+)
+
+const (
+	unlockCookiePrefix = "lh_unlock_"
+
+	// Unlock attempts allowed per slug and client IP within the window; a
+	// successful one clears the count
+	maxUnlockAttempts   = 5
+	unlockAttemptWindow = 15 * time.Minute
+)
+
+// unlockSigner issues and verifies the cookie that remembers a successful
+// password unlock. The signature covers the password hash, so changing or
+// removing the password invalidates every issued cookie.
+type unlockSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func newUnlockSigner(secret []byte, ttl time.Duration) *unlockSigner {
+	if len(secret) == 0 {
+		// Cookies then only survive until restart and only work on this instance
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	}
+	if ttl <= 0 {
+		ttl = 30 * time.Minute
+	}
+	return &unlockSigner{secret: secret, ttl: ttl}
+}
+
+func (s *unlockSigner) set(c *gin.Context, link *links.Link, now time.Time) {
+	expiry := strconv.FormatInt(now.Add(s.ttl).Unix(), 10)
+	value := expiry + "." + s.sign(link, expiry)
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(unlockCookiePrefix+link.Slug, value, int(s.ttl.Seconds()), "/", "", isSecure(c), true)
+}
+
+// isSecure reports whether the visitor reached us over HTTPS, directly or
+// through the reverse proxy.
+func isSecure(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+func (s *unlockSigner) verify(c *gin.Context, link *links.Link, now time.Time) bool {
+	value, err := c.Cookie(unlockCookiePrefix + link.Slug)
+	if err != nil {
+		return false
+	}
+
+	expiry, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= expiresAt {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(s.sign(link, expiry)))
+}
+
+func (s *unlockSigner) sign(link *links.Link, expiry string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(link.Slug + "\x00" + expiry + "\x00" + link.PasswordHash))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// unlockThrottle counts password attempts per key (slug + client IP) and
+// locks the key out once the limit is reached within the window. Attempts
+// are counted before the password is checked, so concurrent guesses cannot
+// all slip through while the slow comparison runs.
+type unlockThrottle struct {
+	mu        sync.Mutex
+	attempts  map[string]*unlockAttempts
+	lastSweep time.Time
+}
+
+type unlockAttempts struct {
+	count       int
+	windowStart time.Time
+}
+
+func newUnlockThrottle() *unlockThrottle {
+	return &unlockThrottle{attempts: make(map[string]*unlockAttempts)}
+}
+
+// reserve counts an attempt for the key. If the key is locked out, nothing
+// is counted and it returns how long the lockout lasts; otherwise zero.
+func (t *unlockThrottle) reserve(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+
+	a, ok := t.attempts[key]
+	if !ok || now.Sub(a.windowStart) >= unlockAttemptWindow {
+		a = &unlockAttempts{windowStart: now}
+		t.attempts[key] = a
+	}
+	if a.count >= maxUnlockAttempts {
+		return a.windowStart.Add(unlockAttemptWindow).Sub(now)
+	}
+	a.count++
+	return 0
+}
+
+// reset clears the attempts of the key after a successful unlock.
+func (t *unlockThrottle) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+}
+
+// sweep drops expired windows so the map cannot grow without bound.
+func (t *unlockThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+
+	for key, a := range t.attempts {
+		if now.Sub(a.windowStart) >= unlockAttemptWindow {
+			delete(t.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+)
+
+const (
+	variantCookiePrefix = "lh_variant_"
+
+	// How long a sticky variant assignment is remembered
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// Private: List Variants
+func (h *Handler) ListVariants(c *gin.Context) {
+	var uri BySlug
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	variants, err := h.service.ListVariants(c.Request.Context(), domainID, uri.Slug)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, newVariantListResponse(variants))
+}
+
+// Private: Create Variant
+func (h *Handler) CreateVariant(c *gin.Context) {
+	var uri BySlug
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	var req CreateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	variant, warnings, err := h.service.CreateVariant(c.Request.Context(), domainID, uri.Slug, links.CreateVariantInput{
+		URL:    req.URL,
+		Weight: *req.Weight,
+	})
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		if isInvalidInput(err) || errors.Is(err, links.ErrTooManyVariants) {
+			c.JSON(http.StatusBadRequest, inputErrorBody(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, VariantResponse{Variant: *variant, Warnings: newPolicyWarnings(warnings)})
+}
+
+// Private: Update Variant
+func (h *Handler) UpdateVariant(c *gin.Context) {
+	var uri ByVariant
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	variant, warnings, err := h.service.UpdateVariant(c.Request.Context(), domainID, uri.Slug, uri.ID, links.UpdateVariantInput{
+		URL:    req.URL,
+		Weight: req.Weight,
+	})
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		if errors.Is(err, links.ErrVariantNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("variant not found"))
+			return
+		}
+		if isInvalidInput(err) {
+			c.JSON(http.StatusBadRequest, inputErrorBody(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, VariantResponse{Variant: *variant, Warnings: newPolicyWarnings(warnings)})
+}
+
+// Private: Delete Variant
+func (h *Handler) DeleteVariant(c *gin.Context) {
+	var uri ByVariant
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	if err := ValidateSlug(uri.Slug); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err.Error()))
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	err := h.service.DeleteVariant(c.Request.Context(), domainID, uri.Slug, uri.ID)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("link not found"))
+			return
+		}
+		if errors.Is(err, links.ErrVariantNotFound) {
+			c.JSON(http.StatusNotFound, errorBody("variant not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorBody(err.Error()))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// pickVariant chooses the variant to send the visitor to, by weight or from
+// the sticky assignment cookie. It returns nil when the link has no variant
+// with a positive weight.
+func pickVariant(c *gin.Context, link *links.Link) *links.Variant {
+	total := links.TotalWeight(link.Variants)
+	if total == 0 {
+		return nil
+	}
+
+	if link.StickyVariants {
+		if value, err := c.Cookie(variantCookiePrefix + link.Slug); err == nil {
+			id, _ := strconv.ParseInt(value, 10, 64)
+			// Paused or deleted variants are reassigned
+			if variant := links.FindVariant(link.Variants, id); variant != nil && variant.Weight > 0 {
+				return variant
+			}
+		}
+	}
+
+	return links.PickVariant(link.Variants, rand.IntN(total))
+}
+
+// countVariantHit counts the hit and remembers the assignment for sticky
+// links. Hits of bots are not counted, so they do not skew the comparison.
+// A failed count does not fail the redirect.
+func (h *Handler) countVariantHit(c *gin.Context, link *links.Link, variant *links.Variant, bot bool) {
+	if !bot {
+		if err := h.service.CountVariantHit(c.Request.Context(), variant); err != nil {
+			log.Printf("failed to count hit of variant %d of %s: %v", variant.ID, link.Slug, err)
+		}
+	}
+
+	if link.StickyVariants {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(variantCookiePrefix+link.Slug, strconv.FormatInt(variant.ID, 10), int(variantCookieMaxAge.Seconds()), "/", "", isSecure(c), true)
+	}
+}
@@ -0,0 +1,209 @@
+package links
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLanguageRules bounds the number of language rules of a single link.
+	maxLanguageRules = 50
+	// maxAcceptLanguages bounds how many Accept-Language entries are considered.
+	maxAcceptLanguages = 20
+)
+
+// languageTagRegex accepts the language[-script][-region] subset of BCP 47
+// that localized sites are keyed on, e.g. "zh", "zh-TW", "zh-Hant-TW",
+// "es-419".
+var languageTagRegex = regexp.MustCompile(`^([a-zA-Z]{2,3})(-[a-zA-Z]{4})?(-[a-zA-Z]{2}|-[0-9]{3})?$`)
+
+// LanguageRule sends visitors preferring a language to a localized
+// destination.
+type LanguageRule struct {
+	// Language is a BCP 47 tag in canonical case, e.g. "zh-Hant-TW"
+	Language string `json:"language"`
+	URL      string `json:"url"`
+}
+
+// NormalizeLanguageTag validates tag and returns it in canonical case
+// (language lower-case, script title-case, region upper-case).
+func NormalizeLanguageTag(tag string) (string, error) {
+	m := languageTagRegex.FindStringSubmatch(strings.TrimSpace(tag))
+	if m == nil {
+		return "", fmt.Errorf("%w: %q is not a supported language tag", ErrInvalidLanguageRule, tag)
+	}
+
+	normalized := strings.ToLower(m[1])
+	if m[2] != "" {
+		script := strings.ToLower(m[2][1:])
+		normalized += "-" + strings.ToUpper(script[:1]) + script[1:]
+	}
+	if m[3] != "" {
+		normalized += "-" + strings.ToUpper(m[3][1:])
+	}
+	return normalized, nil
+}
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language
+// header, most preferred first. Entries with q=0, the "*" wildcard and
+// malformed entries are skipped; entries with equal weight keep their order.
+func ParseAcceptLanguage(header string) []string {
+	type entry struct {
+		tag string
+		q   float64
+	}
+
+	var entries []entry
+	for part := range strings.SplitSeq(header, ",") {
+		if len(entries) == maxAcceptLanguages {
+			break
+		}
+
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if params != "" {
+			name, value, ok := strings.Cut(strings.TrimSpace(params), "=")
+			if !ok || strings.TrimSpace(name) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				continue
+			}
+			q = parsed
+		}
+		if q == 0 {
+			continue
+		}
+
+		entries = append(entries, entry{tag: tag, q: q})
+	}
+
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	tags := make([]string, len(entries))
+	for i, e := range entries {
+		tags[i] = e.tag
+	}
+	return tags
+}
+
+// languageFallbacks returns the tags to try for a requested tag, most
+// specific first: "zh-Hant-TW" gives zh-Hant-TW, zh-TW, zh-Hant, zh.
+// Subtags we do not key rules on (variants, extensions) are ignored.
+func languageFallbacks(tag string) []string {
+	subtags := strings.Split(tag, "-")
+	language := subtags[0]
+
+	var script, region string
+	for _, subtag := range subtags[1:] {
+		switch {
+		case script == "" && region == "" && len(subtag) == 4 && isAlpha(subtag):
+			script = subtag
+		case region == "" && (len(subtag) == 2 && isAlpha(subtag) || len(subtag) == 3 && isDigits(subtag)):
+			region = subtag
+		}
+	}
+
+	var candidates []string
+	add := func(parts ...string) {
+		var nonEmpty []string
+		for _, p := range parts {
+			if p != "" {
+				nonEmpty = append(nonEmpty, p)
+			}
+		}
+		if candidate, err := NormalizeLanguageTag(strings.Join(nonEmpty, "-")); err == nil && !slices.Contains(candidates, candidate) {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	add(language, script, region)
+	add(language, region)
+	add(language, script)
+	add(language)
+
+	return candidates
+}
+
+// languageURL returns the destination of the best language rule for the
+// visitor's preferences, in order.
+func (l *Link) languageURL(preferences []string) (string, bool) {
+	if len(l.LanguageRules) == 0 {
+		return "", false
+	}
+
+	for _, preference := range preferences {
+		for _, candidate := range languageFallbacks(preference) {
+			for _, rule := range l.LanguageRules {
+				if rule.Language == candidate {
+					return rule.URL, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// normalizeLanguageRules canonicalizes the tags and rejects invalid or
+// duplicate tags.
+func normalizeLanguageRules(rules []LanguageRule) ([]LanguageRule, error) {
+	if len(rules) > maxLanguageRules {
+		return nil, fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidLanguageRule, maxLanguageRules)
+	}
+
+	normalized := make([]LanguageRule, 0, len(rules))
+	seen := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		language, err := NormalizeLanguageTag(rule.Language)
+		if err != nil {
+			return nil, err
+		}
+		if seen[language] {
+			return nil, fmt.Errorf("%w: duplicate language %s", ErrInvalidLanguageRule, language)
+		}
+		if rule.URL == "" {
+			return nil, fmt.Errorf("%w: missing url for %s", ErrInvalidLanguageRule, language)
+		}
+		seen[language] = true
+
+		normalized = append(normalized, LanguageRule{Language: language, URL: rule.URL})
+	}
+
+	return normalized, nil
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+)
+
+// JoinPath appends the extra path of a request to a prefix link's
+// destination, e.g. "api/v2" onto "https://docs.example.com" gives
+// "https://docs.example.com/api/v2". Segments are escaped individually and
+// "." or ".." segments are rejected, so the result always stays under the
+// destination's host and path. The destination's query and fragment are
+// kept.
+func JoinPath(destination, extra string) (string, error) {
+	var segments []string
+	for segment := range strings.SplitSeq(extra, "/") {
+		switch segment {
+		case "":
+			continue
+		case ".", "..":
+			return "", ErrInvalidPath
+		}
+		segments = append(segments, url.PathEscape(segment))
+	}
+	if len(segments) == 0 {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	joined := u.JoinPath(segments...)
+	if strings.HasSuffix(extra, "/") && !strings.HasSuffix(joined.Path, "/") {
+		joined = joined.JoinPath("/")
+	}
+
+	return joined.String(), nil
+}
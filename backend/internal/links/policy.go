@@ -0,0 +1,55 @@
+package links
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+)
+
+// URLPolicy vets the destinations of links when they are created or
+// updated; *urlpolicy.Policy is the usual one.
+type URLPolicy interface {
+	// Check returns an error if rawURL may not be a destination, else the
+	// warnings about it, if any.
+	Check(rawURL string) ([]urlpolicy.Warning, error)
+}
+
+// checkURL applies the service's checks to a destination of the link key:
+// short links must pass checkChain, other URLs the URL policy, whose
+// warnings are added to warnings.
+func (s *service) checkURL(ctx context.Context, key linkKey, rawURL string, warnings *[]urlpolicy.Warning) error {
+	if u, err := url.Parse(rawURL); err == nil {
+		if target, ok := s.shortLink(u); ok {
+			return s.checkChain(ctx, key, target)
+		}
+	}
+	found, err := s.policy.Check(rawURL)
+	if err != nil {
+		return err
+	}
+	*warnings = append(*warnings, found...)
+	return nil
+}
+
+// checkDeepLinkURL is checkURL for the URLs of deep links. App URLs may use
+// the app's own scheme, so only web URLs are subject to the URL policy.
+// Deep links never chain: a web URL on a short domain is a loop.
+func (s *service) checkDeepLinkURL(rawURL string, warnings *[]urlpolicy.Warning) error {
+	u, err := url.Parse(rawURL)
+	if err == nil && !strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https") {
+		return nil
+	}
+	if err == nil {
+		if _, ok := s.shortLink(u); ok {
+			return ErrRedirectLoop
+		}
+	}
+	found, err := s.policy.Check(rawURL)
+	if err != nil {
+		return err
+	}
+	*warnings = append(*warnings, found...)
+	return nil
+}
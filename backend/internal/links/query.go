@@ -0,0 +1,132 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+)
+
+// QueryMode controls what happens to the query string of the short link
+// request when redirecting.
+type QueryMode string
+
+const (
+	// QueryOff drops the incoming query string.
+	QueryOff QueryMode = "off"
+	// QueryAppend appends every incoming parameter after the destination's
+	// own, keeping duplicate keys.
+	QueryAppend QueryMode = "append"
+	// QueryOverride merges both, with incoming parameters replacing every
+	// destination parameter of the same key.
+	QueryOverride QueryMode = "override"
+	// QueryPreserve merges both, with destination parameters winning: an
+	// incoming parameter is only added if the destination lacks its key.
+	QueryPreserve QueryMode = "preserve"
+)
+
+// ValidQueryMode reports whether mode is one of the supported modes.
+func ValidQueryMode(mode QueryMode) bool {
+	switch mode {
+	case QueryOff, QueryAppend, QueryOverride, QueryPreserve:
+		return true
+	}
+	return false
+}
+
+// ApplyQuery returns the destination with the incoming raw query string
+// carried over according to mode. Parameters are copied in their original
+// encoding and order, so already-encoded values are never double-encoded;
+// the destination's fragment is kept at the end. Malformed incoming
+// parameters are dropped.
+func ApplyQuery(destination, incoming string, mode QueryMode) (string, error) {
+	if mode == "" || mode == QueryOff || incoming == "" {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	dest := splitQuery(u.RawQuery, false)
+	in := splitQuery(incoming, true)
+	if len(in) == 0 {
+		return destination, nil
+	}
+
+	var merged []queryParam
+	switch mode {
+	case QueryAppend:
+		merged = append(dest, in...)
+	case QueryOverride:
+		overridden := keySet(in)
+		for _, p := range dest {
+			if !overridden[p.key] {
+				merged = append(merged, p)
+			}
+		}
+		merged = append(merged, in...)
+	case QueryPreserve:
+		kept := keySet(dest)
+		merged = dest
+		for _, p := range in {
+			if !kept[p.key] {
+				merged = append(merged, p)
+			}
+		}
+	default:
+		return destination, nil
+	}
+
+	raw := make([]string, len(merged))
+	for i, p := range merged {
+		raw[i] = p.raw
+	}
+	u.RawQuery = strings.Join(raw, "&")
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// queryParam is a single key=value pair, kept in its raw form with the
+// decoded key used for comparisons.
+type queryParam struct {
+	key string
+	raw string
+}
+
+// splitQuery splits a raw query string into its parameters. When strict,
+// parameters that are not validly encoded are dropped; otherwise they are
+// kept verbatim and compared by their raw key.
+func splitQuery(rawQuery string, strict bool) []queryParam {
+	var params []queryParam
+
+	for raw := range strings.SplitSeq(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+
+		rawKey, rawValue, _ := strings.Cut(raw, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err == nil {
+			_, err = url.QueryUnescape(rawValue)
+		}
+		if err != nil {
+			if strict {
+				continue
+			}
+			key = rawKey
+		}
+
+		params = append(params, queryParam{key: key, raw: raw})
+	}
+
+	return params
+}
+
+func keySet(params []queryParam) map[string]bool {
+	keys := make(map[string]bool, len(params))
+	for _, p := range params {
+		keys[p.key] = true
+	}
+	return keys
+}
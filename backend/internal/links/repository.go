@@ -4,24 +4,78 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// uniqueViolation is the Postgres error code for a duplicate key, like a
+// slug already taken on its domain
+const uniqueViolation = "23505"
+
 var (
-	ErrLinkNotFound = errors.New("link not found")
+	ErrLinkNotFound    = errors.New("link not found")
+	ErrVariantNotFound = errors.New("variant not found")
 )
 
 type Repository interface {
-	Create(ctx context.Context, slug string, url string) error
-	GetBySlug(ctx context.Context, slug string) (*Link, error)
+	// Create stores a new link, under link.ID if it is set. It returns
+	// ErrSlugTaken if the slug is in use on the domain.
+	Create(ctx context.Context, link *Link) error
+	// NextID reserves an ID for a link to be created.
+	NextID(ctx context.Context) (int64, error)
+	// GetBySlug finds a link by its slug on a domain; 0 is the primary domain.
+	GetBySlug(ctx context.Context, domainID int64, slug string) (*Link, error)
 	Update(ctx context.Context, link *Link) error
-	Delete(ctx context.Context, slug string) error
+	Delete(ctx context.Context, domainID int64, slug string) error
 	List(ctx context.Context, opts ListOptions) ([]*Link, int64, error)
+	// ConsumeClick atomically counts one click against the link's limit.
+	// It returns ErrLinkExhausted if no clicks are left.
+	ConsumeClick(ctx context.Context, id int64) error
+
+	ListVariants(ctx context.Context, linkID int64) ([]Variant, error)
+	// CreateVariant stores the variant, or returns ErrTooManyVariants if
+	// its link has maxVariants already. Concurrent creates are counted one
+	// after the other.
+	CreateVariant(ctx context.Context, variant *Variant) error
+	UpdateVariant(ctx context.Context, variant *Variant) error
+	DeleteVariant(ctx context.Context, linkID, id int64) error
+	// AddVariantHits adds hits, by variant ID, to the variants' counters in
+	// one statement. Deleted variants are ignored.
+	AddVariantHits(ctx context.Context, hits map[int64]int64) error
+	// UpdateLanguageRules replaces the language rules of a link with the
+	// result of update, which is given the current ones. The link is locked
+	// meanwhile, so concurrent updates cannot overwrite each other. An error
+	// from update is returned and nothing is changed.
+	UpdateLanguageRules(ctx context.Context, linkID int64, update func([]LanguageRule) ([]LanguageRule, error)) ([]LanguageRule, error)
+}
+
+var linkColumns = []string{
+	"id", "domain_id", "slug", "url", "is_active", "active_from", "active_until",
+	"expires_at", "max_clicks", "click_count", "password_hash", "redirect_status", "query_mode", "forward_path", "country_rules", "device_rules", "language_rules", "deep_link", "og_title", "og_description", "og_image_url", "sticky_variants", "created_at", "updated_at",
+}
+
+const (
+	// expiredCondition matches links past their deadline or out of clicks
+	expiredCondition = "((active_until IS NOT NULL AND active_until <= CURRENT_TIMESTAMP) OR " +
+		"(expires_at IS NOT NULL AND expires_at <= CURRENT_TIMESTAMP) OR " +
+		"(max_clicks IS NOT NULL AND click_count >= max_clicks))"
+	// scheduledCondition matches links whose activation window has not opened yet
+	scheduledCondition = "(active_from IS NOT NULL AND active_from > CURRENT_TIMESTAMP)"
+)
+
+// statusConditions mirror Link.Status in SQL
+var statusConditions = map[Status]sq.Sqlizer{
+	StatusDisabled:  sq.Eq{"is_active": false},
+	StatusScheduled: sq.And{sq.Eq{"is_active": true}, sq.Expr(scheduledCondition)},
+	StatusEnded:     sq.And{sq.Eq{"is_active": true}, sq.Expr("NOT " + scheduledCondition), sq.Expr(expiredCondition)},
+	StatusLive:      sq.And{sq.Eq{"is_active": true}, sq.Expr("NOT " + scheduledCondition), sq.Expr("NOT " + expiredCondition)},
 }
 
 type repository struct {
@@ -36,27 +90,56 @@ func NewRepository(db *pgxpool.Pool) Repository {
 	}
 }
 
-func (r *repository) Create(ctx context.Context, slug string, url string) error {
+func (r *repository) Create(ctx context.Context, link *Link) error {
+	if link.QueryMode == "" {
+		link.QueryMode = QueryOff
+	}
+
+	columns := []string{"domain_id", "slug", "url", "active_from", "active_until", "expires_at", "max_clicks", "password_hash", "redirect_status", "query_mode", "forward_path", "country_rules", "device_rules", "deep_link", "og_title", "og_description", "og_image_url", "sticky_variants"}
+	values := []any{nullIfZero(link.DomainID), link.Slug, link.URL, link.ActiveFrom, link.ActiveUntil, link.ExpiresAt, link.MaxClicks, nullIfEmpty(link.PasswordHash), link.RedirectStatus, link.QueryMode, link.ForwardPath, jsonList(link.CountryRules), jsonList(link.DeviceRules), link.DeepLink, nullIfEmpty(link.OGTitle), nullIfEmpty(link.OGDescription), nullIfEmpty(link.OGImageURL), link.StickyVariants}
+	if link.ID != 0 {
+		columns = append(columns, "id")
+		values = append(values, link.ID)
+	}
+
 	query := r.sb.Insert("links").
-		Columns("slug", "url").
-		Values(slug, url)
+		Columns(columns...).
+		Values(values...).
+		Suffix("RETURNING id, is_active, click_count, created_at, updated_at")
 
 	sqlStr, args, err := query.ToSql()
 	if err != nil {
 		return err
 	}
 
-	_, err = r.db.Exec(ctx, sqlStr, args...)
+	err = r.db.QueryRow(ctx, sqlStr, args...).Scan(
+		&link.ID,
+		&link.IsActive,
+		&link.ClickCount,
+		&link.CreatedAt,
+		&link.UpdatedAt,
+	)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrSlugTaken
+		}
 		return err
 	}
 
 	return nil
 }
 
-func (r *repository) GetBySlug(ctx context.Context, slug string) (*Link, error) {
-	query := r.sb.Select("id", "slug", "url", "is_active", "created_at", "updated_at").
+func (r *repository) NextID(ctx context.Context) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(ctx, "SELECT nextval(pg_get_serial_sequence('links', 'id'))").Scan(&id)
+	return id, err
+}
+
+func (r *repository) GetBySlug(ctx context.Context, domainID int64, slug string) (*Link, error) {
+	query := r.sb.Select(linkColumns...).
 		From("links").
+		Where(domainEq(domainID)).
 		Where(sq.Eq{"slug": slug})
 
 	sqlStr, args, err := query.ToSql()
@@ -64,17 +147,7 @@ func (r *repository) GetBySlug(ctx context.Context, slug string) (*Link, error)
 		return nil, err
 	}
 
-	var link Link
-
-	err = r.db.QueryRow(ctx, sqlStr, args...).Scan(
-		&link.ID,
-		&link.Slug,
-		&link.URL,
-		&link.IsActive,
-		&link.CreatedAt,
-		&link.UpdatedAt,
-	)
-
+	link, err := scanLink(r.db.QueryRow(ctx, sqlStr, args...))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrLinkNotFound
@@ -82,15 +155,30 @@ func (r *repository) GetBySlug(ctx context.Context, slug string) (*Link, error)
 		return nil, err
 	}
 
-	return &link, nil
+	return link, nil
 }
 
 func (r *repository) Update(ctx context.Context, link *Link) error {
 	query := r.sb.Update("links").
 		Set("url", link.URL).
 		Set("is_active", link.IsActive).
+		Set("active_from", link.ActiveFrom).
+		Set("active_until", link.ActiveUntil).
+		Set("expires_at", link.ExpiresAt).
+		Set("max_clicks", link.MaxClicks).
+		Set("password_hash", nullIfEmpty(link.PasswordHash)).
+		Set("redirect_status", link.RedirectStatus).
+		Set("query_mode", link.QueryMode).
+		Set("forward_path", link.ForwardPath).
+		Set("country_rules", jsonList(link.CountryRules)).
+		Set("device_rules", jsonList(link.DeviceRules)).
+		Set("deep_link", link.DeepLink).
+		Set("og_title", nullIfEmpty(link.OGTitle)).
+		Set("og_description", nullIfEmpty(link.OGDescription)).
+		Set("og_image_url", nullIfEmpty(link.OGImageURL)).
+		Set("sticky_variants", link.StickyVariants).
 		Set("updated_at", time.Now()).
-		Where(sq.Eq{"slug": link.Slug})
+		Where(sq.Eq{"id": link.ID})
 
 	sqlStr, args, err := query.ToSql()
 	if err != nil {
@@ -109,8 +197,9 @@ func (r *repository) Update(ctx context.Context, link *Link) error {
 	return nil
 }
 
-func (r *repository) Delete(ctx context.Context, slug string) error {
+func (r *repository) Delete(ctx context.Context, domainID int64, slug string) error {
 	query := r.sb.Delete("links").
+		Where(domainEq(domainID)).
 		Where(sq.Eq{"slug": slug})
 
 	sqlStr, args, err := query.ToSql()
@@ -131,13 +220,29 @@ func (r *repository) Delete(ctx context.Context, slug string) error {
 }
 
 func (r *repository) List(ctx context.Context, opts ListOptions) ([]*Link, int64, error) {
-	baseQuery := r.sb.Select("id", "slug", "url", "is_active", "created_at", "updated_at").
+	baseQuery := r.sb.Select(linkColumns...).
 		From("links")
 
+	if opts.DomainID != nil {
+		baseQuery = baseQuery.Where(domainEq(*opts.DomainID))
+	}
+
 	if opts.IsActive != nil {
 		baseQuery = baseQuery.Where(sq.Eq{"is_active": *opts.IsActive})
 	}
 
+	if opts.Expired != nil {
+		if *opts.Expired {
+			baseQuery = baseQuery.Where(expiredCondition)
+		} else {
+			baseQuery = baseQuery.Where("NOT " + expiredCondition)
+		}
+	}
+
+	if condition, ok := statusConditions[opts.Status]; ok {
+		baseQuery = baseQuery.Where(condition)
+	}
+
 	if opts.Keyword != "" {
 		// Escape special characters for ILIKE
 		escaper := strings.NewReplacer(
@@ -205,20 +310,344 @@ func (r *repository) List(ctx context.Context, opts ListOptions) ([]*Link, int64
 
 	var links []*Link
 	for rows.Next() {
-		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.Slug,
-			&link.URL,
-			&link.IsActive,
-			&link.CreatedAt,
-			&link.UpdatedAt,
-		)
+		link, err := scanLink(rows)
 		if err != nil {
 			return nil, 0, err
 		}
-		links = append(links, &link)
+		links = append(links, link)
 	}
 
 	return links, total, nil
 }
+
+func (r *repository) ConsumeClick(ctx context.Context, id int64) error {
+	// A single conditional UPDATE takes the row lock and re-checks the limit,
+	// so concurrent redirects (even across instances) can never overspend.
+	query := r.sb.Update("links").
+		Set("click_count", sq.Expr("click_count + 1")).
+		Where(sq.Eq{"id": id}).
+		Where(sq.Or{
+			sq.Eq{"max_clicks": nil},
+			sq.Expr("click_count < max_clicks"),
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrLinkExhausted
+	}
+
+	return nil
+}
+
+// variantColumns are the columns scanVariant expects, in order
+var variantColumns = []string{"id", "link_id", "url", "weight", "hit_count", "created_at", "updated_at"}
+
+func (r *repository) ListVariants(ctx context.Context, linkID int64) ([]Variant, error) {
+	query := r.sb.Select(variantColumns...).
+		From("link_variants").
+		Where(sq.Eq{"link_id": linkID}).
+		OrderBy("id ASC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []Variant{}
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, *variant)
+	}
+
+	return variants, rows.Err()
+}
+
+func (r *repository) CreateVariant(ctx context.Context, variant *Variant) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the link makes concurrent creates wait for each other's count
+	lockQuery := r.sb.Select("id").
+		From("links").
+		Where(sq.Eq{"id": variant.LinkID}).
+		Suffix("FOR UPDATE")
+
+	sqlStr, args, err := lockQuery.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var linkID int64
+	if err := tx.QueryRow(ctx, sqlStr, args...).Scan(&linkID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLinkNotFound
+		}
+		return err
+	}
+
+	countQuery := r.sb.Select("COUNT(*)").
+		From("link_variants").
+		Where(sq.Eq{"link_id": variant.LinkID})
+
+	sqlStr, args, err = countQuery.ToSql()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, sqlStr, args...).Scan(&count); err != nil {
+		return err
+	}
+	if count >= maxVariants {
+		return ErrTooManyVariants
+	}
+
+	insertQuery := r.sb.Insert("link_variants").
+		Columns("link_id", "url", "weight").
+		Values(variant.LinkID, variant.URL, variant.Weight).
+		Suffix("RETURNING id, hit_count, created_at, updated_at")
+
+	sqlStr, args, err = insertQuery.ToSql()
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(
+		&variant.ID,
+		&variant.HitCount,
+		&variant.CreatedAt,
+		&variant.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *repository) UpdateVariant(ctx context.Context, variant *Variant) error {
+	query := r.sb.Update("link_variants").
+		Set("url", variant.URL).
+		Set("weight", variant.Weight).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"id": variant.ID, "link_id": variant.LinkID}).
+		Suffix("RETURNING hit_count, updated_at")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	err = r.db.QueryRow(ctx, sqlStr, args...).Scan(&variant.HitCount, &variant.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrVariantNotFound
+	}
+	return err
+}
+
+func (r *repository) DeleteVariant(ctx context.Context, linkID, id int64) error {
+	query := r.sb.Delete("link_variants").
+		Where(sq.Eq{"id": id, "link_id": linkID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrVariantNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) AddVariantHits(ctx context.Context, hits map[int64]int64) error {
+	ids := slices.Sorted(maps.Keys(hits))
+	counts := make([]int64, len(ids))
+	for i, id := range ids {
+		counts[i] = hits[id]
+	}
+
+	_, err := r.db.Exec(ctx, `
+UPDATE link_variants AS v
+SET hit_count = v.hit_count + h.hits
+FROM unnest($1::bigint[], $2::bigint[]) AS h(id, hits)
+WHERE v.id = h.id`, ids, counts)
+	return err
+}
+
+func (r *repository) UpdateLanguageRules(ctx context.Context, linkID int64, update func([]LanguageRule) ([]LanguageRule, error)) ([]LanguageRule, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	selectQuery := r.sb.Select("language_rules").
+		From("links").
+		Where(sq.Eq{"id": linkID}).
+		Suffix("FOR UPDATE")
+
+	sqlStr, args, err := selectQuery.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []LanguageRule
+	if err := tx.QueryRow(ctx, sqlStr, args...).Scan(&rules); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLinkNotFound
+		}
+		return nil, err
+	}
+
+	rules, err = update(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	updateQuery := r.sb.Update("links").
+		Set("language_rules", jsonList(rules)).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"id": linkID})
+
+	sqlStr, args, err = updateQuery.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func scanVariant(row pgx.Row) (*Variant, error) {
+	var variant Variant
+
+	err := row.Scan(
+		&variant.ID,
+		&variant.LinkID,
+		&variant.URL,
+		&variant.Weight,
+		&variant.HitCount,
+		&variant.CreatedAt,
+		&variant.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &variant, nil
+}
+
+// scanLink scans a row selected with linkColumns
+func scanLink(row pgx.Row) (*Link, error) {
+	var link Link
+	var domainID *int64
+	var passwordHash *string
+	var ogTitle, ogDescription, ogImageURL *string
+
+	err := row.Scan(
+		&link.ID,
+		&domainID,
+		&link.Slug,
+		&link.URL,
+		&link.IsActive,
+		&link.ActiveFrom,
+		&link.ActiveUntil,
+		&link.ExpiresAt,
+		&link.MaxClicks,
+		&link.ClickCount,
+		&passwordHash,
+		&link.RedirectStatus,
+		&link.QueryMode,
+		&link.ForwardPath,
+		&link.CountryRules,
+		&link.DeviceRules,
+		&link.LanguageRules,
+		&link.DeepLink,
+		&ogTitle,
+		&ogDescription,
+		&ogImageURL,
+		&link.StickyVariants,
+		&link.CreatedAt,
+		&link.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if domainID != nil {
+		link.DomainID = *domainID
+	}
+	if passwordHash != nil {
+		link.PasswordHash = *passwordHash
+	}
+	link.OGTitle = valueOrEmpty(ogTitle)
+	link.OGDescription = valueOrEmpty(ogDescription)
+	link.OGImageURL = valueOrEmpty(ogImageURL)
+
+	return &link, nil
+}
+
+// domainEq matches the links of a domain; 0 is the primary domain, whose
+// links have no domain_id.
+func domainEq(domainID int64) sq.Eq {
+	if domainID == 0 {
+		return sq.Eq{"domain_id": nil}
+	}
+	return sq.Eq{"domain_id": domainID}
+}
+
+func nullIfZero(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// jsonList returns a list for a JSONB column, which does not accept null.
+func jsonList[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
@@ -3,80 +3,599 @@ package links
 import (
 	"context"
 	"errors"
-	"strings"
+	"log"
+	"slices"
 	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/slugs"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrSlugTaken    = errors.New("slug already taken")
-	ErrRedirectLoop = errors.New("target url cannot contain redirect domain")
+	ErrSlugTaken      = errors.New("slug already taken")
+	ErrNoFreeSlug     = errors.New("could not generate a free slug")
+	ErrRedirectLoop   = errors.New("target url cannot contain redirect domain")
+	ErrRedirectCycle  = errors.New("target url redirects back to the link")
+	ErrChainTooLong   = errors.New("target url starts too long a chain of short links")
+	ErrLinkInactive   = errors.New("link is inactive")
+	ErrLinkNotStarted = errors.New("link is not active yet")
+	ErrInvalidWindow  = errors.New("active_from must be before active_until")
+	ErrLinkExpired    = errors.New("link has expired")
+	ErrLinkExhausted  = errors.New("link has reached its click limit")
+	ErrInvalidPath    = errors.New("forwarded path is not allowed")
+
+	ErrInvalidCountryRule = errors.New("invalid country rule")
+	ErrInvalidDeviceRule  = errors.New("invalid device rule")
+	ErrInvalidDeepLink    = errors.New("invalid deep link")
+	ErrTooManyVariants    = errors.New("too many variants")
+
+	ErrInvalidLanguageRule  = errors.New("invalid language rule")
+	ErrLanguageRuleNotFound = errors.New("language rule not found")
 )
 
+const (
+	// maxSlugAttempts bounds the candidates tried for a generated slug
+	maxSlugAttempts = 20
+	// slugCollisionsToGrow is how many generated slugs in a row may be
+	// taken before slugs are made longer
+	slugCollisionsToGrow = 3
+)
+
+// Service manages links. Links are addressed by their domain ID and slug,
+// where domain 0 is the primary redirect domain.
 type Service interface {
-	Create(ctx context.Context, slug, url string) error
-	Get(ctx context.Context, slug string) (*Link, error)
+	// Create stores a new link and returns it, with the URL policy's
+	// warnings about its destinations. Without a slug in input, one is
+	// generated.
+	Create(ctx context.Context, input CreateLinkInput) (*Link, []urlpolicy.Warning, error)
+	Get(ctx context.Context, domainID int64, slug string) (*Link, error)
+	// Resolve returns the link to follow for a redirect. Links that cannot
+	// be followed yield ErrLinkInactive, ErrLinkNotStarted, ErrLinkExpired
+	// or ErrLinkExhausted.
+	Resolve(ctx context.Context, domainID int64, slug string) (*Link, error)
+	// Consume counts a redirect against the link's click limit, if any. It
+	// must be called right before the redirect is actually served.
+	Consume(ctx context.Context, link *Link) error
 	List(ctx context.Context, opts ListOptions) ([]*Link, int64, error)
-	Update(ctx context.Context, slug string, url *string, isActive *bool) error
-	Delete(ctx context.Context, slug string) error
+	// Update changes the link, returning the URL policy's warnings about
+	// the destinations it sets.
+	Update(ctx context.Context, domainID int64, slug string, input UpdateLinkInput) ([]urlpolicy.Warning, error)
+	Delete(ctx context.Context, domainID int64, slug string) error
+
+	ListVariants(ctx context.Context, domainID int64, slug string) ([]Variant, error)
+	CreateVariant(ctx context.Context, domainID int64, slug string, input CreateVariantInput) (*Variant, []urlpolicy.Warning, error)
+	UpdateVariant(ctx context.Context, domainID int64, slug string, id int64, input UpdateVariantInput) (*Variant, []urlpolicy.Warning, error)
+	DeleteVariant(ctx context.Context, domainID int64, slug string, id int64) error
+	// CountVariantHit counts a redirect served to the variant.
+	CountVariantHit(ctx context.Context, variant *Variant) error
+
+	ListLanguageRules(ctx context.Context, domainID int64, slug string) ([]LanguageRule, error)
+	// SetLanguageRule adds the rule, or replaces the URL of the existing
+	// rule for the same language, and returns the link's updated rules and
+	// the URL policy's warnings about the rule's URL.
+	SetLanguageRule(ctx context.Context, domainID int64, slug string, rule LanguageRule) ([]LanguageRule, []urlpolicy.Warning, error)
+	DeleteLanguageRule(ctx context.Context, domainID int64, slug, language string) error
 }
 
 type service struct {
-	repo           Repository
-	redirectDomain string
+	repo          Repository
+	redirectHost  string
+	redirectPort  string
+	domains       DomainLookup
+	maxChainDepth int
+	cache         *ResolveCache
+	policy        URLPolicy
+	slugs         *slugs.Generator
+	hits          *HitCounter
+}
+
+// ServiceOptions configures the optional parts of a Service.
+type ServiceOptions struct {
+	// Cache serves Resolve from memory when possible. Changes made through
+	// the service invalidate it right away; changes made by other
+	// instances must be reported to Cache.Invalidate. nil disables caching.
+	Cache *ResolveCache
+	// Policy vets the destinations of links on create and update; nil uses
+	// urlpolicy.Default()
+	Policy URLPolicy
+	// Domains are the short domains besides the redirect domain, whose
+	// URLs are short links too; nil only knows the redirect domain
+	Domains DomainLookup
+	// MaxChainDepth allows destinations that are short links themselves,
+	// as long as following them reaches another site within this many
+	// short links and never the link itself. 0 rejects them as
+	// ErrRedirectLoop.
+	MaxChainDepth int
+	// Slugs generates the slugs of links created without one; nil uses
+	// slugs.Default()
+	Slugs *slugs.Generator
+	// Hits batches the hits of variants in the background; nil writes each
+	// hit as it is counted, on the redirect's path
+	Hits *HitCounter
 }
 
 func NewService(repo Repository, redirectDomain string) Service {
+	return NewServiceWithOptions(repo, redirectDomain, ServiceOptions{})
+}
+
+func NewServiceWithOptions(repo Repository, redirectDomain string, opts ServiceOptions) Service {
+	policy := opts.Policy
+	if policy == nil {
+		policy = urlpolicy.Default()
+	}
+	generator := opts.Slugs
+	if generator == nil {
+		generator = slugs.Default()
+	}
+	redirectHost, redirectPort := splitDomain(redirectDomain)
 	return &service{
-		repo:           repo,
-		redirectDomain: redirectDomain,
+		repo:          repo,
+		redirectHost:  redirectHost,
+		redirectPort:  redirectPort,
+		domains:       opts.Domains,
+		maxChainDepth: opts.MaxChainDepth,
+		cache:         opts.Cache,
+		policy:        policy,
+		slugs:         generator,
+		hits:          opts.Hits,
 	}
 }
 
-func (s *service) Create(ctx context.Context, slug, url string) error {
-	if strings.Contains(url, s.redirectDomain) {
-		return ErrRedirectLoop
+func (s *service) Create(ctx context.Context, input CreateLinkInput) (*Link, []urlpolicy.Warning, error) {
+	key := linkKey{input.DomainID, input.Slug}
+	var warnings []urlpolicy.Warning
+	if err := s.checkURL(ctx, key, input.URL, &warnings); err != nil {
+		return nil, nil, err
+	}
+	if !validWindow(input.ActiveFrom, input.ActiveUntil) {
+		return nil, nil, ErrInvalidWindow
+	}
+	countryRules, err := s.countryRules(ctx, key, input.CountryRules, &warnings)
+	if err != nil {
+		return nil, nil, err
+	}
+	deviceRules, err := s.deviceRules(ctx, key, input.DeviceRules, &warnings)
+	if err != nil {
+		return nil, nil, err
+	}
+	deepLink, err := s.deepLink(input.DeepLink, &warnings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	passwordHash, err := hashPassword(input.Password)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Check if slug exists
-	_, err := s.repo.GetBySlug(ctx, slug)
-	if err == nil {
-		return ErrSlugTaken
+	link := &Link{
+		DomainID:       input.DomainID,
+		Slug:           input.Slug,
+		URL:            input.URL,
+		ActiveFrom:     input.ActiveFrom,
+		ActiveUntil:    input.ActiveUntil,
+		ExpiresAt:      input.ExpiresAt,
+		MaxClicks:      input.MaxClicks,
+		PasswordHash:   passwordHash,
+		RedirectStatus: input.RedirectStatus,
+		QueryMode:      input.QueryMode,
+		ForwardPath:    input.ForwardPath,
+		CountryRules:   countryRules,
+		DeviceRules:    deviceRules,
+		DeepLink:       deepLink,
+		OGTitle:        input.OGTitle,
+		OGDescription:  input.OGDescription,
+		OGImageURL:     input.OGImageURL,
+		StickyVariants: input.StickyVariants,
 	}
-	if !errors.Is(err, ErrLinkNotFound) {
-		return err
+	if link.Slug == "" {
+		err = s.createWithGeneratedSlug(ctx, link)
+	} else {
+		err = s.repo.Create(ctx, link)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return s.repo.Create(ctx, slug, url)
+	// The slug may be cached as unknown
+	s.cache.Invalidate(cacheKey(link.DomainID, link.Slug))
+	return link, warnings, nil
 }
 
-func (s *service) Get(ctx context.Context, slug string) (*Link, error) {
-	return s.repo.GetBySlug(ctx, slug)
+// createWithGeneratedSlug stores link under the first generated slug that
+// is free. Every few collisions in a row, the slugs are made longer for
+// good: the keyspace is getting crowded. Slugs that would close a cycle of
+// short links are passed over.
+func (s *service) createWithGeneratedSlug(ctx context.Context, link *Link) error {
+	collisions := 0
+	for range maxSlugAttempts {
+		var id int64
+		if s.slugs.NeedsID() {
+			var err error
+			if id, err = s.repo.NextID(ctx); err != nil {
+				return err
+			}
+		}
+		slug, ok := s.slugs.Next(id)
+		if !ok {
+			continue
+		}
+
+		link.ID, link.Slug = id, slug
+		err := s.checkChains(ctx, link)
+		if errors.Is(err, ErrRedirectCycle) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.repo.Create(ctx, link)
+		if !errors.Is(err, ErrSlugTaken) {
+			return err
+		}
+
+		collisions++
+		if collisions%slugCollisionsToGrow == 0 && s.slugs.Grow() {
+			log.Printf("Generated slugs keep colliding; growing them to size %d", s.slugs.Size())
+		}
+	}
+	link.ID, link.Slug = 0, ""
+	return ErrNoFreeSlug
+}
+
+func (s *service) Get(ctx context.Context, domainID int64, slug string) (*Link, error) {
+	return s.repo.GetBySlug(ctx, domainID, slug)
+}
+
+func (s *service) Resolve(ctx context.Context, domainID int64, slug string) (*Link, error) {
+	link, err := s.cache.get(cacheKey(domainID, slug), func() (*Link, error) {
+		link, err := s.repo.GetBySlug(ctx, domainID, slug)
+		if err != nil {
+			return nil, err
+		}
+
+		link.Variants, err = s.repo.ListVariants(ctx, link.ID)
+		if err != nil {
+			return nil, err
+		}
+		return link, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := link.Availability(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+func (s *service) Consume(ctx context.Context, link *Link) error {
+	if link.MaxClicks == nil {
+		return nil
+	}
+
+	err := s.repo.ConsumeClick(ctx, link.ID)
+	if errors.Is(err, ErrLinkExhausted) {
+		// Consuming clicks does not invalidate cached links, so the cached
+		// count may be behind. Reload it, so Resolve turns visitors away
+		// without trying to consume.
+		s.cache.Invalidate(cacheKey(link.DomainID, link.Slug))
+	}
+	return err
 }
 
 func (s *service) List(ctx context.Context, opts ListOptions) ([]*Link, int64, error) {
 	return s.repo.List(ctx, opts)
 }
 
-func (s *service) Update(ctx context.Context, slug string, url *string, isActive *bool) error {
-	link, err := s.repo.GetBySlug(ctx, slug)
+func (s *service) Update(ctx context.Context, domainID int64, slug string, input UpdateLinkInput) ([]urlpolicy.Warning, error) {
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	key := linkKey{domainID, slug}
+	var warnings []urlpolicy.Warning
 
-	if url != nil {
-		if strings.Contains(*url, s.redirectDomain) {
-			return ErrRedirectLoop
+	if input.URL != nil {
+		if err := s.checkURL(ctx, key, *input.URL, &warnings); err != nil {
+			return nil, err
 		}
-		link.URL = *url
+		link.URL = *input.URL
+	}
+	if input.IsActive != nil {
+		link.IsActive = *input.IsActive
+	}
+	if input.ActiveFrom.Set {
+		link.ActiveFrom = input.ActiveFrom.Value
+	}
+	if input.ActiveUntil.Set {
+		link.ActiveUntil = input.ActiveUntil.Value
+	}
+	if !validWindow(link.ActiveFrom, link.ActiveUntil) {
+		return nil, ErrInvalidWindow
 	}
-	if isActive != nil {
-		link.IsActive = *isActive
+	if input.ExpiresAt.Set {
+		link.ExpiresAt = input.ExpiresAt.Value
+	}
+	if input.MaxClicks.Set {
+		link.MaxClicks = input.MaxClicks.Value
+	}
+	if input.QueryMode != nil {
+		link.QueryMode = *input.QueryMode
+	}
+	if input.ForwardPath != nil {
+		link.ForwardPath = *input.ForwardPath
+	}
+	if input.CountryRules != nil {
+		link.CountryRules, err = s.countryRules(ctx, key, *input.CountryRules, &warnings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if input.DeviceRules != nil {
+		link.DeviceRules, err = s.deviceRules(ctx, key, *input.DeviceRules, &warnings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if input.DeepLink.Set {
+		link.DeepLink, err = s.deepLink(input.DeepLink.Value, &warnings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if input.OGTitle.Set {
+		link.OGTitle = valueOrEmpty(input.OGTitle.Value)
+	}
+	if input.OGDescription.Set {
+		link.OGDescription = valueOrEmpty(input.OGDescription.Value)
+	}
+	if input.OGImageURL.Set {
+		link.OGImageURL = valueOrEmpty(input.OGImageURL.Value)
+	}
+	if input.StickyVariants != nil {
+		link.StickyVariants = *input.StickyVariants
+	}
+	if input.RedirectStatus.Set {
+		link.RedirectStatus = input.RedirectStatus.Value
+	}
+	if input.Password.Set {
+		link.PasswordHash = ""
+		if input.Password.Value != nil {
+			link.PasswordHash, err = hashPassword(*input.Password.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 	link.UpdatedAt = time.Now()
 
-	return s.repo.Update(ctx, link)
+	defer s.cache.Invalidate(cacheKey(domainID, slug))
+	if err := s.repo.Update(ctx, link); err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
+
+func (s *service) Delete(ctx context.Context, domainID int64, slug string) error {
+	defer s.cache.Invalidate(cacheKey(domainID, slug))
+	return s.repo.Delete(ctx, domainID, slug)
+}
+
+func (s *service) ListVariants(ctx context.Context, domainID int64, slug string) ([]Variant, error) {
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListVariants(ctx, link.ID)
 }
 
-func (s *service) Delete(ctx context.Context, slug string) error {
-	return s.repo.Delete(ctx, slug)
+func (s *service) CreateVariant(ctx context.Context, domainID int64, slug string, input CreateVariantInput) (*Variant, []urlpolicy.Warning, error) {
+	var warnings []urlpolicy.Warning
+	if err := s.checkURL(ctx, linkKey{domainID, slug}, input.URL, &warnings); err != nil {
+		return nil, nil, err
+	}
+
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	variant := &Variant{
+		LinkID: link.ID,
+		URL:    input.URL,
+		Weight: input.Weight,
+	}
+	defer s.cache.Invalidate(cacheKey(domainID, slug))
+	if err := s.repo.CreateVariant(ctx, variant); err != nil {
+		return nil, nil, err
+	}
+	return variant, warnings, nil
+}
+
+func (s *service) UpdateVariant(ctx context.Context, domainID int64, slug string, id int64, input UpdateVariantInput) (*Variant, []urlpolicy.Warning, error) {
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	variants, err := s.repo.ListVariants(ctx, link.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	variant := FindVariant(variants, id)
+	if variant == nil {
+		return nil, nil, ErrVariantNotFound
+	}
+
+	var warnings []urlpolicy.Warning
+	if input.URL != nil {
+		if err := s.checkURL(ctx, linkKey{domainID, slug}, *input.URL, &warnings); err != nil {
+			return nil, nil, err
+		}
+		variant.URL = *input.URL
+	}
+	if input.Weight != nil {
+		variant.Weight = *input.Weight
+	}
+
+	defer s.cache.Invalidate(cacheKey(domainID, slug))
+	if err := s.repo.UpdateVariant(ctx, variant); err != nil {
+		return nil, nil, err
+	}
+	return variant, warnings, nil
+}
+
+func (s *service) DeleteVariant(ctx context.Context, domainID int64, slug string, id int64) error {
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
+	if err != nil {
+		return err
+	}
+
+	defer s.cache.Invalidate(cacheKey(domainID, slug))
+	return s.repo.DeleteVariant(ctx, link.ID, id)
+}
+
+func (s *service) CountVariantHit(ctx context.Context, variant *Variant) error {
+	if s.hits != nil {
+		s.hits.Add(variant.ID)
+		return nil
+	}
+	return s.repo.AddVariantHits(ctx, map[int64]int64{variant.ID: 1})
+}
+
+func (s *service) ListLanguageRules(ctx context.Context, domainID int64, slug string) ([]LanguageRule, error) {
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
+	if err != nil {
+		return nil, err
+	}
+	return link.LanguageRules, nil
+}
+
+func (s *service) SetLanguageRule(ctx context.Context, domainID int64, slug string, rule LanguageRule) ([]LanguageRule, []urlpolicy.Warning, error) {
+	var warnings []urlpolicy.Warning
+	if err := s.checkURL(ctx, linkKey{domainID, slug}, rule.URL, &warnings); err != nil {
+		return nil, nil, err
+	}
+
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	language, err := NormalizeLanguageTag(rule.Language)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer s.cache.Invalidate(cacheKey(domainID, slug))
+	rules, err := s.repo.UpdateLanguageRules(ctx, link.ID, func(rules []LanguageRule) ([]LanguageRule, error) {
+		if i := slices.IndexFunc(rules, func(r LanguageRule) bool { return r.Language == language }); i >= 0 {
+			rules[i].URL = rule.URL
+		} else {
+			rules = append(rules, LanguageRule{Language: language, URL: rule.URL})
+		}
+		return normalizeLanguageRules(rules)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return rules, warnings, nil
+}
+
+func (s *service) DeleteLanguageRule(ctx context.Context, domainID int64, slug, language string) error {
+	link, err := s.repo.GetBySlug(ctx, domainID, slug)
+	if err != nil {
+		return err
+	}
+
+	language, err = NormalizeLanguageTag(language)
+	if err != nil {
+		return ErrLanguageRuleNotFound
+	}
+
+	defer s.cache.Invalidate(cacheKey(domainID, slug))
+	_, err = s.repo.UpdateLanguageRules(ctx, link.ID, func(rules []LanguageRule) ([]LanguageRule, error) {
+		remaining := slices.DeleteFunc(slices.Clone(rules), func(r LanguageRule) bool { return r.Language == language })
+		if len(remaining) == len(rules) {
+			return nil, ErrLanguageRuleNotFound
+		}
+		return remaining, nil
+	})
+	return err
+}
+
+// countryRules validates the country overrides of the link key. Their
+// destinations are subject to the same checks as the link's own URL.
+func (s *service) countryRules(ctx context.Context, key linkKey, rules []CountryRule, warnings *[]urlpolicy.Warning) ([]CountryRule, error) {
+	normalized, err := normalizeCountryRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range normalized {
+		if err := s.checkURL(ctx, key, rule.URL, warnings); err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
+
+// deviceRules validates the device rules of the link key. Their
+// destinations are subject to the same checks as the link's own URL.
+func (s *service) deviceRules(ctx context.Context, key linkKey, rules []DeviceRule, warnings *[]urlpolicy.Warning) ([]DeviceRule, error) {
+	normalized, err := normalizeDeviceRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range normalized {
+		if err := s.checkURL(ctx, key, rule.URL, warnings); err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
+
+// deepLink validates a deep link. Its URLs are subject to the same checks
+// as the link's own URL.
+func (s *service) deepLink(link *DeepLink, warnings *[]urlpolicy.Warning) (*DeepLink, error) {
+	normalized, err := normalizeDeepLink(link)
+	if err != nil || normalized == nil {
+		return nil, err
+	}
+	for _, url := range normalized.urls() {
+		if err := s.checkDeepLinkURL(url, warnings); err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
+
+// validWindow reports whether an activation window is well-formed. Either
+// bound may be open.
+func validWindow(from, until *time.Time) bool {
+	return from == nil || until == nil || from.Before(*until)
+}
+
+func valueOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// hashPassword returns the bcrypt hash of a link password, or an empty
+// string when the link is not password protected.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
 }
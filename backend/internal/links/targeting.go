@@ -0,0 +1,162 @@
+package links
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nekogravitycat/linkhub/internal/useragent"
+)
+
+const (
+	// maxCountryRules bounds the number of country overrides of a single link.
+	maxCountryRules = 250
+	// maxDeviceRules bounds the number of device rules of a single link.
+	maxDeviceRules = 20
+)
+
+var countryCodeRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// CountryRule sends visitors from one country to a different destination.
+type CountryRule struct {
+	// Country is an upper-case ISO 3166-1 alpha-2 code, e.g. "TW"
+	Country string `json:"country"`
+	URL     string `json:"url"`
+}
+
+// DeviceRule sends visitors on matching platforms to a different
+// destination. Empty criteria match anything, but at least one is set.
+type DeviceRule struct {
+	// OS is one of useragent.OSes, e.g. "ios"
+	OS string `json:"os,omitempty"`
+	// Device is one of useragent.Devices, e.g. "mobile"
+	Device string `json:"device,omitempty"`
+	// Browser is one of useragent.Browsers, e.g. "chrome"
+	Browser string `json:"browser,omitempty"`
+	URL     string `json:"url"`
+}
+
+// Matches reports whether the rule applies to the client.
+func (r DeviceRule) Matches(client useragent.Client) bool {
+	return (r.OS == "" || r.OS == client.OS) &&
+		(r.Device == "" || r.Device == client.Device) &&
+		(r.Browser == "" || r.Browser == client.Browser)
+}
+
+// Visitor is what targeting rules know about the client of a redirect.
+type Visitor struct {
+	Country string
+	Client  useragent.Client
+	// Languages are the Accept-Language tags, most preferred first
+	Languages []string
+}
+
+// IsTargeted reports whether the destination may depend on the visitor, in
+// which case the redirect must not be cached by shared caches.
+func (l *Link) IsTargeted() bool {
+	return len(l.CountryRules) > 0 || len(l.DeviceRules) > 0 || len(l.LanguageRules) > 0 || len(l.Variants) > 0 || l.DeepLink != nil
+}
+
+// TargetURL returns the destination of the targeting rule matching the
+// visitor, and false if none does. Device rules are checked first, in
+// order, since they usually pick a different kind of destination (an app
+// store rather than the website); then language rules, as the visitor's
+// stated preference beats a guess from their location; then country rules.
+func (l *Link) TargetURL(v Visitor) (string, bool) {
+	for _, rule := range l.DeviceRules {
+		if rule.Matches(v.Client) {
+			return rule.URL, true
+		}
+	}
+	if url, ok := l.languageURL(v.Languages); ok {
+		return url, true
+	}
+	return l.countryURL(v.Country)
+}
+
+// URLForCountry returns the destination for visitors from country, falling
+// back to the link's URL when no rule matches.
+func (l *Link) URLForCountry(country string) string {
+	if url, ok := l.countryURL(country); ok {
+		return url
+	}
+	return l.URL
+}
+
+func (l *Link) countryURL(country string) (string, bool) {
+	if country == "" {
+		return "", false
+	}
+	for _, rule := range l.CountryRules {
+		if rule.Country == country {
+			return rule.URL, true
+		}
+	}
+	return "", false
+}
+
+// normalizeCountryRules upper-cases the country codes and rejects invalid
+// or duplicate codes.
+func normalizeCountryRules(rules []CountryRule) ([]CountryRule, error) {
+	if len(rules) > maxCountryRules {
+		return nil, fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidCountryRule, maxCountryRules)
+	}
+
+	normalized := make([]CountryRule, 0, len(rules))
+	seen := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		country := strings.ToUpper(strings.TrimSpace(rule.Country))
+		if !countryCodeRegex.MatchString(country) {
+			return nil, fmt.Errorf("%w: %q is not an ISO 3166-1 alpha-2 code", ErrInvalidCountryRule, rule.Country)
+		}
+		if seen[country] {
+			return nil, fmt.Errorf("%w: duplicate country %s", ErrInvalidCountryRule, country)
+		}
+		if rule.URL == "" {
+			return nil, fmt.Errorf("%w: missing url for %s", ErrInvalidCountryRule, country)
+		}
+		seen[country] = true
+
+		normalized = append(normalized, CountryRule{Country: country, URL: rule.URL})
+	}
+
+	return normalized, nil
+}
+
+// normalizeDeviceRules lower-cases the criteria and rejects unknown values
+// and rules without any criterion.
+func normalizeDeviceRules(rules []DeviceRule) ([]DeviceRule, error) {
+	if len(rules) > maxDeviceRules {
+		return nil, fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidDeviceRule, maxDeviceRules)
+	}
+
+	normalized := make([]DeviceRule, 0, len(rules))
+
+	for i, rule := range rules {
+		rule.OS = strings.ToLower(strings.TrimSpace(rule.OS))
+		rule.Device = strings.ToLower(strings.TrimSpace(rule.Device))
+		rule.Browser = strings.ToLower(strings.TrimSpace(rule.Browser))
+
+		if rule.OS == "" && rule.Device == "" && rule.Browser == "" {
+			return nil, fmt.Errorf("%w: rule %d has no os, device or browser", ErrInvalidDeviceRule, i+1)
+		}
+		if rule.OS != "" && !slices.Contains(useragent.OSes, rule.OS) {
+			return nil, fmt.Errorf("%w: unknown os %q", ErrInvalidDeviceRule, rule.OS)
+		}
+		if rule.Device != "" && !slices.Contains(useragent.Devices, rule.Device) {
+			return nil, fmt.Errorf("%w: unknown device %q", ErrInvalidDeviceRule, rule.Device)
+		}
+		if rule.Browser != "" && !slices.Contains(useragent.Browsers, rule.Browser) {
+			return nil, fmt.Errorf("%w: unknown browser %q", ErrInvalidDeviceRule, rule.Browser)
+		}
+		if rule.URL == "" {
+			return nil, fmt.Errorf("%w: missing url for rule %d", ErrInvalidDeviceRule, i+1)
+		}
+
+		normalized = append(normalized, rule)
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,67 @@
+package links
+
+import "time"
+
+// maxVariants bounds the number of variants of a single link.
+const maxVariants = 10
+
+// Variant is one of several weighted destinations of a link, used to split
+// traffic between landing pages (A/B tests).
+type Variant struct {
+	ID     int64  `json:"id"`
+	LinkID int64  `json:"link_id"`
+	URL    string `json:"url"`
+	// Weight is the variant's relative share of traffic; 0 pauses it
+	Weight int `json:"weight"`
+	// HitCount is the number of redirects served to this variant
+	HitCount  int64     `json:"hit_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateVariantInput struct {
+	URL    string
+	Weight int
+}
+
+type UpdateVariantInput struct {
+	URL    *string
+	Weight *int
+}
+
+// TotalWeight returns the sum of the variant weights.
+func TotalWeight(variants []Variant) int {
+	total := 0
+	for _, v := range variants {
+		total += max(v.Weight, 0)
+	}
+	return total
+}
+
+// PickVariant returns the variant that n falls on when the variants are laid
+// out by weight, so a uniformly random n in [0, TotalWeight) picks each
+// variant with a probability proportional to its weight. It returns nil
+// when n is out of range.
+func PickVariant(variants []Variant, n int) *Variant {
+	if n < 0 {
+		return nil
+	}
+	for i := range variants {
+		weight := max(variants[i].Weight, 0)
+		if n < weight {
+			return &variants[i]
+		}
+		n -= weight
+	}
+	return nil
+}
+
+// FindVariant returns the variant with the given id, or nil.
+func FindVariant(variants []Variant, id int64) *Variant {
+	for i := range variants {
+		if variants[i].ID == id {
+			return &variants[i]
+		}
+	}
+	return nil
+}
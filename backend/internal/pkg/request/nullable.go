@@ -0,0 +1,28 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Nullable distinguishes an absent JSON field from an explicit null, so PATCH
+// requests can clear optional values. Set is true whenever the field was present.
+type Nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		n.Value = nil
+		return nil
+	}
+
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	n.Value = &value
+	return nil
+}
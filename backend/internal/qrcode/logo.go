@@ -0,0 +1,91 @@
+package qrcode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"os"
+
+	// Logo formats
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Logo is an image drawn in the centre of QR codes.
+type Logo struct {
+	img      image.Image
+	data     []byte
+	mimeType string
+	digest   string
+}
+
+// LoadLogo reads a PNG or JPEG logo.
+func LoadLogo(path string) (*Logo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo %s: %w", path, err)
+	}
+
+	sum := sha256.Sum256(data)
+	return &Logo{
+		img:      img,
+		data:     data,
+		mimeType: http.DetectContentType(data),
+		digest:   hex.EncodeToString(sum[:8]),
+	}, nil
+}
+
+// Digest identifies the logo's content, for cache validators.
+func (l *Logo) Digest() string {
+	return l.digest
+}
+
+// draw paints the logo over box on a background-coloured square, scaled to
+// fit while keeping its aspect ratio.
+func (l *Logo) draw(dst draw.Image, box image.Rectangle, background color.NRGBA) {
+	draw.Draw(dst, box, image.NewUniform(background), image.Point{}, draw.Src)
+
+	src := l.img.Bounds()
+	if src.Empty() || box.Empty() {
+		return
+	}
+
+	// Fit inside the box with a small padding
+	pad := box.Dx() / 10
+	inner := box.Inset(pad)
+	scale := min(float64(inner.Dx())/float64(src.Dx()), float64(inner.Dy())/float64(src.Dy()))
+	w, h := int(float64(src.Dx())*scale), int(float64(src.Dy())*scale)
+	target := image.Rect(0, 0, w, h).Add(inner.Min).Add(image.Pt((inner.Dx()-w)/2, (inner.Dy()-h)/2))
+
+	// Box filter: each target pixel averages the source pixels it covers
+	scaled := image.NewRGBA64(target)
+	for y := target.Min.Y; y < target.Max.Y; y++ {
+		sy0 := src.Min.Y + (y-target.Min.Y)*src.Dy()/h
+		sy1 := max(sy0+1, src.Min.Y+(y-target.Min.Y+1)*src.Dy()/h)
+		for x := target.Min.X; x < target.Max.X; x++ {
+			sx0 := src.Min.X + (x-target.Min.X)*src.Dx()/w
+			sx1 := max(sx0+1, src.Min.X+(x-target.Min.X+1)*src.Dx()/w)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := l.img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			scaled.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	draw.Draw(dst, target, scaled, target.Min, draw.Over)
+}
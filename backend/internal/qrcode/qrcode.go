@@ -0,0 +1,227 @@
+// Package qrcode renders QR codes as PNG or SVG images, optionally with a
+// logo in the centre.
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	encoder "github.com/skip2/go-qrcode"
+)
+
+// Level is the error correction level: the share of the code that can be
+// damaged or covered while staying readable.
+type Level string
+
+const (
+	LevelLow     Level = "l" // ~7%
+	LevelMedium  Level = "m" // ~15%
+	LevelQuarter Level = "q" // ~25%
+	LevelHigh    Level = "h" // ~30%
+)
+
+var recoveryLevels = map[Level]encoder.RecoveryLevel{
+	LevelLow:     encoder.Low,
+	LevelMedium:  encoder.Medium,
+	LevelQuarter: encoder.High,
+	LevelHigh:    encoder.Highest,
+}
+
+// logoShare is the part of the code's width covered by the logo. It stays
+// well within what level Q and H can recover from.
+const logoShare = 0.22
+
+var (
+	ErrInvalidColor = errors.New("invalid color")
+	// ErrLogoNeedsHighLevel is returned when a logo is requested with an
+	// error correction level too low to make up for the modules it covers.
+	ErrLogoNeedsHighLevel = errors.New("a logo requires error correction level q or h")
+)
+
+// Options controls how a code is rendered.
+type Options struct {
+	// Size is the width and height of the image in pixels
+	Size int
+	// Level defaults to LevelMedium
+	Level Level
+	// Margin is the quiet zone around the code, in modules
+	Margin     int
+	Foreground color.NRGBA
+	Background color.NRGBA
+	// Logo is drawn in the centre when set
+	Logo *Logo
+}
+
+// code is an encoded QR code: modules[y][x] is true for dark modules. It
+// includes the margin.
+type code struct {
+	modules [][]bool
+	opts    Options
+}
+
+func encode(content string, opts Options) (*code, error) {
+	if opts.Level == "" {
+		opts.Level = LevelMedium
+	}
+	level, ok := recoveryLevels[opts.Level]
+	if !ok {
+		return nil, fmt.Errorf("invalid error correction level %q", opts.Level)
+	}
+	if opts.Logo != nil && opts.Level != LevelQuarter && opts.Level != LevelHigh {
+		return nil, ErrLogoNeedsHighLevel
+	}
+
+	q, err := encoder.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+	q.DisableBorder = true
+	bitmap := q.Bitmap()
+
+	total := len(bitmap) + 2*opts.Margin
+	modules := make([][]bool, total)
+	for y := range modules {
+		modules[y] = make([]bool, total)
+	}
+	for y, row := range bitmap {
+		copy(modules[y+opts.Margin][opts.Margin:], row)
+	}
+
+	return &code{modules: modules, opts: opts}, nil
+}
+
+// logoBox returns the square the logo covers, in modules, centred on the
+// code and aligned to the module grid.
+func (c *code) logoBox() (offset, width int) {
+	inner := len(c.modules) - 2*c.opts.Margin
+	width = int(float64(inner) * logoShare)
+	// Keep the box centred on odd-sized codes
+	if width%2 != inner%2 {
+		width++
+	}
+	return (len(c.modules) - width) / 2, width
+}
+
+// PNG renders content as a PNG image.
+func PNG(content string, opts Options) ([]byte, error) {
+	c, err := encode(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	size := opts.Size
+	total := len(c.modules)
+	if size < total {
+		size = total
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	// Module edges are rounded to whole pixels so every module is sharp;
+	// modules differ in width by at most one pixel.
+	edge := func(i int) int { return i * size / total }
+
+	for y := range total {
+		for x := range total {
+			fill := opts.Background
+			if c.modules[y][x] {
+				fill = opts.Foreground
+			}
+			for py := edge(y); py < edge(y+1); py++ {
+				for px := edge(x); px < edge(x+1); px++ {
+					img.SetNRGBA(px, py, fill)
+				}
+			}
+		}
+	}
+
+	if opts.Logo != nil {
+		offset, width := c.logoBox()
+		box := image.Rect(edge(offset), edge(offset), edge(offset+width), edge(offset+width))
+		opts.Logo.draw(img, box, opts.Background)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders content as an SVG image. Dark modules are drawn as a single
+// path in module units, scaled to the requested size by the viewBox.
+func SVG(content string, opts Options) ([]byte, error) {
+	c, err := encode(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(c.modules)
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d"%s/>`, total, total, svgFill(opts.Background))
+
+	buf.WriteString(`<path d="`)
+	for y, row := range c.modules {
+		for x := 0; x < total; x++ {
+			if !row[x] {
+				continue
+			}
+			// Merge horizontal runs of dark modules into one rectangle
+			run := 1
+			for x+run < total && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x, y, run, run)
+			x += run - 1
+		}
+	}
+	fmt.Fprintf(&buf, `"%s/>`, svgFill(opts.Foreground))
+
+	if opts.Logo != nil {
+		offset, width := c.logoBox()
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d"%s/>`, offset, offset, width, width, svgFill(opts.Background))
+		fmt.Fprintf(&buf, `<image x="%d" y="%d" width="%d" height="%d" href="data:%s;base64,%s"/>`,
+			offset, offset, width, width, opts.Logo.mimeType, base64.StdEncoding.EncodeToString(opts.Logo.data))
+	}
+
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+func svgFill(c color.NRGBA) string {
+	fill := fmt.Sprintf(` fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xff {
+		fill += ` fill-opacity="` + strconv.FormatFloat(float64(c.A)/0xff, 'f', 3, 64) + `"`
+	}
+	return fill
+}
+
+// ParseColor parses a hex colour: RGB, RRGGBB or RRGGBBAA, with or without
+// a leading "#".
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("%w: %q", ErrInvalidColor, s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("%w: %q", ErrInvalidColor, s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that filled up again are dropped.
+const sweepInterval = 10 * time.Second
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]time.Time
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns a Store keeping the buckets in this process, so
+// every replica has its own budget.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	fullAt, result := take(s.buckets[key], now, limit)
+	if result.Allowed {
+		s.buckets[key] = fullAt
+	}
+	return result, nil
+}
+
+func (s *memoryStore) Check(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return check(s.buckets[key], s.now(), limit), nil
+}
+
+// sweep drops the buckets that are full, which are the same as no bucket.
+// The caller holds the lock.
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(sweepInterval)
+
+	for key, fullAt := range s.buckets {
+		if !fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
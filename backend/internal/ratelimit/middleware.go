@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notFoundKey marks requests for unknown links, see MarkNotFound.
+const notFoundKey = "ratelimit.not_found"
+
+// Options configures a Limiter. A zero Limit disables its budget.
+type Options struct {
+	// Requests is the budget of every request of a client
+	Requests Limit
+	// NotFound is the budget of the requests of a client that find no link.
+	// Once it is spent, all requests of the client are refused until it
+	// refills, so guessing slugs is slow while busy links are unaffected.
+	NotFound Limit
+}
+
+// Limiter throttles clients by IP address. IPv6 clients are limited per
+// /64, the smallest network usually assigned to one subscriber.
+type Limiter struct {
+	store    Store
+	requests Limit
+	notFound Limit
+
+	limited         atomic.Uint64
+	limitedNotFound atomic.Uint64
+	storeErrors     atomic.Uint64
+}
+
+// Stats counts the requests a Limiter refused.
+type Stats struct {
+	// Limited requests exceeded the request budget
+	Limited uint64 `json:"limited"`
+	// LimitedNotFound requests came from clients out of not-found budget
+	LimitedNotFound uint64 `json:"limited_not_found"`
+	// StoreErrors requests were let through because the store failed
+	StoreErrors uint64 `json:"store_errors"`
+}
+
+// New returns a Limiter that keeps its buckets in store.
+func New(store Store, opts Options) *Limiter {
+	return &Limiter{
+		store:    store,
+		requests: opts.Requests,
+		notFound: opts.NotFound,
+	}
+}
+
+// MarkNotFound charges the request to the not-found budget even when it is
+// not answered with a 404, e.g. when redirected to a fallback URL.
+func MarkNotFound(c *gin.Context) {
+	c.Set(notFoundKey, true)
+}
+
+// Middleware refuses requests over budget with 429 Too Many Requests and a
+// Retry-After header. A nil Limiter lets everything through. If the store
+// fails, requests are let through rather than taking the redirects down.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	if l == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		client := clientKey(c.ClientIP())
+
+		if l.notFound.Enabled() {
+			result, err := l.store.Check(ctx, "not_found:"+client, l.notFound)
+			if !l.allow(c, result, err, &l.limitedNotFound) {
+				return
+			}
+		}
+		if l.requests.Enabled() {
+			result, err := l.store.Take(ctx, "requests:"+client, l.requests)
+			if !l.allow(c, result, err, &l.limited) {
+				return
+			}
+		}
+
+		c.Next()
+
+		if l.notFound.Enabled() && (c.Writer.Status() == http.StatusNotFound || c.GetBool(notFoundKey)) {
+			if _, err := l.store.Take(ctx, "not_found:"+client, l.notFound); err != nil {
+				l.storeErrors.Add(1)
+				log.Printf("failed to charge rate limit: %v", err)
+			}
+		}
+	}
+}
+
+// allow answers the request with 429 unless result allows it, and reports
+// whether it may go on.
+func (l *Limiter) allow(c *gin.Context, result Result, err error, limited *atomic.Uint64) bool {
+	if err != nil {
+		l.storeErrors.Add(1)
+		log.Printf("failed to check rate limit: %v", err)
+		return true
+	}
+	if result.Allowed {
+		return true
+	}
+
+	limited.Add(1)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatus(http.StatusTooManyRequests)
+	return false
+}
+
+// Stats returns the counters of the limiter.
+func (l *Limiter) Stats() Stats {
+	return Stats{
+		Limited:         l.limited.Load(),
+		LimitedNotFound: l.limitedNotFound.Load(),
+		StoreErrors:     l.storeErrors.Load(),
+	}
+}
+
+// clientKey identifies the client with the IP address; IPv6 addresses are
+// reduced to their /64 network.
+func clientKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(64)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
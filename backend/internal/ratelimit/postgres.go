@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// takeQuery takes a token in one statement: a missing bucket is full, and a
+// bucket without a token is left as it is, returning no row. Times are the
+// database's, so replicas agree on them.
+const takeQuery = `
+INSERT INTO rate_limits AS b (key, full_at)
+VALUES ($1, now() + $2 * interval '1 second')
+ON CONFLICT (key) DO UPDATE
+SET full_at = GREATEST(b.full_at, now()) + $2 * interval '1 second'
+WHERE GREATEST(b.full_at, now()) + $2 * interval '1 second' <= now() + $3 * interval '1 second'
+RETURNING full_at`
+
+// waitQuery returns the seconds until the bucket has a token, negative or
+// zero when it has one.
+const waitQuery = `
+SELECT EXTRACT(EPOCH FROM GREATEST(full_at, now()) + $2 * interval '1 second' - now() - $3 * interval '1 second')::float8
+FROM rate_limits
+WHERE key = $1`
+
+type postgresStore struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresStore returns a Store keeping the buckets in the rate_limits
+// table, so that replicas share one budget. Run SweepPostgres alongside it to
+// keep the table small.
+func NewPostgresStore(db *pgxpool.Pool) Store {
+	return &postgresStore{db: db}
+}
+
+func (s *postgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	interval, window := limit.interval().Seconds(), limit.window().Seconds()
+
+	var fullAt time.Time
+	err := s.db.QueryRow(ctx, takeQuery, key, interval, window).Scan(&fullAt)
+	if err == nil {
+		return Result{Allowed: true}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return Result{}, err
+	}
+	return s.wait(ctx, key, interval, window)
+}
+
+func (s *postgresStore) Check(ctx context.Context, key string, limit Limit) (Result, error) {
+	return s.wait(ctx, key, limit.interval().Seconds(), limit.window().Seconds())
+}
+
+func (s *postgresStore) wait(ctx context.Context, key string, interval, window float64) (Result, error) {
+	var seconds float64
+	err := s.db.QueryRow(ctx, waitQuery, key, interval, window).Scan(&seconds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Result{Allowed: true}, nil
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if seconds <= 0 {
+		return Result{Allowed: true}, nil
+	}
+	return Result{RetryAfter: time.Duration(seconds * float64(time.Second))}, nil
+}
+
+// SweepPostgres deletes the buckets in the rate_limits table that are full
+// again every sweepInterval, off the request path, until ctx is done.
+func SweepPostgres(ctx context.Context, db *pgxpool.Pool) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepCtx, cancel := context.WithTimeout(ctx, sweepInterval)
+			// Losing a sweep only leaves rows for the next one
+			if _, err := db.Exec(sweepCtx, "DELETE FROM rate_limits WHERE full_at <= now()"); err != nil && ctx.Err() == nil {
+				log.Printf("failed to sweep rate limits: %v", err)
+			}
+			cancel()
+		}
+	}
+}
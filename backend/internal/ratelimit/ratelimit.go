@@ -0,0 +1,79 @@
+// Package ratelimit throttles clients with token buckets.
+//
+// A bucket holds up to Burst tokens and gains Rate tokens per second; every
+// request takes one. Buckets are stored as the time they will be full
+// again, so a bucket that is full needs no state at all, and taking a token
+// is a single comparison that a database can do in one statement.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is the budget of a bucket.
+type Limit struct {
+	// Rate is the number of tokens added per second
+	Rate float64
+	// Burst is the size of the bucket
+	Burst int
+}
+
+// PerMinute returns a limit of n requests per minute with the given burst.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Enabled reports whether the limit admits anything; a zero Limit disables
+// limiting instead of blocking everyone.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// interval is the time one token takes to come back.
+func (l Limit) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// window is the time an empty bucket takes to fill up.
+func (l Limit) window() time.Duration {
+	return time.Duration(l.Burst) * l.interval()
+}
+
+// Result is the outcome of taking or checking a token.
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available, when not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets.
+type Store interface {
+	// Take removes a token from the key's bucket if it has one.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Check reports whether the key's bucket has a token, without taking it.
+	Check(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take applies a take to a bucket that is full at fullAt, returning the
+// new time it is full and the result.
+func take(fullAt, now time.Time, limit Limit) (time.Time, Result) {
+	next := later(fullAt, now).Add(limit.interval())
+	if wait := next.Sub(now) - limit.window(); wait > 0 {
+		return fullAt, Result{RetryAfter: wait}
+	}
+	return next, Result{Allowed: true}
+}
+
+// check is take without the state change.
+func check(fullAt, now time.Time, limit Limit) Result {
+	_, result := take(fullAt, now, limit)
+	return result
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,70 @@
+package slugs
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"math/rand/v2"
+)
+
+// hashIDMaxSize is the longest encoding; 62^10 is the largest power of 62
+// that fits in a uint64.
+const hashIDMaxSize = 10
+
+// HashID encodes the ID of the link, like hashids: every ID gets its own
+// slug, so they never collide with each other, but consecutive IDs look
+// unrelated and cannot be decoded without the salt. An ID is mapped to a
+// number of size base62 digits by a salted bijection, and written in a
+// salted permutation of the alphabet. IDs too large for size digits get
+// longer slugs.
+type HashID struct {
+	alphabet     string
+	mult, offset uint64
+}
+
+// NewHashID returns the HashID strategy for salt.
+func NewHashID(salt string) HashID {
+	rng := rand.New(rand.NewChaCha8(sha256.Sum256([]byte(salt))))
+
+	alphabet := []byte(base62)
+	rng.Shuffle(len(alphabet), func(i, j int) { alphabet[i], alphabet[j] = alphabet[j], alphabet[i] })
+
+	// Multiplying by a number coprime to 62^n permutes [0, 62^n)
+	mult := rng.Uint64() | 1
+	if mult%31 == 0 {
+		mult += 2
+	}
+	return HashID{alphabet: string(alphabet), mult: mult, offset: rng.Uint64()}
+}
+
+func (h HashID) Slug(id int64, size int) string {
+	n := uint64(id)
+	modulus := pow62(size)
+	for size < hashIDMaxSize && n >= modulus {
+		size++
+		modulus = pow62(size)
+	}
+
+	// (n * mult + offset) mod 62^size, without overflowing
+	hi, lo := bits.Mul64(n%modulus, h.mult)
+	_, n = bits.Div64(hi%modulus, lo, modulus)
+	n = (n + h.offset%modulus) % modulus
+
+	b := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = h.alphabet[n%62]
+		n /= 62
+	}
+	return string(b)
+}
+
+func (HashID) NeedsID() bool    { return true }
+func (HashID) DefaultSize() int { return 6 }
+func (HashID) MaxSize() int     { return hashIDMaxSize }
+
+func pow62(n int) uint64 {
+	p := uint64(1)
+	for range n {
+		p *= 62
+	}
+	return p
+}
@@ -0,0 +1,29 @@
+package slugs
+
+import "strings"
+
+// profanity are words generated slugs must not contain, in any case and
+// with digits read as the letters they resemble.
+var profanity = []string{
+	"anal", "anus", "arse", "ass", "bitch", "boob", "butt", "clit", "cock",
+	"coon", "crap", "cum", "cunt", "dick", "dildo", "dyke", "fag", "fuck",
+	"gay", "homo", "jizz", "kike", "nazi", "nigg", "penis", "piss", "porn",
+	"puss", "rape", "sex", "shit", "slut", "spic", "tit", "twat", "vagina",
+	"wank", "whore",
+}
+
+// lookalikes reads digits as letters, so "5h1t" is caught like "shit".
+var lookalikes = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "-", "")
+
+// Profane reports whether slug contains a profane word. Short words make
+// the check strict, at the cost of dropping some harmless slugs, which is
+// cheap for generated ones.
+func Profane(slug string) bool {
+	s := lookalikes.Replace(strings.ToLower(slug))
+	for _, word := range profanity {
+		if strings.Contains(s, word) {
+			return true
+		}
+	}
+	return false
+}
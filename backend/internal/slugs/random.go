@@ -0,0 +1,31 @@
+package slugs
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// base62 is the alphabet of generated character slugs.
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Random makes slugs of random base62 characters; six of them give 56
+// billion slugs.
+type Random struct{}
+
+func (Random) Slug(_ int64, size int) string {
+	radix := big.NewInt(int64(len(base62)))
+	b := make([]byte, size)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, radix)
+		if err != nil {
+			// crypto/rand does not fail on supported platforms
+			panic(err)
+		}
+		b[i] = base62[n.Int64()]
+	}
+	return string(b)
+}
+
+func (Random) NeedsID() bool    { return false }
+func (Random) DefaultSize() int { return 6 }
+func (Random) MaxSize() int     { return MaxLength }
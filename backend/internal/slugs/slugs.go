@@ -0,0 +1,126 @@
+// Package slugs generates the slugs of links created without one.
+//
+// A Generator turns a Strategy's output into candidates: it drops those
+// that spell something offensive and, when candidates keep colliding with
+// existing slugs, makes every later slug one unit longer, so a crowded
+// keyspace grows instead of slowing creation down.
+package slugs
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Strategy names, as configured.
+const (
+	StrategyRandom = "random"
+	StrategyHashID = "hashid"
+	StrategyWords  = "words"
+)
+
+// Strategies lists the valid strategy names.
+var Strategies = []string{StrategyRandom, StrategyHashID, StrategyWords}
+
+// MaxLength is the longest slug the API accepts.
+const MaxLength = 32
+
+var ErrUnknownStrategy = errors.New("unknown slug strategy")
+
+// Strategy makes slugs of a size, counted in the strategy's own unit.
+type Strategy interface {
+	// Slug returns a slug of the given size for the link with ID id.
+	Slug(id int64, size int) string
+	// NeedsID reports whether Slug uses the ID; if not, it is passed 0.
+	NeedsID() bool
+	// DefaultSize is the size used when none is configured.
+	DefaultSize() int
+	// MaxSize is the largest size whose slugs fit MaxLength.
+	MaxSize() int
+}
+
+// Options configures a Generator.
+type Options struct {
+	// Strategy is one of Strategies; empty means StrategyRandom
+	Strategy string
+	// Size is the initial size of slugs, in characters or, for
+	// StrategyWords, words; 0 means the strategy's default
+	Size int
+	// Salt scrambles the encoding of StrategyHashID, so IDs cannot be
+	// decoded without it
+	Salt string
+}
+
+// Generator makes candidate slugs. It is safe for concurrent use.
+type Generator struct {
+	strategy Strategy
+	size     atomic.Int64
+}
+
+// New returns the Generator for opts.
+func New(opts Options) (*Generator, error) {
+	var strategy Strategy
+	switch opts.Strategy {
+	case "", StrategyRandom:
+		strategy = Random{}
+	case StrategyHashID:
+		strategy = NewHashID(opts.Salt)
+	case StrategyWords:
+		strategy = Words{}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, opts.Strategy)
+	}
+
+	size := opts.Size
+	if size == 0 {
+		size = strategy.DefaultSize()
+	}
+	if size < 1 || size > strategy.MaxSize() {
+		return nil, fmt.Errorf("slug size %d is out of range (1-%d)", size, strategy.MaxSize())
+	}
+
+	g := &Generator{strategy: strategy}
+	g.size.Store(int64(size))
+	return g, nil
+}
+
+// Default returns the Generator of the zero Options.
+func Default() *Generator {
+	g, _ := New(Options{})
+	return g
+}
+
+// NeedsID reports whether Next must be given the ID of the new link.
+func (g *Generator) NeedsID() bool {
+	return g.strategy.NeedsID()
+}
+
+// Next returns a candidate slug for the link with ID id, or false if the
+// candidate was dropped by the profanity filter and another ID or attempt
+// is needed.
+func (g *Generator) Next(id int64) (string, bool) {
+	slug := g.strategy.Slug(id, g.Size())
+	if Profane(slug) {
+		return "", false
+	}
+	return slug, true
+}
+
+// Size returns the current size of slugs.
+func (g *Generator) Size() int {
+	return int(g.size.Load())
+}
+
+// Grow makes later slugs one unit longer, up to the strategy's maximum, and
+// reports whether they did. It is called when candidates keep colliding.
+func (g *Generator) Grow() bool {
+	for {
+		size := g.size.Load()
+		if size >= int64(g.strategy.MaxSize()) {
+			return false
+		}
+		if g.size.CompareAndSwap(size, size+1) {
+			return true
+		}
+	}
+}
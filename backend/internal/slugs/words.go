@@ -0,0 +1,60 @@
+package slugs
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// Words of at most seven letters, so four of them fit MaxLength.
+var (
+	adjectives = []string{
+		"amber", "ample", "azure", "bold", "brave", "breezy", "bright", "brisk",
+		"calm", "candid", "clever", "cosmic", "cozy", "crisp", "curious", "daring",
+		"dapper", "eager", "early", "earnest", "fancy", "fluffy", "fresh", "gentle",
+		"giant", "glad", "golden", "grand", "happy", "hearty", "honest", "humble",
+		"jolly", "keen", "kind", "lively", "lucky", "lunar", "mellow", "merry",
+		"mighty", "misty", "modest", "noble", "olive", "polite", "proud", "quick",
+		"quiet", "rapid", "rosy", "royal", "rustic", "shiny", "silent", "silver",
+		"sleepy", "snowy", "solar", "steady", "sunny", "swift", "tidy", "witty",
+	}
+	nouns = []string{
+		"acorn", "anchor", "badger", "beacon", "bison", "breeze", "brook", "canyon",
+		"castle", "cedar", "comet", "coral", "crane", "dolphin", "dune", "eagle",
+		"ember", "falcon", "fern", "forest", "fox", "garden", "glacier", "harbor",
+		"hazel", "heron", "island", "lagoon", "lantern", "lemon", "lotus", "maple",
+		"meadow", "meteor", "mango", "moose", "nebula", "oasis", "ocean", "orchid",
+		"otter", "owl", "panda", "pebble", "pepper", "pine", "planet", "pony",
+		"prairie", "quartz", "rabbit", "raven", "reef", "river", "robin", "saffron",
+		"salmon", "canopy", "sparrow", "summit", "thistle", "tiger", "valley", "walrus",
+	}
+)
+
+// Words makes readable slugs like "brave-quiet-otter": size-1 adjectives
+// and a noun. Three words give 262144 slugs, four 16 million.
+type Words struct{}
+
+func (Words) Slug(_ int64, size int) string {
+	words := make([]string, size)
+	for i := range words {
+		list := adjectives
+		if i == size-1 {
+			list = nouns
+		}
+		words[i] = pick(list)
+	}
+	return strings.Join(words, "-")
+}
+
+func (Words) NeedsID() bool    { return false }
+func (Words) DefaultSize() int { return 3 }
+func (Words) MaxSize() int     { return 4 }
+
+func pick(list []string) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(list))))
+	if err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return list[n.Int64()]
+}
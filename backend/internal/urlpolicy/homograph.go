@@ -0,0 +1,92 @@
+package urlpolicy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// cjkScripts may be mixed with each other and with Latin, as Japanese,
+// Chinese and Korean names are.
+var cjkScripts = map[string]bool{
+	"Han": true, "Hiragana": true, "Katakana": true, "Hangul": true, "Bopomofo": true,
+}
+
+// latinLookalikes are the Cyrillic and Greek letters that look like Latin
+// ones. A label spelled with them alone, like "аррӏе", passes for Latin.
+const latinLookalikes = "аеһіјӏорсԁԛѕԝхуъьѵԍκνορτυχαιεзԗӡϲϳ"
+
+// homograph returns why a normalized host looks like it could impersonate
+// another, or "" if it does not. Only labels with non-ASCII letters are
+// suspected: those mixing scripts, and those made only of lookalikes of
+// Latin letters.
+func homograph(host string) string {
+	for label := range strings.SplitSeq(host, ".") {
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		unicodeLabel, err := idna.Punycode.ToUnicode(label)
+		if err != nil {
+			continue
+		}
+
+		found := labelScripts(unicodeLabel)
+		if len(found) > 1 && !allowedMix(found) {
+			return fmt.Sprintf("url host label %q mixes %s scripts", label, strings.Join(found, " and "))
+		}
+		if len(found) == 1 && (found[0] == "Cyrillic" || found[0] == "Greek") && onlyLookalikes(unicodeLabel) {
+			return fmt.Sprintf("url host label %q is spelled with %s letters that look Latin", label, found[0])
+		}
+	}
+	return ""
+}
+
+// labelScripts returns the scripts of the letters of label, in order of
+// appearance. Letters shared by scripts, like the Japanese "ー", have none.
+func labelScripts(label string) []string {
+	var found []string
+	for _, r := range label {
+		if !unicode.IsLetter(r) || unicode.In(r, unicode.Common, unicode.Inherited) {
+			continue
+		}
+		if name := scriptOf(r); !slices.Contains(found, name) {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// allowedMix reports whether the scripts are CJK ones, optionally with Latin.
+func allowedMix(found []string) bool {
+	for _, name := range found {
+		if name != "Latin" && !cjkScripts[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func onlyLookalikes(label string) bool {
+	for _, r := range label {
+		if unicode.IsLetter(r) && !strings.ContainsRune(latinLookalikes, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptOf returns the name of the Unicode script of a letter.
+func scriptOf(r rune) string {
+	if unicode.Is(unicode.Latin, r) {
+		return "Latin"
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return "Unknown"
+}
@@ -0,0 +1,316 @@
+// Package urlpolicy decides which URLs links may redirect to.
+//
+// A Policy rejects URLs with a Violation naming the rule that fired, and
+// flags URLs it allows but that may deceive visitors with Warnings.
+package urlpolicy
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Codes of the rules a URL can break, and of warnings.
+const (
+	CodeInvalidURL       = "invalid_url"
+	CodeSchemeNotAllowed = "scheme_not_allowed"
+	CodePrivateAddress   = "private_address"
+	CodeHostDenied       = "host_denied"
+	CodeHostNotAllowed   = "host_not_allowed"
+	CodeBlocklisted      = "blocklisted"
+	CodeIDNHomograph     = "idn_homograph"
+	CodeShortener        = "external_shortener"
+)
+
+// ErrNotAllowed is wrapped by every Violation.
+var ErrNotAllowed = errors.New("url not allowed")
+
+// Violation is the error of a URL the policy rejects.
+type Violation struct {
+	// Code is one of the Code constants
+	Code   string
+	URL    string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+func (v *Violation) Unwrap() error {
+	return ErrNotAllowed
+}
+
+// Warning flags a URL that is allowed but looks suspicious.
+type Warning struct {
+	// Code is one of the Code constants
+	Code   string
+	URL    string
+	Reason string
+}
+
+// Blocklist is a list of blocked hosts, like *blocklist.List.
+type Blocklist interface {
+	// Match returns the entry blocking a normalized host, if any.
+	Match(host string) (entry string, blocked bool)
+}
+
+// DefaultSchemes are the schemes allowed when Options.Schemes is empty.
+var DefaultSchemes = []string{"http", "https"}
+
+// DefaultShorteners are the link shorteners flagged when
+// Options.Shorteners is empty.
+var DefaultShorteners = []string{
+	"bit.ly", "bitly.com", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "ow.ly",
+	"rb.gy", "rebrand.ly", "s.id", "short.io", "shorturl.at", "t.co", "t.ly",
+	"tiny.cc", "tinyurl.com", "v.gd",
+}
+
+// Options configures a Policy. The zero value allows public http(s) URLs.
+type Options struct {
+	// Schemes are the allowed URL schemes; empty means DefaultSchemes
+	Schemes []string
+	// AllowPrivate allows loopback, private and link-local addresses, e.g.
+	// for links to an intranet
+	AllowPrivate bool
+	// AllowHosts, if not empty, are the only hosts URLs may point to
+	AllowHosts []string
+	// DenyHosts are hosts URLs may not point to. Both lists match the
+	// host itself and its subdomains.
+	DenyHosts []string
+	// Blocklist rejects the hosts it matches; nil blocks none
+	Blocklist Blocklist
+	// Shorteners are the hosts of link shorteners, whose URLs are allowed
+	// but flagged since their destination can change unnoticed; empty
+	// means DefaultShorteners
+	Shorteners []string
+}
+
+// Policy checks URLs against its Options. It is immutable and safe for
+// concurrent use.
+type Policy struct {
+	schemes      []string
+	allowPrivate bool
+	allowHosts   []string
+	denyHosts    []string
+	blocklist    Blocklist
+	shorteners   []string
+}
+
+// New returns the Policy for opts, or an error if a host is malformed.
+func New(opts Options) (*Policy, error) {
+	p := &Policy{allowPrivate: opts.AllowPrivate, blocklist: opts.Blocklist}
+
+	schemes := opts.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	for _, scheme := range schemes {
+		p.schemes = append(p.schemes, strings.ToLower(scheme))
+	}
+
+	var err error
+	if p.allowHosts, err = normalizeHosts(opts.AllowHosts); err != nil {
+		return nil, err
+	}
+	if p.denyHosts, err = normalizeHosts(opts.DenyHosts); err != nil {
+		return nil, err
+	}
+
+	shorteners := opts.Shorteners
+	if len(shorteners) == 0 {
+		shorteners = DefaultShorteners
+	}
+	if p.shorteners, err = normalizeHosts(shorteners); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Default returns the policy of the zero Options.
+func Default() *Policy {
+	p, _ := New(Options{})
+	return p
+}
+
+// Check returns a *Violation if rawURL is not allowed, else the warnings
+// about it, if any.
+func (p *Policy) Check(rawURL string) ([]Warning, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return nil, &Violation{Code: CodeInvalidURL, URL: rawURL, Reason: "invalid url"}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !slices.Contains(p.schemes, scheme) {
+		return nil, &Violation{
+			Code:   CodeSchemeNotAllowed,
+			URL:    rawURL,
+			Reason: fmt.Sprintf("url scheme %q is not allowed", scheme),
+		}
+	}
+
+	// e.g. mailto: URLs, if allowed
+	if u.Host == "" {
+		if scheme == "http" || scheme == "https" {
+			return nil, &Violation{Code: CodeInvalidURL, URL: rawURL, Reason: "url has no host"}
+		}
+		return nil, nil
+	}
+
+	host, err := NormalizeHost(u.Hostname())
+	if err != nil {
+		return nil, &Violation{Code: CodeInvalidURL, URL: rawURL, Reason: "invalid url host"}
+	}
+
+	if !p.allowPrivate && IsPrivateHost(host) {
+		return nil, &Violation{
+			Code:   CodePrivateAddress,
+			URL:    rawURL,
+			Reason: fmt.Sprintf("url host %q is a private network address", host),
+		}
+	}
+	if matchHost(p.denyHosts, host) {
+		return nil, &Violation{
+			Code:   CodeHostDenied,
+			URL:    rawURL,
+			Reason: fmt.Sprintf("url host %q is denied", host),
+		}
+	}
+	if p.blocklist != nil {
+		if entry, blocked := p.blocklist.Match(host); blocked {
+			return nil, &Violation{
+				Code:   CodeBlocklisted,
+				URL:    rawURL,
+				Reason: fmt.Sprintf("url host %q is blocklisted (%s)", host, entry),
+			}
+		}
+	}
+	if len(p.allowHosts) > 0 && !matchHost(p.allowHosts, host) {
+		return nil, &Violation{
+			Code:   CodeHostNotAllowed,
+			URL:    rawURL,
+			Reason: fmt.Sprintf("url host %q is not in the allowed hosts", host),
+		}
+	}
+
+	var warnings []Warning
+	if reason := homograph(host); reason != "" {
+		warnings = append(warnings, Warning{Code: CodeIDNHomograph, URL: rawURL, Reason: reason})
+	}
+	if matchHost(p.shorteners, host) {
+		warnings = append(warnings, Warning{
+			Code:   CodeShortener,
+			URL:    rawURL,
+			Reason: fmt.Sprintf("url host %q is a link shortener, whose destination is not checked", host),
+		})
+	}
+	return warnings, nil
+}
+
+// NormalizeHost returns host in lowercase ASCII (punycode) without a
+// trailing dot, so that lookalike spellings of a host compare equal.
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return host, nil
+	}
+	return idna.Punycode.ToASCII(host)
+}
+
+// IsPrivateHost reports whether a normalized host is localhost or an
+// address that is not publicly routable: loopback, private, link-local or
+// unspecified. Numeric hosts are read the way browsers do, so 2130706433
+// and 0x7f.1 are loopback too.
+func IsPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		var ok bool
+		if addr, ok = parseIPv4(host); !ok {
+			return false
+		}
+	}
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified()
+}
+
+// matchHost reports whether host is one of hosts or a subdomain of one.
+func matchHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPv4 reads the numeric hosts browsers accept as IPv4 addresses:
+// one to four dot-separated parts in decimal, octal (leading 0) or hex
+// (leading 0x), the last part filling the remaining bytes.
+func parseIPv4(host string) (netip.Addr, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+
+	var ip uint64
+	for i, part := range parts {
+		base := 10
+		switch {
+		case strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X"):
+			part, base = part[2:], 16
+			if part == "" {
+				part = "0"
+			}
+		case len(part) > 1 && part[0] == '0':
+			part, base = part[1:], 8
+		}
+		n, err := strconv.ParseUint(part, base, 32)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+
+		if i < len(parts)-1 {
+			if n > 255 {
+				return netip.Addr{}, false
+			}
+			ip = ip<<8 | n
+			continue
+		}
+		bits := 8 * (5 - len(parts))
+		if n >= 1<<bits {
+			return netip.Addr{}, false
+		}
+		ip = ip<<bits | n
+	}
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
+
+func normalizeHosts(hosts []string) ([]string, error) {
+	var normalized []string
+	for _, host := range hosts {
+		if host == "" {
+			continue
+		}
+		h, err := NormalizeHost(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host %q: %w", host, err)
+		}
+		normalized = append(normalized, h)
+	}
+	return normalized, nil
+}
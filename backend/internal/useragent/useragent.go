@@ -0,0 +1,198 @@
+package useragent
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Operating systems
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+)
+
+// Device classes
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+)
+
+// Browsers
+const (
+	BrowserChrome  = "chrome"
+	BrowserSafari  = "safari"
+	BrowserFirefox = "firefox"
+	BrowserEdge    = "edge"
+	BrowserOpera   = "opera"
+	BrowserSamsung = "samsung"
+)
+
+var (
+	OSes     = []string{OSiOS, OSAndroid, OSWindows, OSMacOS, OSLinux, OSChromeOS}
+	Devices  = []string{DeviceMobile, DeviceTablet, DeviceDesktop}
+	Browsers = []string{BrowserChrome, BrowserSafari, BrowserFirefox, BrowserEdge, BrowserOpera, BrowserSamsung}
+)
+
+// Client is what we know about the visitor's platform. Fields are empty
+// when they could not be determined.
+type Client struct {
+	OS      string
+	Device  string
+	Browser string
+}
+
+// Parse identifies the client from its User-Agent string and, when sent,
+// the Sec-CH-UA, Sec-CH-UA-Platform and Sec-CH-UA-Mobile client hints.
+// Client hints are more reliable than the (frozen, reduced) User-Agent of
+// Chromium browsers, so they take precedence.
+func Parse(userAgent string, header http.Header) Client {
+	client := Client{
+		OS:      parseOS(userAgent),
+		Browser: parseBrowser(userAgent),
+	}
+	client.Device = parseDevice(userAgent, client.OS)
+
+	if header == nil {
+		return client
+	}
+
+	if os := platformHint(header.Get("Sec-CH-UA-Platform")); os != "" {
+		client.OS = os
+	}
+	if browser := brandHint(header.Get("Sec-CH-UA")); browser != "" {
+		client.Browser = browser
+	}
+	switch header.Get("Sec-CH-UA-Mobile") {
+	case "?1":
+		client.Device = DeviceMobile
+	case "?0":
+		// Android tablets report themselves as non-mobile
+		if client.OS == OSAndroid {
+			client.Device = DeviceTablet
+		} else if client.Device == DeviceMobile {
+			client.Device = DeviceDesktop
+		}
+	}
+
+	return client
+}
+
+func parseOS(ua string) string {
+	switch {
+	// Windows Phone also claims to be Android and iPhone
+	case strings.Contains(ua, "Windows Phone"):
+		return OSWindows
+	case containsAny(ua, "iPhone", "iPad", "iPod"):
+		return OSiOS
+	case strings.Contains(ua, "Android"):
+		return OSAndroid
+	case strings.Contains(ua, "Windows"):
+		return OSWindows
+	case strings.Contains(ua, "CrOS"):
+		return OSChromeOS
+	// iPadOS Safari asks for desktop sites with a Macintosh User-Agent and
+	// is indistinguishable from macOS here
+	case strings.Contains(ua, "Macintosh"):
+		return OSMacOS
+	case strings.Contains(ua, "Linux"):
+		return OSLinux
+	}
+	return ""
+}
+
+func parseDevice(ua, os string) string {
+	switch {
+	case ua == "":
+		return ""
+	case containsAny(ua, "iPad", "Tablet"):
+		return DeviceTablet
+	case containsAny(ua, "Mobi", "iPhone", "iPod", "Windows Phone"):
+		return DeviceMobile
+	// Android phones carry a "Mobile" token, tablets do not
+	case os == OSAndroid:
+		return DeviceTablet
+	}
+	return DeviceDesktop
+}
+
+func parseBrowser(ua string) string {
+	// Order matters: most browsers also claim to be Chrome and Safari
+	switch {
+	case containsAny(ua, "Edg/", "EdgA/", "EdgiOS/", "Edge/"):
+		return BrowserEdge
+	case containsAny(ua, "OPR/", "OPT/", "Opera", "OPiOS/"):
+		return BrowserOpera
+	case strings.Contains(ua, "SamsungBrowser/"):
+		return BrowserSamsung
+	case containsAny(ua, "Firefox/", "FxiOS/"):
+		return BrowserFirefox
+	case containsAny(ua, "Chrome/", "CriOS/", "Chromium/"):
+		return BrowserChrome
+	case strings.Contains(ua, "Safari/"):
+		return BrowserSafari
+	}
+	return ""
+}
+
+// platformHint maps the quoted Sec-CH-UA-Platform value.
+func platformHint(value string) string {
+	switch strings.Trim(value, `" `) {
+	case "iOS":
+		return OSiOS
+	case "Android":
+		return OSAndroid
+	case "Windows":
+		return OSWindows
+	case "macOS":
+		return OSMacOS
+	case "Linux":
+		return OSLinux
+	case "Chrome OS", "ChromeOS":
+		return OSChromeOS
+	}
+	return ""
+}
+
+// brandHint picks the browser from a Sec-CH-UA brand list such as
+// `"Chromium";v="124", "Microsoft Edge";v="124", "Not-A.Brand";v="99"`.
+func brandHint(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	var brands []string
+	for entry := range strings.SplitSeq(value, ",") {
+		brand, _, _ := strings.Cut(entry, ";")
+		brands = append(brands, strings.Trim(brand, `" `))
+	}
+
+	// Specific brands before the generic Chromium one
+	for _, b := range []struct{ brand, browser string }{
+		{"Microsoft Edge", BrowserEdge},
+		{"Opera", BrowserOpera},
+		{"Samsung Internet", BrowserSamsung},
+		{"Google Chrome", BrowserChrome},
+		{"Chromium", BrowserChrome},
+	} {
+		for _, brand := range brands {
+			if brand == b.brand {
+				return b.browser
+			}
+		}
+	}
+	return ""
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+// Package wellknown serves the app association files that let iOS and
+// Android open links of the redirect domains in an app.
+package wellknown
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Names of the files, as served under /.well-known/.
+const (
+	AppleAppSiteAssociation = "apple-app-site-association"
+	AssetLinks              = "assetlinks.json"
+)
+
+// Files holds the contents of the association files. They are read from
+// disk and can be reloaded in place.
+type Files struct {
+	paths map[string]string
+	files atomic.Pointer[map[string][]byte]
+}
+
+// Open reads the files at paths, keyed by their name. Names with an empty
+// path are not served.
+func Open(paths map[string]string) (*Files, error) {
+	f := &Files{paths: make(map[string]string, len(paths))}
+	for name, path := range paths {
+		if path != "" {
+			f.paths[name] = path
+		}
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload re-reads every file. If one cannot be read or is not valid JSON,
+// the previous contents stay in use.
+func (f *Files) Reload() error {
+	files := make(map[string][]byte, len(f.paths))
+	for name, path := range f.paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("%s is not valid JSON", name)
+		}
+		files[name] = data
+	}
+	f.files.Store(&files)
+	return nil
+}
+
+// Get returns the contents of the named file, and false if it is not
+// served. A nil *Files serves nothing.
+func (f *Files) Get(name string) ([]byte, bool) {
+	if f == nil {
+		return nil, false
+	}
+	files := f.files.Load()
+	if files == nil {
+		return nil, false
+	}
+	data, ok := (*files)[name]
+	return data, ok
+}
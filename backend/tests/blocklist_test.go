@@ -0,0 +1,297 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/blocklist"
+	"github.com/nekogravitycat/linkhub/internal/fallback"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBlocklist = `# Plain domains
+evil.example
+*.wildcard.example
+.dotted.example
+Upper.Example.
+
+# Hosts file
+0.0.0.0 hosts-a.example hosts-b.example # inline comment
+127.0.0.1 localhost
+::1 ip6-localhost
+
+! Adblock
+[Adblock Plus 2.0]
+||adblock.example^
+||options.example^$all
+||third-party.example^$third-party
+||adblock.example/ads/*
+@@||safe.evil.example^
+/banner/*
+`
+
+func writeBlocklist(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestBlocklist_Formats(t *testing.T) {
+	list, err := blocklist.Open([]string{writeBlocklist(t, testBlocklist)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		host    string
+		blocked bool
+	}{
+		{"evil.example", true},
+		{"www.evil.example", true},
+		{"a.b.evil.example", true},
+		{"notevil.example", false},
+		{"example", false},
+		{"wildcard.example", true},
+		{"x.wildcard.example", true},
+		{"dotted.example", true},
+		{"upper.example", true},
+		{"hosts-a.example", true},
+		{"cdn.hosts-b.example", true},
+		{"localhost", false},
+		{"adblock.example", true},
+		{"options.example", true},
+		{"third-party.example", false},
+		{"safe.evil.example", false},
+		{"www.safe.evil.example", false},
+		{"unlisted.example", false},
+	}
+	for _, tt := range tests {
+		_, blocked := list.Match(tt.host)
+		assert.Equal(t, tt.blocked, blocked, tt.host)
+	}
+
+	entry, _ := list.Match("www.evil.example")
+	assert.Equal(t, "evil.example in blocklist.txt", entry)
+
+	stats := list.Stats()
+	assert.Equal(t, 8, stats.Blocked)
+	assert.Equal(t, 1, stats.Exceptions)
+	assert.Equal(t, 5, stats.Skipped)
+
+	var none *blocklist.List
+	_, blocked := none.Match("evil.example")
+	assert.False(t, blocked)
+}
+
+func TestBlocklist_Reload(t *testing.T) {
+	path := writeBlocklist(t, "first.example\n")
+	list, err := blocklist.Open([]string{path})
+	require.NoError(t, err)
+
+	t.Run("Reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("second.example\n"), 0o600))
+		require.NoError(t, list.Reload())
+
+		_, blocked := list.Match("second.example")
+		assert.True(t, blocked)
+		_, blocked = list.Match("first.example")
+		assert.False(t, blocked)
+	})
+
+	t.Run("Missing File Keeps Previous", func(t *testing.T) {
+		missing, err := blocklist.Open([]string{path})
+		require.NoError(t, err)
+		require.NoError(t, os.Rename(path, path+".bak"))
+		defer os.Rename(path+".bak", path)
+
+		assert.Error(t, missing.Reload())
+		_, blocked := missing.Match("second.example")
+		assert.True(t, blocked)
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go list.Watch(ctx, 10*time.Millisecond)
+
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, os.WriteFile(path, []byte("second.example\nthird.example\n"), 0o600))
+
+		assert.Eventually(t, func() bool {
+			_, blocked := list.Match("third.example")
+			return blocked
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Missing File On Start", func(t *testing.T) {
+		_, err := blocklist.Open([]string{filepath.Join(t.TempDir(), "missing.txt")})
+		assert.Error(t, err)
+	})
+}
+
+func TestURLPolicy_Blocklist(t *testing.T) {
+	list, err := blocklist.Open([]string{writeBlocklist(t, "evil.example\n")})
+	require.NoError(t, err)
+
+	policy, err := urlpolicy.New(urlpolicy.Options{Blocklist: list})
+	require.NoError(t, err)
+
+	_, err = policy.Check("https://login.EVIL.example/")
+	var violation *urlpolicy.Violation
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, urlpolicy.CodeBlocklisted, violation.Code)
+	assert.Contains(t, violation.Error(), "evil.example in blocklist.txt")
+
+	_, err = policy.Check("https://example.com/")
+	assert.NoError(t, err)
+}
+
+func TestHTTP_BlocklistPreview(t *testing.T) {
+	list, err := blocklist.Open([]string{writeBlocklist(t, "evil.example\n")})
+	require.NoError(t, err)
+	pages, err := fallback.New(fallback.Options{})
+	require.NoError(t, err)
+
+	// Saved before evil.example was listed
+	repo := &countingRepo{links: map[string]*links.Link{
+		"bl-preview": {ID: 1, Slug: "bl-preview", URL: "https://www.evil.example/login", IsActive: true},
+	}}
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{Fallback: pages, Blocklist: list}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/preview/bl-preview", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Link blocked")
+	assert.NotContains(t, w.Body.String(), "evil.example")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/preview/bl-preview?format=json", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"error": "link destination is blocked", "code": "blocklisted"}`, w.Body.String())
+}
+
+func TestHTTP_BlocklistDeepLink(t *testing.T) {
+	list, err := blocklist.Open([]string{writeBlocklist(t, "evil.example\n")})
+	require.NoError(t, err)
+	pages, err := fallback.New(fallback.Options{})
+	require.NoError(t, err)
+
+	repo := &countingRepo{links: map[string]*links.Link{
+		"bl-deeplink": {ID: 1, Slug: "bl-deeplink", URL: "https://example.com/item/1", IsActive: true, DeepLink: &links.DeepLink{
+			IOSURL:      "myapp://item/1",
+			IOSStoreURL: "https://apps.evil.example/app/id1",
+			AndroidURL:  "https://www.evil.example/app/item/1",
+		}},
+	}}
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{Fallback: pages, Blocklist: list}))
+
+	visit := func(userAgent string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/redirect/bl-deeplink", nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", "text/html")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for name, userAgent := range map[string]string{"Store URL": iPhoneUA, "App URL": androidUA} {
+		t.Run(name, func(t *testing.T) {
+			w := visit(userAgent)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Contains(t, w.Body.String(), "Link blocked")
+			assert.NotContains(t, w.Body.String(), "evil.example")
+		})
+	}
+
+	t.Run("Destination", func(t *testing.T) {
+		w := visit(desktopUA)
+		assert.Equal(t, http.StatusFound, w.Code, "visitors without the app never see its URLs")
+		assert.Equal(t, "https://example.com/item/1", w.Header().Get("Location"))
+	})
+}
+
+func TestHTTP_Blocklist(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+
+	path := writeBlocklist(t, "evil.example\n")
+	list, err := blocklist.Open([]string{path})
+	require.NoError(t, err)
+	policy, err := urlpolicy.New(urlpolicy.Options{Blocklist: list})
+	require.NoError(t, err)
+	pages, err := fallback.New(fallback.Options{})
+	require.NoError(t, err)
+
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(
+		links.NewServiceWithOptions(repo, "localhost:8003", links.ServiceOptions{Policy: policy}),
+		lhttp.Options{Fallback: pages, Blocklist: list},
+	))
+
+	send := func(method, path, userAgent string, body any) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("User-Agent", userAgent)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().Format("150405000000")
+
+	t.Run("Create", func(t *testing.T) {
+		w := send("POST", "/links", "", map[string]any{"slug": "bl-create-" + suffix, "url": "https://www.evil.example/"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"blocklisted"`)
+	})
+
+	t.Run("Listed After Creation", func(t *testing.T) {
+		slug := "bl-later-" + suffix
+		w := send("POST", "/links", "", map[string]any{"slug": slug, "url": "https://later.example/login", "og_title": "Later"})
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		assert.Equal(t, http.StatusFound, send("GET", "/redirect/"+slug, desktopUA, nil).Code)
+
+		require.NoError(t, os.WriteFile(path, []byte("evil.example\nlater.example\n"), 0o600))
+		require.NoError(t, list.Reload())
+
+		w = send("GET", "/redirect/"+slug, desktopUA, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Contains(t, w.Body.String(), "Link blocked")
+
+		// Link previews do not get the card either
+		w = send("GET", "/redirect/"+slug, slackbotUA, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Variant Listed After Creation", func(t *testing.T) {
+		slug := "bl-variant-" + suffix
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com/"}))
+		link, err := repo.GetBySlug(ctx, 0, slug)
+		require.NoError(t, err)
+		require.NoError(t, repo.CreateVariant(ctx, &links.Variant{LinkID: link.ID, URL: "https://evil.example/", Weight: 1}))
+		require.NoError(t, repo.CreateVariant(ctx, &links.Variant{LinkID: link.ID, URL: "https://example.com/b", Weight: 0}))
+
+		assert.Equal(t, http.StatusForbidden, send("GET", "/redirect/"+slug, desktopUA, nil).Code)
+	})
+}
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/botdetect"
+	"github.com/nekogravitycat/linkhub/internal/clicks"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestBotDetect_Default(t *testing.T) {
+	classifier := botdetect.Default()
+
+	tests := []struct {
+		name       string
+		method     string
+		userAgent  string
+		accept     string
+		wantBot    bool
+		wantReason string
+	}{
+		{"chrome", "GET", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", browserAccept, false, ""},
+		{"iphone safari", "GET", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", browserAccept, false, ""},
+		{"cubot phone", "GET", "Mozilla/5.0 (Linux; Android 9; CUBOT X19) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", browserAccept, false, ""},
+		{"pinterest app", "GET", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [Pinterest/iOS]", browserAccept, false, ""},
+		{"slack", "GET", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", "*/*", true, botdetect.ReasonUserAgent},
+		{"discord", "GET", "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", "*/*", true, botdetect.ReasonUserAgent},
+		{"twitter", "GET", "Twitterbot/1.0", "*/*", true, botdetect.ReasonUserAgent},
+		{"facebook", "GET", "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", "*/*", true, botdetect.ReasonUserAgent},
+		{"googlebot", "GET", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "*/*", true, botdetect.ReasonUserAgent},
+		{"curl", "GET", "curl/8.4.0", "*/*", true, botdetect.ReasonUserAgent},
+		{"go client", "GET", "Go-http-client/1.1", "", true, botdetect.ReasonUserAgent},
+		{"empty user agent", "GET", "", browserAccept, true, botdetect.ReasonNoUserAgent},
+		{"head request", "HEAD", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/124.0.0.0", browserAccept, true, botdetect.ReasonHead},
+		{"missing accept", "GET", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/124.0.0.0", "", true, botdetect.ReasonNoAccept},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/redirect/x", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			got := classifier.Classify(req)
+			assert.Equal(t, tt.wantBot, got.Bot)
+			assert.Equal(t, tt.wantReason, got.Reason)
+		})
+	}
+}
+
+func TestBotDetect_IsLinkPreview(t *testing.T) {
+	assert.True(t, botdetect.IsLinkPreview("Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"))
+	assert.True(t, botdetect.IsLinkPreview("facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)"))
+	assert.True(t, botdetect.IsLinkPreview("WhatsApp/2.23.20.0"))
+	assert.True(t, botdetect.IsLinkPreview("TelegramBot (like TwitterBot)"))
+
+	assert.False(t, botdetect.IsLinkPreview("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"))
+	assert.False(t, botdetect.IsLinkPreview("curl/8.4.0"))
+	assert.False(t, botdetect.IsLinkPreview("Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/124.0.0.0"))
+	assert.False(t, botdetect.IsLinkPreview(""))
+}
+
+func TestBotDetect_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n\nExampleBot\n"), 0o600))
+
+	classifier, err := botdetect.Open(path)
+	require.NoError(t, err)
+
+	classify := func(userAgent string) bool {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", browserAccept)
+		return classifier.Classify(req).Bot
+	}
+
+	assert.True(t, classify("Mozilla/5.0 (compatible; examplebot/1.0)"))
+	assert.False(t, classify("Slackbot-LinkExpanding 1.0"), "the file replaces the built-in list")
+
+	t.Run("Reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("Slackbot\n"), 0o600))
+		require.NoError(t, classifier.Reload())
+		assert.True(t, classify("Slackbot-LinkExpanding 1.0"))
+		assert.False(t, classify("examplebot/1.0"))
+	})
+
+	t.Run("Invalid Pattern Keeps Previous List", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("ok\n(unclosed\n"), 0o600))
+		err := classifier.Reload()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "line 2")
+		assert.True(t, classify("Slackbot-LinkExpanding 1.0"))
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		_, err := botdetect.Open(filepath.Join(t.TempDir(), "missing.txt"))
+		assert.Error(t, err)
+	})
+}
+
+func TestHTTP_BotClicks(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	linkRepo := links.NewRepository(testPool)
+	rec := clicks.NewRecorder(clicks.NewRepository(testPool), clicks.RecorderOptions{})
+
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(linkRepo, "localhost:8003"), lhttp.Options{
+		Recorder: rec,
+		Bots:     botdetect.Default(),
+	}))
+
+	slug := "clicks-bot-" + time.Now().Format("150405000000")
+	require.NoError(t, linkRepo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com"}))
+	link, err := linkRepo.GetBySlug(ctx, 0, slug)
+	require.NoError(t, err)
+
+	redirect := func(method, userAgent string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/redirect/"+slug, nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", browserAccept)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code, "bots are redirected too")
+	}
+
+	redirect("GET", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15")
+	redirect("GET", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+	redirect("HEAD", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) Safari/605.1.15")
+
+	require.NoError(t, rec.Close(ctx))
+
+	var humans, bots int
+	err = testPool.QueryRow(ctx,
+		"SELECT COUNT(*) FILTER (WHERE NOT is_bot), COUNT(*) FILTER (WHERE is_bot) FROM clicks WHERE link_id = $1",
+		link.ID,
+	).Scan(&humans, &bots)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, humans)
+	assert.Equal(t, 2, bots)
+}
+
+// consumingRepo is a countingRepo that counts spent clicks.
+type consumingRepo struct {
+	countingRepo
+	consumed int
+}
+
+func (r *consumingRepo) ConsumeClick(context.Context, int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consumed++
+	return nil
+}
+
+func TestHTTP_BotsDoNotSpendClicks(t *testing.T) {
+	maxClicks := int64(1)
+	repo := &consumingRepo{countingRepo: countingRepo{links: map[string]*links.Link{
+		"once": {ID: 1, Slug: "once", URL: "https://example.com/", IsActive: true, MaxClicks: &maxClicks},
+	}}}
+
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{
+		Bots: botdetect.Default(),
+	}))
+
+	redirect := func(method, userAgent string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/redirect/once", nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", browserAccept)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+
+	// The unfurl and a HEAD probe come first, and leave the click for the person
+	redirect("GET", slackbotUA)
+	redirect("HEAD", desktopUA)
+	assert.Zero(t, repo.consumed)
+
+	redirect("GET", desktopUA)
+	assert.Equal(t, 1, repo.consumed)
+}
@@ -0,0 +1,315 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/config"
+	"github.com/nekogravitycat/linkhub/internal/database"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("Evicts Least Recently Used", func(t *testing.T) {
+		c := lru.New[string, int](2)
+		c.Set("a", 1, time.Minute)
+		c.Set("b", 2, time.Minute)
+		c.Get("a")
+		c.Set("c", 3, time.Minute)
+
+		_, ok := c.Get("b")
+		assert.False(t, ok)
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+
+		stats := c.Stats()
+		assert.Equal(t, uint64(1), stats.Evictions)
+		assert.Equal(t, 2, stats.Size)
+		assert.Equal(t, uint64(2), stats.Hits)
+		assert.Equal(t, uint64(1), stats.Misses)
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		c := lru.New[string, int](10)
+		c.Set("a", 1, 20*time.Millisecond)
+		_, ok := c.Get("a")
+		assert.True(t, ok)
+
+		time.Sleep(30 * time.Millisecond)
+		_, ok = c.Get("a")
+		assert.False(t, ok)
+		assert.Equal(t, 0, c.Stats().Size)
+	})
+
+	t.Run("Delete And Purge", func(t *testing.T) {
+		c := lru.New[string, int](10)
+		c.Set("a", 1, time.Minute)
+		c.Set("b", 2, time.Minute)
+
+		c.Delete("a")
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+
+		c.Purge()
+		assert.Equal(t, 0, c.Stats().Size)
+	})
+}
+
+// countingRepo serves a fixed set of links and counts the lookups. Methods
+// it does not override are not expected to be called.
+type countingRepo struct {
+	links.Repository
+
+	mu      sync.Mutex
+	links   map[string]*links.Link
+	lookups int
+}
+
+func (r *countingRepo) GetBySlug(_ context.Context, _ int64, slug string) (*links.Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookups++
+	link, ok := r.links[slug]
+	if !ok {
+		return nil, links.ErrLinkNotFound
+	}
+	copied := *link
+	return &copied, nil
+}
+
+func (r *countingRepo) ListVariants(context.Context, int64) ([]links.Variant, error) {
+	return nil, nil
+}
+
+func (r *countingRepo) Update(_ context.Context, link *links.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.links[link.Slug] = link
+	return nil
+}
+
+func (r *countingRepo) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+func TestResolveCache(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func() (*countingRepo, *links.ResolveCache, links.Service) {
+		repo := &countingRepo{links: map[string]*links.Link{
+			"cached": {ID: 1, Slug: "cached", URL: "https://example.com/a", IsActive: true},
+		}}
+		cache := links.NewResolveCache(links.CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+		return repo, cache, links.NewServiceWithOptions(repo, "localhost:8003", links.ServiceOptions{Cache: cache})
+	}
+
+	t.Run("Inactive Cache Passes Through", func(t *testing.T) {
+		repo, _, svc := setup()
+		for range 3 {
+			_, err := svc.Resolve(ctx, 0, "cached")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 3, repo.count())
+	})
+
+	t.Run("Hits", func(t *testing.T) {
+		repo, cache, svc := setup()
+		cache.SetActive(true)
+
+		for range 3 {
+			link, err := svc.Resolve(ctx, 0, "cached")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com/a", link.URL)
+		}
+		assert.Equal(t, 1, repo.count())
+
+		stats := cache.Stats()
+		assert.Equal(t, uint64(2), stats.Hits)
+		assert.Equal(t, uint64(1), stats.Misses)
+		assert.InDelta(t, 2.0/3.0, stats.HitRatio, 0.001)
+		assert.True(t, stats.Active)
+	})
+
+	t.Run("Negative Entries", func(t *testing.T) {
+		repo, cache, svc := setup()
+		cache.SetActive(true)
+
+		for range 2 {
+			_, err := svc.Resolve(ctx, 0, "unknown")
+			assert.ErrorIs(t, err, links.ErrLinkNotFound)
+		}
+		assert.Equal(t, 1, repo.count())
+	})
+
+	t.Run("Availability Checked On Every Hit", func(t *testing.T) {
+		repo, cache, svc := setup()
+		cache.SetActive(true)
+		until := time.Now().Add(50 * time.Millisecond)
+		repo.links["cached"].ActiveUntil = &until
+
+		_, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+
+		time.Sleep(60 * time.Millisecond)
+		_, err = svc.Resolve(ctx, 0, "cached")
+		assert.ErrorIs(t, err, links.ErrLinkExpired)
+		assert.Equal(t, 1, repo.count())
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		repo, cache, svc := setup()
+		cache.SetActive(true)
+
+		_, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+
+		// A change made by another instance, reported by the listener
+		repo.links["cached"] = &links.Link{ID: 1, Slug: "cached", URL: "https://example.com/b", IsActive: true}
+		cache.Invalidate("cached")
+
+		link, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/b", link.URL)
+		assert.Equal(t, uint64(1), cache.Stats().Invalidations)
+	})
+
+	t.Run("Own Updates Invalidate", func(t *testing.T) {
+		_, cache, svc := setup()
+		cache.SetActive(true)
+
+		_, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+
+		_, err = svc.Update(ctx, 0, "cached", links.UpdateLinkInput{URL: ptrString("https://example.com/c")})
+		require.NoError(t, err)
+
+		link, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/c", link.URL)
+	})
+
+	t.Run("Deactivation Empties The Cache", func(t *testing.T) {
+		repo, cache, svc := setup()
+		cache.SetActive(true)
+
+		_, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+
+		cache.SetActive(false)
+		cache.SetActive(true)
+		_, err = svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+		assert.Equal(t, 2, repo.count())
+		assert.Equal(t, 1, cache.Stats().Size)
+	})
+
+	t.Run("Domains Are Cached Apart", func(t *testing.T) {
+		repo, cache, svc := setup()
+		cache.SetActive(true)
+
+		for _, domainID := range []int64{0, 7, 0, 7} {
+			_, err := svc.Resolve(ctx, domainID, "cached")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, repo.count())
+
+		// Keys as announced by the schema's triggers
+		cache.Invalidate("7/cached")
+		_, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+		_, err = svc.Resolve(ctx, 7, "cached")
+		require.NoError(t, err)
+		assert.Equal(t, 3, repo.count())
+	})
+
+	t.Run("Copies", func(t *testing.T) {
+		_, cache, svc := setup()
+		cache.SetActive(true)
+
+		link, err := svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+		link.URL = "https://mutated.example.com"
+
+		link, err = svc.Resolve(ctx, 0, "cached")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/a", link.URL)
+	})
+}
+
+func TestListener_LinkChanges(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	connected := make(chan struct{}, 1)
+	notified := make(chan string, 16)
+	listener := &database.Listener{
+		DSN:       cfg.TestDatabaseDSN,
+		Channel:   links.NotifyChannel,
+		OnNotify:  func(slug string) { notified <- slug },
+		OnConnect: func() { connected <- struct{}{} },
+	}
+	go listener.Run(ctx)
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not connect")
+	}
+
+	expect := func(slug string) {
+		t.Helper()
+		select {
+		case got := <-notified:
+			assert.Equal(t, slug, got)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no notification for %s", slug)
+		}
+	}
+
+	repo := links.NewRepository(testPool)
+	slug := fmt.Sprintf("notify-%d", time.Now().UnixNano()%1e9)
+	maxClicks := int64(5)
+
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com", MaxClicks: &maxClicks}))
+	expect(slug)
+
+	link, err := repo.GetBySlug(ctx, 0, slug)
+	require.NoError(t, err)
+
+	// Consuming a click is not announced
+	require.NoError(t, repo.ConsumeClick(ctx, link.ID))
+
+	link.URL = "https://example.com/updated"
+	require.NoError(t, repo.Update(ctx, link))
+	expect(slug)
+
+	require.NoError(t, repo.CreateVariant(ctx, &links.Variant{LinkID: link.ID, URL: "https://example.com/v", Weight: 1}))
+	expect(slug)
+
+	require.NoError(t, repo.Delete(ctx, 0, slug))
+	expect(slug)
+
+	select {
+	case got := <-notified:
+		t.Errorf("unexpected notification for %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
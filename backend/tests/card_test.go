@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const slackbotUA = "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"
+
+func TestHTTP_Card(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := setupRouter()
+	slug := "card-" + time.Now().Format("150405000000")
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	visit := func(userAgent string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", browserAccept)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Invalid Image", func(t *testing.T) {
+		for _, image := range []string{"ftp://example.com/a.png", "/a.png"} {
+			w := send("POST", "/links", map[string]any{"slug": slug, "url": "https://example.com", "og_image_url": image})
+			assert.Equal(t, http.StatusBadRequest, w.Code, image)
+		}
+	})
+
+	w := send("POST", "/links", map[string]any{
+		"slug":           slug,
+		"url":            "https://example.com/sale",
+		"og_title":       "  Summer <sale>  ",
+		"og_description": "Everything must go",
+		"og_image_url":   "https://cdn.example.com/sale.png",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("Link Previews Get The Card", func(t *testing.T) {
+		w := visit(slackbotUA)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Vary"), "User-Agent")
+
+		body := w.Body.String()
+		assert.Contains(t, body, `<meta property="og:title" content="Summer &lt;sale&gt;" />`)
+		assert.Contains(t, body, `<meta name="twitter:description" content="Everything must go" />`)
+		assert.Contains(t, body, `<meta property="og:image" content="https://cdn.example.com/sale.png" />`)
+		assert.Contains(t, body, `<meta name="twitter:card" content="summary_large_image" />`)
+		assert.Contains(t, body, `<meta property="og:url" content="http://localhost:8003/`+slug+`" />`)
+		assert.NotContains(t, body, "https://example.com/sale")
+	})
+
+	t.Run("People Are Redirected", func(t *testing.T) {
+		w := visit("Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/124.0.0.0")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/sale", w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Get("Vary"), "User-Agent")
+	})
+
+	t.Run("Other Bots Are Redirected", func(t *testing.T) {
+		w := visit("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+
+	t.Run("Response", func(t *testing.T) {
+		w := send("GET", "/links/"+slug, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Summer <sale>", resp["og_title"])
+		assert.Equal(t, "https://cdn.example.com/sale.png", resp["og_image_url"])
+	})
+
+	t.Run("Partial Card", func(t *testing.T) {
+		w := send("PATCH", "/links/"+slug, map[string]any{"og_image_url": nil, "og_description": ""})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		body := visit(slackbotUA).Body.String()
+		assert.Contains(t, body, `<meta name="twitter:card" content="summary" />`)
+		assert.NotContains(t, body, "og:image")
+		assert.NotContains(t, body, "og:description")
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		w := send("PATCH", "/links/"+slug, map[string]any{"og_title": nil})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = visit(slackbotUA)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/sale", w.Header().Get("Location"))
+	})
+}
@@ -0,0 +1,283 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/domains"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/slugs"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedDomains serves a fixed set of short domains by host.
+type fixedDomains map[string]*domains.Domain
+
+func (d fixedDomains) Lookup(host string) *domains.Domain {
+	return d[host]
+}
+
+func TestService_RedirectLoops(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepo{links: map[string]*links.Link{
+		"loop": {ID: 1, Slug: "loop", URL: "https://example.com/", IsActive: true},
+	}}
+	svc := links.NewServiceWithOptions(repo, "sho.rt", links.ServiceOptions{
+		Domains: fixedDomains{"go.example.com": {ID: 7, Host: "go.example.com"}},
+	})
+
+	tests := []struct {
+		url  string
+		loop bool
+	}{
+		{"https://sho.rt/x", true},
+		{"HTTPS://SHO.RT/x", true},
+		{"https://sho.rt./x", true},
+		{"https://sho.rt:443/x", true},
+		{"http://sho.rt:8080/x", true},
+		{"https://sho.rt", true},
+		{"https://user@sho.rt/x", true},
+		{"https://go.example.com/x", true},
+		{"https://Go.Example.com/x", true},
+		{"https://notsho.rt/x", false},
+		{"https://www.sho.rt/x", false},
+		{"https://example.com/?next=https://sho.rt/x", false},
+		{"https://sho.rt@example.com/", false},
+	}
+	for _, tt := range tests {
+		_, err := svc.Update(ctx, 0, "loop", links.UpdateLinkInput{URL: ptrString(tt.url)})
+		if tt.loop {
+			assert.ErrorIs(t, err, links.ErrRedirectLoop, tt.url)
+			assert.EqualError(t, err, "target url cannot contain redirect domain")
+		} else {
+			assert.NoError(t, err, tt.url)
+		}
+	}
+
+	t.Run("Ports", func(t *testing.T) {
+		svc := links.NewService(repo, "localhost:8003")
+
+		_, err := svc.Update(ctx, 0, "loop", links.UpdateLinkInput{URL: ptrString("http://LOCALHOST:8003/x")})
+		assert.ErrorIs(t, err, links.ErrRedirectLoop)
+
+		// Another server on the same host is not a loop, but private
+		_, err = svc.Update(ctx, 0, "loop", links.UpdateLinkInput{URL: ptrString("http://localhost:9000/x")})
+		assert.ErrorIs(t, err, urlpolicy.ErrNotAllowed)
+	})
+}
+
+func TestService_LinkChains(t *testing.T) {
+	ctx := context.Background()
+
+	// c -> b -> a -> example.com
+	setup := func() links.Service {
+		repo := &countingRepo{links: map[string]*links.Link{
+			"a": {ID: 1, Slug: "a", URL: "https://example.com/", IsActive: true},
+			"b": {ID: 2, Slug: "b", URL: "https://sho.rt/a", IsActive: true},
+			"c": {ID: 3, Slug: "c", URL: "https://sho.rt/b", IsActive: true},
+			"d": {ID: 4, Slug: "d", URL: "https://example.com/", IsActive: true},
+		}}
+		return links.NewServiceWithOptions(repo, "sho.rt", links.ServiceOptions{
+			Domains:       fixedDomains{"go.example.com": {ID: 7, Host: "go.example.com"}},
+			MaxChainDepth: 2,
+		})
+	}
+
+	t.Run("Chains Within Depth", func(t *testing.T) {
+		svc := setup()
+		_, err := svc.Update(ctx, 0, "d", links.UpdateLinkInput{URL: ptrString("https://sho.rt/b")})
+		assert.NoError(t, err)
+		_, err = svc.Update(ctx, 0, "d", links.UpdateLinkInput{URL: ptrString("https://sho.rt/missing")})
+		assert.NoError(t, err, "links that do not exist yet end the chain")
+	})
+
+	t.Run("Too Long", func(t *testing.T) {
+		svc := setup()
+		_, err := svc.Update(ctx, 0, "d", links.UpdateLinkInput{URL: ptrString("https://sho.rt/c")})
+		assert.ErrorIs(t, err, links.ErrChainTooLong)
+	})
+
+	t.Run("Self", func(t *testing.T) {
+		svc := setup()
+		_, err := svc.Update(ctx, 0, "a", links.UpdateLinkInput{URL: ptrString("https://SHO.RT/a/")})
+		assert.ErrorIs(t, err, links.ErrRedirectCycle)
+	})
+
+	t.Run("Cycle Through Update", func(t *testing.T) {
+		svc := setup()
+		_, err := svc.Update(ctx, 0, "a", links.UpdateLinkInput{URL: ptrString("https://sho.rt/b")})
+		assert.ErrorIs(t, err, links.ErrRedirectCycle)
+	})
+
+	t.Run("Cycle Through Rules", func(t *testing.T) {
+		svc := setup()
+		_, err := svc.Update(ctx, 0, "a", links.UpdateLinkInput{CountryRules: &[]links.CountryRule{
+			{Country: "TW", URL: "https://sho.rt/c"},
+		}})
+		assert.ErrorIs(t, err, links.ErrRedirectCycle)
+
+		_, err = svc.Update(ctx, 0, "b", links.UpdateLinkInput{DeviceRules: &[]links.DeviceRule{
+			{OS: "ios", URL: "https://sho.rt/c"},
+		}})
+		assert.ErrorIs(t, err, links.ErrRedirectCycle)
+	})
+
+	t.Run("Cycle Through Other Domain", func(t *testing.T) {
+		svc := setup()
+		// countingRepo ignores domains, so go.example.com/c is c
+		_, err := svc.Update(ctx, 0, "a", links.UpdateLinkInput{URL: ptrString("https://go.example.com/c")})
+		assert.ErrorIs(t, err, links.ErrRedirectCycle)
+	})
+
+	t.Run("Cycle Through Generated Slug", func(t *testing.T) {
+		// x points at the short link that the first generated slug names
+		first, second := slugs.NewHashID("s").Slug(1, 6), slugs.NewHashID("s").Slug(2, 6)
+		setup := func() links.Service {
+			generator, err := slugs.New(slugs.Options{Strategy: slugs.StrategyHashID, Salt: "s"})
+			require.NoError(t, err)
+			repo := &creatingRepo{countingRepo: &countingRepo{links: map[string]*links.Link{
+				"x": {ID: 10, Slug: "x", URL: "https://sho.rt/" + first, IsActive: true},
+			}}}
+			return links.NewServiceWithOptions(repo, "sho.rt", links.ServiceOptions{MaxChainDepth: 2, Slugs: generator})
+		}
+
+		link, _, err := setup().Create(ctx, links.CreateLinkInput{URL: "https://sho.rt/x"})
+		require.NoError(t, err)
+		assert.Equal(t, second, link.Slug, "a slug closing the cycle is passed over")
+
+		link, _, err = setup().Create(ctx, links.CreateLinkInput{
+			URL:          "https://example.com/",
+			CountryRules: []links.CountryRule{{Country: "TW", URL: "https://sho.rt/x"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, second, link.Slug, "rule destinations are checked too")
+	})
+
+	t.Run("Deep Links Never Chain", func(t *testing.T) {
+		svc := setup()
+		_, err := svc.Update(ctx, 0, "d", links.UpdateLinkInput{DeepLink: requestNullable(&links.DeepLink{AndroidURL: "https://sho.rt/a"})})
+		assert.ErrorIs(t, err, links.ErrRedirectLoop)
+	})
+}
+
+// creatingRepo is a countingRepo that also creates links, under IDs it
+// hands out in order.
+type creatingRepo struct {
+	*countingRepo
+	nextID int64
+}
+
+func (r *creatingRepo) NextID(context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	return r.nextID, nil
+}
+
+func (r *creatingRepo) Create(_ context.Context, link *links.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.links[link.Slug]; ok {
+		return links.ErrSlugTaken
+	}
+	r.links[link.Slug] = link
+	return nil
+}
+
+func TestURLPolicy_Shorteners(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		warnings, err := urlpolicy.Default().Check("https://BIT.LY/abc")
+		require.NoError(t, err)
+		require.Len(t, warnings, 1)
+		assert.Equal(t, urlpolicy.CodeShortener, warnings[0].Code)
+
+		warnings, err = urlpolicy.Default().Check("https://notbit.ly/abc")
+		require.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		policy, err := urlpolicy.New(urlpolicy.Options{Shorteners: []string{"sho.rt"}})
+		require.NoError(t, err)
+
+		warnings, err := policy.Check("https://go.sho.rt/abc")
+		require.NoError(t, err)
+		require.Len(t, warnings, 1)
+		assert.Equal(t, urlpolicy.CodeShortener, warnings[0].Code)
+
+		warnings, err = policy.Check("https://bit.ly/abc")
+		require.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+}
+
+func TestHTTP_LinkChains(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := gin.New()
+	svc := links.NewServiceWithOptions(links.NewRepository(testPool), "localhost:8003", links.ServiceOptions{MaxChainDepth: 3})
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(svc, lhttp.Options{}))
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().Format("150405000000")
+	first, second := "chain-a-"+suffix, "chain-b-"+suffix
+	shortURL := func(slug string) string { return "http://localhost:8003/" + slug }
+
+	require.Equal(t, http.StatusCreated, send("POST", "/links", map[string]any{"slug": first, "url": "https://example.com/"}).Code)
+	require.Equal(t, http.StatusCreated, send("POST", "/links", map[string]any{"slug": second, "url": shortURL(first)}).Code)
+
+	t.Run("Update", func(t *testing.T) {
+		w := send("PATCH", "/links/"+first, map[string]any{"url": shortURL(second)})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), links.ErrRedirectCycle.Error())
+	})
+
+	t.Run("Variant", func(t *testing.T) {
+		w := send("POST", "/links/"+first+"/variants", map[string]any{"url": shortURL(second), "weight": 1})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = send("POST", "/links/"+first+"/variants", map[string]any{"url": "https://example.com/b", "weight": 1})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var variant links.Variant
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &variant))
+
+		w = send("PATCH", "/links/"+first+"/variants/"+strconv.FormatInt(variant.ID, 10), map[string]any{"url": shortURL(second)})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Language Rule", func(t *testing.T) {
+		w := send("PUT", "/links/"+first+"/languages/en", map[string]any{"url": shortURL(second)})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Slug Created Later", func(t *testing.T) {
+		later := "chain-c-" + suffix
+		require.Equal(t, http.StatusOK, send("PATCH", "/links/"+first, map[string]any{"url": shortURL(later)}).Code)
+
+		w := send("POST", "/links", map[string]any{"slug": later, "url": shortURL(second)})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), links.ErrRedirectCycle.Error())
+	})
+}
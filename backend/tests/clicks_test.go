@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/clicks"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingClickRepo holds every InsertBatch call until release is closed.
+type blockingClickRepo struct {
+	release chan struct{}
+	mu      sync.Mutex
+	total   int
+}
+
+func (r *blockingClickRepo) InsertBatch(ctx context.Context, batch []*clicks.Click) (int64, error) {
+	<-r.release
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.total += len(batch)
+	return int64(len(batch)), nil
+}
+
+func TestClickRecorder_Backpressure(t *testing.T) {
+	repo := &blockingClickRepo{release: make(chan struct{})}
+	rec := clicks.NewRecorder(repo, clicks.RecorderOptions{
+		BufferSize:    1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	})
+
+	// With the writer stuck, at most one click is in flight and one buffered
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		rec.Record(&clicks.Click{LinkID: 1, ClickedAt: time.Now()})
+	}
+	assert.Less(t, time.Since(start), time.Second, "Record must never block")
+
+	stats := rec.Stats()
+	assert.Equal(t, int64(10), stats.Recorded+stats.Dropped)
+	assert.GreaterOrEqual(t, stats.Dropped, int64(8))
+
+	close(repo.release)
+	require.NoError(t, rec.Close(context.Background()))
+
+	stats = rec.Stats()
+	assert.Equal(t, stats.Recorded, stats.Flushed)
+	assert.Equal(t, int(stats.Recorded), repo.total)
+
+	// Closed recorders drop instead of panicking
+	assert.False(t, rec.Record(&clicks.Click{LinkID: 1}))
+	assert.ErrorIs(t, rec.Close(context.Background()), clicks.ErrRecorderClosed)
+}
+
+func TestClickRecorder_FlushToDatabase(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	linkRepo := links.NewRepository(testPool)
+
+	slug := "clicks-flush-" + time.Now().Format("150405000000")
+	require.NoError(t, linkRepo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com"}))
+	link, err := linkRepo.GetBySlug(ctx, 0, slug)
+	require.NoError(t, err)
+
+	rec := clicks.NewRecorder(clicks.NewRepository(testPool), clicks.RecorderOptions{
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, rec.Record(&clicks.Click{LinkID: link.ID, ClickedAt: time.Now()}))
+	}
+
+	// Close must flush the partial batch left in the buffer
+	require.NoError(t, rec.Close(ctx))
+
+	var count int
+	err = testPool.QueryRow(ctx, "SELECT COUNT(*) FROM clicks WHERE link_id = $1", link.ID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 5, count)
+	assert.Equal(t, int64(5), rec.Stats().Flushed)
+}
+
+func TestClickRecorder_DeletedLink(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	linkRepo := links.NewRepository(testPool)
+
+	suffix := time.Now().Format("150405000000")
+	kept := &links.Link{Slug: "clicks-kept-" + suffix, URL: "https://example.com"}
+	deleted := &links.Link{Slug: "clicks-deleted-" + suffix, URL: "https://example.com"}
+	require.NoError(t, linkRepo.Create(ctx, kept))
+	require.NoError(t, linkRepo.Create(ctx, deleted))
+	require.NoError(t, linkRepo.Delete(ctx, 0, deleted.Slug))
+
+	// The deleted link's click must not fail the batch
+	n, err := clicks.NewRepository(testPool).InsertBatch(ctx, []*clicks.Click{
+		{LinkID: kept.ID, ClickedAt: time.Now()},
+		{LinkID: deleted.ID, ClickedAt: time.Now()},
+		{LinkID: kept.ID, ClickedAt: time.Now()},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	var count int
+	err = testPool.QueryRow(ctx, "SELECT COUNT(*) FROM clicks WHERE link_id = $1", kept.ID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+// captureRecorder keeps the clicks it is given.
+type captureRecorder struct {
+	mu     sync.Mutex
+	clicks []*clicks.Click
+}
+
+func (r *captureRecorder) Record(click *clicks.Click) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clicks = append(r.clicks, click)
+	return true
+}
+
+func (r *captureRecorder) Stats() clicks.Stats             { return clicks.Stats{} }
+func (r *captureRecorder) Close(ctx context.Context) error { return nil }
+
+func TestHTTP_ClickHeadersAreValidUTF8(t *testing.T) {
+	repo := &countingRepo{links: map[string]*links.Link{
+		"utf8": {ID: 1, Slug: "utf8", URL: "https://example.com/", IsActive: true},
+	}}
+	rec := &captureRecorder{}
+
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{Recorder: rec}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/redirect/utf8", nil)
+	// A three-byte character straddles the truncation point
+	req.Header.Set("User-Agent", strings.Repeat("a", 1023)+"界")
+	req.Header.Set("Referer", "https://example.com/\xff\xfe")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	require.Len(t, rec.clicks, 1)
+	click := rec.clicks[0]
+	assert.Equal(t, strings.Repeat("a", 1023), click.UserAgent)
+	assert.True(t, utf8.ValidString(click.Referrer))
+	assert.Equal(t, "https://example.com/\uFFFD", click.Referrer)
+}
+
+func TestHTTP_RedirectRecordsClick(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	linkRepo := links.NewRepository(testPool)
+	rec := clicks.NewRecorder(clicks.NewRepository(testPool), clicks.RecorderOptions{})
+
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(linkRepo, "localhost:8003"), lhttp.Options{Recorder: rec}))
+
+	slug := "clicks-http-" + time.Now().Format("150405000000")
+	require.NoError(t, linkRepo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com"}))
+	link, err := linkRepo.GetBySlug(ctx, 0, slug)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+	req.Header.Set("Referer", "https://news.example.com/")
+	req.Header.Set("User-Agent", "linkhub-test/1.0")
+	req.Header.Set("Accept-Language", "zh-TW,zh;q=0.9")
+	req.RemoteAddr = "203.0.113.7:51234"
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	require.NoError(t, rec.Close(ctx))
+
+	var referrer, userAgent, clientIP, acceptLanguage string
+	err = testPool.QueryRow(ctx,
+		"SELECT referrer, user_agent, host(client_ip), accept_language FROM clicks WHERE link_id = $1",
+		link.ID,
+	).Scan(&referrer, &userAgent, &clientIP, &acceptLanguage)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://news.example.com/", referrer)
+	assert.Equal(t, "linkhub-test/1.0", userAgent)
+	assert.Equal(t, "203.0.113.7", clientIP)
+	assert.Equal(t, "zh-TW,zh;q=0.9", acceptLanguage)
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/useragent"
+	"github.com/nekogravitycat/linkhub/internal/wellknown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+func TestDeepLink_ForOS(t *testing.T) {
+	link := &links.DeepLink{IOSURL: "myapp://item/1", IOSStoreURL: "https://apps.apple.com/app/id1", AndroidURL: "myapp://item/1"}
+
+	app, store := link.ForOS(useragent.OSiOS)
+	assert.Equal(t, "myapp://item/1", app)
+	assert.Equal(t, "https://apps.apple.com/app/id1", store)
+
+	app, store = link.ForOS(useragent.OSAndroid)
+	assert.Equal(t, "myapp://item/1", app)
+	assert.Empty(t, store)
+
+	app, _ = link.ForOS(useragent.OSWindows)
+	assert.Empty(t, app)
+
+	app, _ = (*links.DeepLink)(nil).ForOS(useragent.OSiOS)
+	assert.Empty(t, app)
+}
+
+func TestWellKnown(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "aasa.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"applinks":{"details":[]}}`), 0o644))
+
+	files, err := wellknown.Open(map[string]string{
+		wellknown.AppleAppSiteAssociation: path,
+		wellknown.AssetLinks:              "",
+	})
+	require.NoError(t, err)
+
+	r := gin.New()
+	lhttp.RegisterRedirectRoutes(r, lhttp.NewHandler(nil, lhttp.Options{WellKnown: files}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/.well-known/apple-app-site-association")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"applinks":{"details":[]}}`, w.Body.String())
+
+	// Not configured
+	assert.Equal(t, http.StatusNotFound, get("/.well-known/assetlinks.json").Code)
+	assert.Equal(t, http.StatusNotFound, get("/.well-known/security.txt").Code)
+
+	t.Run("Reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"applinks":{"apps":[]}}`), 0o644))
+		require.NoError(t, files.Reload())
+		assert.JSONEq(t, `{"applinks":{"apps":[]}}`, get("/.well-known/apple-app-site-association").Body.String())
+	})
+
+	t.Run("Invalid JSON Keeps Previous", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"applinks":`), 0o644))
+		assert.Error(t, files.Reload())
+		assert.JSONEq(t, `{"applinks":{"apps":[]}}`, get("/.well-known/apple-app-site-association").Body.String())
+
+		_, err := wellknown.Open(map[string]string{wellknown.AppleAppSiteAssociation: path})
+		assert.Error(t, err)
+	})
+}
+
+func TestHTTP_DeepLink(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := setupRouter()
+	repo := links.NewRepository(testPool)
+	slug := "deeplink-" + time.Now().Format("150405000000")
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	visit := func(userAgent string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", "text/html")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, deepLink := range []map[string]string{
+			{"ios_url": "javascript:alert(1)"},
+			{"ios_url": "item/1"},
+			{"ios_url": "myapp://item/1", "ios_store_url": "itms-apps://apps.apple.com/app/id1"},
+			{"ios_store_url": "https://apps.apple.com/app/id1"},
+			{"android_url": "https://localhost:8003/loop"},
+		} {
+			w := send("POST", "/links", map[string]any{
+				"slug":      slug,
+				"url":       "https://example.com/item/1",
+				"deep_link": deepLink,
+			})
+			assert.Equal(t, http.StatusBadRequest, w.Code, deepLink)
+		}
+	})
+
+	w := send("POST", "/links", map[string]any{
+		"slug": slug,
+		"url":  "https://example.com/item/1",
+		"deep_link": map[string]string{
+			"ios_url":           "myapp://item/1",
+			"ios_store_url":     "https://apps.apple.com/app/id1",
+			"android_url":       "https://example.com/app/item/1",
+			"android_store_url": "",
+		},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	link, err := repo.GetBySlug(context.Background(), 0, slug)
+	require.NoError(t, err)
+	require.NotNil(t, link.DeepLink)
+	assert.Equal(t, "myapp://item/1", link.DeepLink.IOSURL)
+
+	t.Run("iOS Gets The Interstitial", func(t *testing.T) {
+		w := visit(iPhoneUA)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Contains(t, w.Header().Get("Vary"), "User-Agent")
+		assert.Contains(t, w.Body.String(), `href="myapp://item/1"`)
+		assert.Contains(t, w.Body.String(), "https://apps.apple.com/app/id1")
+	})
+
+	t.Run("Android Falls Back To The Web", func(t *testing.T) {
+		w := visit(androidUA)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `href="https://example.com/app/item/1"`)
+		assert.Contains(t, w.Body.String(), `href="https://example.com/item/1"`)
+	})
+
+	t.Run("Desktop Is Redirected", func(t *testing.T) {
+		w := visit(desktopUA)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/item/1", w.Header().Get("Location"))
+	})
+
+	t.Run("Response", func(t *testing.T) {
+		w := send("GET", "/links/"+slug, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp lhttp.LinkResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.DeepLink)
+		assert.Equal(t, "https://apps.apple.com/app/id1", resp.DeepLink.IOSStoreURL)
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		w := send("PATCH", "/links/"+slug, map[string]any{"deep_link": nil})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = visit(iPhoneUA)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/item/1", w.Header().Get("Location"))
+	})
+}
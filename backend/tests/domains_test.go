@@ -0,0 +1,366 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/config"
+	"github.com/nekogravitycat/linkhub/internal/database"
+	"github.com/nekogravitycat/linkhub/internal/domains"
+	domainsHttp "github.com/nekogravitycat/linkhub/internal/domains/http"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/pkg/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"go.example.com", "go.example.com", false},
+		{"  Go.Example.COM. ", "go.example.com", false},
+		{"localhost:8003", "localhost:8003", false},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example", false},
+		{"", "", true},
+		{"example.com:0", "", true},
+		{"example.com:http", "", true},
+		{"-bad.example.com", "", true},
+		{"bad_.example.com", "", true},
+		{"a..b", "", true},
+		{"https://example.com", "", true},
+		{"example.com/path", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := domains.NormalizeHost(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, domains.ErrInvalidHost)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// uniqueHost returns a host no other test run uses.
+func uniqueHost(prefix string) string {
+	return fmt.Sprintf("%s-%d.example.com", prefix, time.Now().UnixNano()%1e12)
+}
+
+func TestDomainsService(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	svc := domains.NewService(domains.NewRepository(testPool), "localhost:8003")
+	host := uniqueHost("svc")
+
+	status := http.StatusMovedPermanently
+	domain, err := svc.Create(ctx, domains.CreateDomainInput{Host: " " + host + ". ", RedirectStatus: &status})
+	require.NoError(t, err)
+	assert.Equal(t, host, domain.Host)
+
+	t.Run("Host Taken", func(t *testing.T) {
+		_, err := svc.Create(ctx, domains.CreateDomainInput{Host: host})
+		assert.ErrorIs(t, err, domains.ErrHostTaken)
+
+		_, err = svc.Create(ctx, domains.CreateDomainInput{Host: "LOCALHOST:8003"})
+		assert.ErrorIs(t, err, domains.ErrHostTaken)
+	})
+
+	t.Run("Concurrent Creates", func(t *testing.T) {
+		host := uniqueHost("race")
+
+		errs := make([]error, 5)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Go(func() {
+				_, errs[i] = svc.Create(ctx, domains.CreateDomainInput{Host: host})
+			})
+		}
+		wg.Wait()
+
+		// The losers see the unique constraint as a taken host
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+			assert.ErrorIs(t, err, domains.ErrHostTaken)
+		}
+		assert.Equal(t, 1, created)
+		require.NoError(t, svc.Delete(ctx, host))
+	})
+
+	t.Run("Lookup", func(t *testing.T) {
+		require.NotNil(t, svc.Lookup(host))
+		assert.Equal(t, domain.ID, svc.Lookup(host).ID)
+		assert.Equal(t, domain.ID, svc.Lookup(host+":8443").ID, "non-default port")
+		assert.Equal(t, domain.ID, svc.ByID(domain.ID).ID)
+		assert.Nil(t, svc.Lookup("localhost:8003"))
+		assert.Nil(t, svc.Lookup("unknown.example.com"))
+
+		// Another instance only sees the domain after reloading
+		other := domains.NewService(domains.NewRepository(testPool), "localhost:8003")
+		assert.Nil(t, other.Lookup(host))
+		require.NoError(t, other.Reload(ctx))
+		assert.NotNil(t, other.Lookup(host))
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		fallbackURL := "https://example.com/gone"
+		updated, err := svc.Update(ctx, host, domains.UpdateDomainInput{
+			RedirectStatus: request.Nullable[int]{Set: true},
+			FallbackURL:    request.Nullable[string]{Set: true, Value: &fallbackURL},
+		})
+		require.NoError(t, err)
+		assert.Nil(t, updated.RedirectStatus)
+		assert.Equal(t, fallbackURL, svc.Lookup(host).FallbackURL)
+	})
+
+	t.Run("Delete In Use", func(t *testing.T) {
+		repo := links.NewRepository(testPool)
+		slug := fmt.Sprintf("in-use-%d", time.Now().UnixNano()%1e9)
+		require.NoError(t, repo.Create(ctx, &links.Link{DomainID: domain.ID, Slug: slug, URL: "https://example.com"}))
+
+		assert.ErrorIs(t, svc.Delete(ctx, host), domains.ErrDomainInUse)
+		assert.NotNil(t, svc.Lookup(host))
+
+		require.NoError(t, repo.Delete(ctx, domain.ID, slug))
+		require.NoError(t, svc.Delete(ctx, host))
+		assert.Nil(t, svc.Lookup(host))
+		assert.ErrorIs(t, svc.Delete(ctx, host), domains.ErrDomainNotFound)
+	})
+}
+
+func TestLinksRepository_Domains(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+	domain, err := domains.NewService(domains.NewRepository(testPool), "localhost:8003").
+		Create(ctx, domains.CreateDomainInput{Host: uniqueHost("repo")})
+	require.NoError(t, err)
+
+	slug := fmt.Sprintf("shared-%d", time.Now().UnixNano()%1e9)
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com/primary"}))
+	require.NoError(t, repo.Create(ctx, &links.Link{DomainID: domain.ID, Slug: slug, URL: "https://example.com/branded"}))
+
+	// Slugs are unique per domain, including the primary one
+	assert.Error(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com/again"}))
+	assert.Error(t, repo.Create(ctx, &links.Link{DomainID: domain.ID, Slug: slug, URL: "https://example.com/again"}))
+
+	primary, err := repo.GetBySlug(ctx, 0, slug)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), primary.DomainID)
+	assert.Equal(t, "https://example.com/primary", primary.URL)
+
+	branded, err := repo.GetBySlug(ctx, domain.ID, slug)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ID, branded.DomainID)
+	assert.Equal(t, "https://example.com/branded", branded.URL)
+
+	list, total, err := repo.List(ctx, links.ListOptions{DomainID: &domain.ID, Keyword: slug})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, branded.ID, list[0].ID)
+
+	require.NoError(t, repo.Delete(ctx, domain.ID, slug))
+	_, err = repo.GetBySlug(ctx, 0, slug)
+	assert.NoError(t, err, "deleting on one domain leaves the other")
+	require.NoError(t, repo.Delete(ctx, 0, slug))
+}
+
+func TestListener_DomainLinkChanges(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	connected := make(chan struct{}, 1)
+	notified := make(chan string, 16)
+	listener := &database.Listener{
+		DSN:       cfg.TestDatabaseDSN,
+		Channel:   links.NotifyChannel,
+		OnNotify:  func(key string) { notified <- key },
+		OnConnect: func() { connected <- struct{}{} },
+	}
+	go listener.Run(ctx)
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not connect")
+	}
+
+	domain, err := domains.NewService(domains.NewRepository(testPool), "localhost:8003").
+		Create(ctx, domains.CreateDomainInput{Host: uniqueHost("notify")})
+	require.NoError(t, err)
+
+	slug := fmt.Sprintf("notify-domain-%d", time.Now().UnixNano()%1e9)
+	repo := links.NewRepository(testPool)
+	require.NoError(t, repo.Create(ctx, &links.Link{DomainID: domain.ID, Slug: slug, URL: "https://example.com"}))
+
+	select {
+	case got := <-notified:
+		assert.Equal(t, strconv.FormatInt(domain.ID, 10)+"/"+slug, got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notification")
+	}
+
+	require.NoError(t, repo.Delete(ctx, domain.ID, slug))
+}
+
+func TestHTTP_Domains(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	domainService := domains.NewService(domains.NewRepository(testPool), "localhost:8003")
+	require.NoError(t, domainService.Reload(ctx))
+
+	r := gin.New()
+	linkHandler := lhttp.NewHandler(links.NewService(links.NewRepository(testPool), "localhost:8003"), lhttp.Options{
+		ShortURLBase: "https://localhost:8003",
+		Domains:      domainService,
+	})
+	lhttp.RegisterRoutes(r, linkHandler)
+	domainsHttp.RegisterRoutes(r, domainsHttp.NewHandler(domainService))
+
+	send := func(method, path, host string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, &buf)
+		if host != "" {
+			req.Host = host
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	host := uniqueHost("http")
+	slug := fmt.Sprintf("both-%d", time.Now().UnixNano()%1e9)
+
+	t.Run("Create Domain", func(t *testing.T) {
+		w := send("POST", "/domains", "", map[string]any{"host": host, "redirect_status": 301})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var resp domainsHttp.DomainResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, host, resp.Host)
+		assert.Nil(t, resp.FallbackURL)
+
+		assert.Equal(t, http.StatusConflict, send("POST", "/domains", "", map[string]any{"host": host}).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/domains", "", map[string]any{"host": "not a host"}).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/domains", "", map[string]any{"host": uniqueHost("bad"), "redirect_status": 200}).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/domains", "", map[string]any{"host": uniqueHost("bad"), "fallback_url": "ftp://example.com"}).Code)
+	})
+
+	t.Run("Same Slug On Two Domains", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, send("POST", "/links", "", map[string]any{"slug": slug, "url": "https://example.com/primary"}).Code)
+		require.Equal(t, http.StatusCreated, send("POST", "/links", "", map[string]any{"domain": host, "slug": slug, "url": "https://example.com/branded"}).Code)
+		assert.Equal(t, http.StatusConflict, send("POST", "/links", "", map[string]any{"domain": host, "slug": slug, "url": "https://example.com/again"}).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/links", "", map[string]any{"domain": uniqueHost("missing"), "slug": slug, "url": "https://example.com"}).Code)
+	})
+
+	t.Run("Short URL In Responses", func(t *testing.T) {
+		var primary, branded lhttp.LinkResponse
+		w := send("GET", "/links/"+slug, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &primary))
+		assert.Equal(t, "localhost:8003", primary.Domain)
+		assert.Equal(t, "https://localhost:8003/"+slug, primary.ShortURL)
+		assert.Equal(t, "https://example.com/primary", primary.URL)
+
+		w = send("GET", "/links/"+slug+"?domain="+host, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &branded))
+		assert.Equal(t, host, branded.Domain)
+		assert.Equal(t, "https://"+host+"/"+slug, branded.ShortURL)
+		assert.Equal(t, "https://example.com/branded", branded.URL)
+
+		var list lhttp.ListResponse
+		w = send("GET", "/links?keyword="+slug+"&domain="+host, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list.Links, 1)
+		assert.Equal(t, branded.ShortURL, list.Links[0].ShortURL)
+
+		assert.Equal(t, http.StatusNotFound, send("GET", "/links/"+slug+"?domain="+uniqueHost("missing"), "", nil).Code)
+	})
+
+	t.Run("Redirect By Host", func(t *testing.T) {
+		w := send("GET", "/redirect/"+slug, "localhost:8003", nil)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/primary", w.Header().Get("Location"))
+
+		// The domain's default status applies
+		w = send("GET", "/redirect/"+slug, host, nil)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "https://example.com/branded", w.Header().Get("Location"))
+
+		// Unknown hosts are served the primary domain's links
+		w = send("GET", "/redirect/"+slug, "other.example.com", nil)
+		assert.Equal(t, "https://example.com/primary", w.Header().Get("Location"))
+	})
+
+	t.Run("Domain Fallback URL", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send("GET", "/redirect/missing-"+slug, host, nil).Code)
+
+		w := send("PATCH", "/domains/"+host, "", map[string]any{"fallback_url": "https://example.com/home"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		for _, path := range []string{"/redirect/missing-" + slug, "/redirect"} {
+			w = send("GET", path, host, nil)
+			assert.Equal(t, http.StatusFound, w.Code, path)
+			assert.Equal(t, "https://example.com/home", w.Header().Get("Location"), path)
+		}
+		// Other domains keep the server's fallbacks
+		assert.Equal(t, http.StatusNotFound, send("GET", "/redirect/missing-"+slug, "localhost:8003", nil).Code)
+	})
+
+	t.Run("Update And Delete Per Domain", func(t *testing.T) {
+		w := send("PATCH", "/links/"+slug+"?domain="+host, "", map[string]any{"url": "https://example.com/branded2"})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = send("GET", "/redirect/"+slug, host, nil)
+		assert.Equal(t, "https://example.com/branded2", w.Header().Get("Location"))
+		w = send("GET", "/redirect/"+slug, "localhost:8003", nil)
+		assert.Equal(t, "https://example.com/primary", w.Header().Get("Location"))
+
+		assert.Equal(t, http.StatusConflict, send("DELETE", "/domains/"+host, "", nil).Code)
+		require.Equal(t, http.StatusOK, send("DELETE", "/links/"+slug+"?domain="+host, "", nil).Code)
+		require.Equal(t, http.StatusOK, send("DELETE", "/domains/"+host, "", nil).Code)
+		assert.Equal(t, http.StatusNotFound, send("GET", "/domains/"+host, "", nil).Code)
+
+		require.Equal(t, http.StatusOK, send("DELETE", "/links/"+slug, "", nil).Code)
+	})
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/fallback"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func renderFallback(t *testing.T, pages *fallback.Pages, kind fallback.Kind, page fallback.Page) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, pages.Render(&buf, kind, page))
+	return buf.String()
+}
+
+func TestFallback_Defaults(t *testing.T) {
+	pages, err := fallback.New(fallback.Options{})
+	require.NoError(t, err)
+
+	for _, kind := range fallback.Kinds {
+		assert.Empty(t, pages.URL(kind))
+		assert.Contains(t, renderFallback(t, pages, kind, fallback.Page{Slug: "promo", Status: http.StatusNotFound}), "<html")
+	}
+
+	assert.Contains(t, renderFallback(t, pages, fallback.Inactive, fallback.Page{Slug: "promo", Status: http.StatusGone}), "deactivated")
+	assert.Contains(t, renderFallback(t, pages, fallback.Inactive, fallback.Page{Slug: "promo", Status: http.StatusNotFound}), "not active yet")
+	assert.Contains(t, renderFallback(t, pages, fallback.NotFound, fallback.Page{Slug: "<b>"}), "&lt;b&gt;")
+}
+
+func TestFallback_Dir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "not_found.html")
+	require.NoError(t, os.WriteFile(path, []byte("custom {{.Slug}}"), 0o644))
+
+	pages, err := fallback.New(fallback.Options{Dir: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, "custom promo", renderFallback(t, pages, fallback.NotFound, fallback.Page{Slug: "promo"}))
+	// Missing files keep the built-in page
+	assert.Contains(t, renderFallback(t, pages, fallback.Expired, fallback.Page{Slug: "promo"}), "<html")
+
+	t.Run("Reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("changed {{.Slug}}"), 0o644))
+		require.NoError(t, pages.Reload())
+		assert.Equal(t, "changed promo", renderFallback(t, pages, fallback.NotFound, fallback.Page{Slug: "promo"}))
+	})
+
+	t.Run("Parse Error Keeps Previous", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("broken {{.Slug"), 0o644))
+		assert.Error(t, pages.Reload())
+		assert.Equal(t, "changed promo", renderFallback(t, pages, fallback.NotFound, fallback.Page{Slug: "promo"}))
+	})
+
+	t.Run("Parse Error On Start", func(t *testing.T) {
+		_, err := fallback.New(fallback.Options{Dir: dir})
+		assert.Error(t, err)
+	})
+}
+
+func TestFallback_URL(t *testing.T) {
+	pages, err := fallback.New(fallback.Options{URLs: map[fallback.Kind]string{
+		fallback.Expired: "https://example.com/expired",
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://example.com/expired", pages.URL(fallback.Expired))
+	assert.Empty(t, pages.URL(fallback.NotFound))
+}
+
+func TestHTTP_Fallback(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+
+	setup := func(t *testing.T, opts fallback.Options, rootURL string) *gin.Engine {
+		pages, err := fallback.New(opts)
+		require.NoError(t, err)
+
+		r := gin.New()
+		handler := lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{
+			Fallback:        pages,
+			RootRedirectURL: rootURL,
+		})
+		lhttp.RegisterRoutes(r, handler)
+		return r
+	}
+
+	get := func(r *gin.Engine, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().Format("150405000000")
+
+	inactive := "fb-inactive-" + suffix
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: inactive, URL: "https://example.com"}))
+	link, err := repo.GetBySlug(ctx, 0, inactive)
+	require.NoError(t, err)
+	link.IsActive = false
+	require.NoError(t, repo.Update(ctx, link))
+
+	expired := "fb-expired-" + suffix
+	expiresAt := time.Now().Add(-time.Second)
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: expired, URL: "https://example.com", ExpiresAt: &expiresAt}))
+
+	scheduled := "fb-scheduled-" + suffix
+	activeFrom := time.Now().Add(time.Hour)
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: scheduled, URL: "https://example.com", ActiveFrom: &activeFrom}))
+
+	t.Run("Pages", func(t *testing.T) {
+		r := setup(t, fallback.Options{}, "")
+
+		tests := []struct {
+			path   string
+			status int
+			text   string
+		}{
+			{"/redirect/fb-missing-" + suffix, http.StatusNotFound, "not found"},
+			{"/redirect/" + inactive, http.StatusGone, "deactivated"},
+			{"/redirect/" + scheduled, http.StatusNotFound, "not active yet"},
+			{"/redirect/" + expired, http.StatusGone, "expired"},
+			{"/redirect", http.StatusNotFound, "not found"},
+		}
+		for _, tt := range tests {
+			w := get(r, tt.path)
+			assert.Equal(t, tt.status, w.Code, tt.path)
+			assert.Contains(t, w.Header().Get("Content-Type"), "text/html", tt.path)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"), tt.path)
+			assert.Contains(t, w.Body.String(), tt.text, tt.path)
+		}
+	})
+
+	t.Run("URLs", func(t *testing.T) {
+		r := setup(t, fallback.Options{URLs: map[fallback.Kind]string{
+			fallback.NotFound: "https://example.com/404",
+			fallback.Inactive: "https://example.com/inactive",
+		}}, "https://example.com/")
+
+		tests := []struct {
+			path     string
+			location string
+		}{
+			{"/redirect/fb-missing-" + suffix, "https://example.com/404"},
+			{"/redirect/" + inactive, "https://example.com/inactive"},
+			{"/redirect", "https://example.com/"},
+		}
+		for _, tt := range tests {
+			w := get(r, tt.path)
+			assert.Equal(t, http.StatusFound, w.Code, tt.path)
+			assert.Equal(t, tt.location, w.Header().Get("Location"), tt.path)
+		}
+
+		// Kinds without a URL still render their page
+		assert.Equal(t, http.StatusGone, get(r, "/redirect/"+expired).Code)
+	})
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/geoip"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGeoIP resolves countries from a fixed IP table.
+type fakeGeoIP map[string]string
+
+func (f fakeGeoIP) Country(addr netip.Addr) string {
+	return f[addr.String()]
+}
+
+func TestGeoIP_OpenMissingFile(t *testing.T) {
+	_, err := geoip.Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
+
+func TestLink_URLForCountry(t *testing.T) {
+	link := &links.Link{
+		URL: "https://example.com/global",
+		CountryRules: []links.CountryRule{
+			{Country: "TW", URL: "https://example.com/zh-tw"},
+			{Country: "JP", URL: "https://example.com/ja"},
+		},
+	}
+
+	assert.Equal(t, "https://example.com/zh-tw", link.URLForCountry("TW"))
+	assert.Equal(t, "https://example.com/ja", link.URLForCountry("JP"))
+	assert.Equal(t, "https://example.com/global", link.URLForCountry("US"))
+	assert.Equal(t, "https://example.com/global", link.URLForCountry(""))
+	assert.True(t, link.IsTargeted())
+	assert.False(t, (&links.Link{URL: "https://example.com"}).IsTargeted())
+}
+
+func TestHTTP_CountryRules(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := gin.New()
+	svc := links.NewService(links.NewRepository(testPool), "localhost:8003")
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(svc, lhttp.Options{
+		GeoIP: fakeGeoIP{"192.0.2.1": "TW", "192.0.2.2": "US"},
+	}))
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, &buf)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	redirectFrom := func(slug, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.RemoteAddr = ip + ":12345"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	slug := "http-geo-" + time.Now().Format("150405000000")
+	w := send("POST", "/links", map[string]any{
+		"slug": slug,
+		"url":  "https://example.com/global",
+		"country_rules": []map[string]string{
+			{"country": "tw", "url": "https://example.com/zh-tw"},
+		},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("Rules Returned Normalized", func(t *testing.T) {
+		w := send("GET", "/links/"+slug, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp lhttp.LinkResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []links.CountryRule{{Country: "TW", URL: "https://example.com/zh-tw"}}, resp.CountryRules)
+	})
+
+	t.Run("Matching Country", func(t *testing.T) {
+		w := redirectFrom(slug, "192.0.2.1")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/zh-tw", w.Header().Get("Location"))
+	})
+
+	t.Run("Other Country Gets Default", func(t *testing.T) {
+		w := redirectFrom(slug, "192.0.2.2")
+		assert.Equal(t, "https://example.com/global", w.Header().Get("Location"))
+	})
+
+	t.Run("Unknown Address Gets Default", func(t *testing.T) {
+		w := redirectFrom(slug, "198.51.100.7")
+		assert.Equal(t, "https://example.com/global", w.Header().Get("Location"))
+	})
+
+	t.Run("Invalid Rules Rejected", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			rules []map[string]string
+		}{
+			{"not a country code", []map[string]string{{"country": "T1", "url": "https://example.com/a"}}},
+			{"duplicate country", []map[string]string{
+				{"country": "TW", "url": "https://example.com/a"},
+				{"country": "tw", "url": "https://example.com/b"},
+			}},
+			{"missing url", []map[string]string{{"country": "TW"}}},
+			{"redirect loop", []map[string]string{{"country": "TW", "url": "https://localhost:8003/x"}}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := send("PATCH", "/links/"+slug, map[string]any{"country_rules": tt.rules})
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			})
+		}
+	})
+
+	t.Run("Clear Rules", func(t *testing.T) {
+		w := send("PATCH", "/links/"+slug, map[string]any{"country_rules": []any{}})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = redirectFrom(slug, "192.0.2.1")
+		assert.Equal(t, "https://example.com/global", w.Header().Get("Location"))
+	})
+}
@@ -23,7 +23,7 @@ func setupRouter() *gin.Engine {
 
 	repo := links.NewRepository(testPool)
 	svc := links.NewService(repo, "localhost:8003")
-	handler := lhttp.NewHandler(svc)
+	handler := lhttp.NewHandler(svc, lhttp.Options{})
 	lhttp.RegisterRoutes(r, handler)
 
 	return r
@@ -52,14 +52,14 @@ func TestHTTP_CreateLink(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, w.Code)
 
 		// Verify DB
-		_, err := links.NewRepository(testPool).GetBySlug(ctx, slug)
+		_, err := links.NewRepository(testPool).GetBySlug(ctx, 0, slug)
 		assert.NoError(t, err)
 	})
 
 	t.Run("Duplicate Slug", func(t *testing.T) {
 		slug := "http-dup-" + time.Now().Format("150405000000")
 		// Setup existing
-		_ = links.NewRepository(testPool).Create(ctx, slug, "https://1.com")
+		_ = links.NewRepository(testPool).Create(ctx, &links.Link{Slug: slug, URL: "https://1.com"})
 
 		reqBody := map[string]string{
 			"slug": slug,
@@ -97,6 +97,22 @@ func TestHTTP_CreateLink(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
+	t.Run("Invalid Activation Window", func(t *testing.T) {
+		body := []byte(`{
+			"slug": "window-` + time.Now().Format("150405000000") + `",
+			"url": "https://example.com",
+			"active_from": "2099-02-01T00:00:00Z",
+			"active_until": "2099-01-01T00:00:00Z"
+		}`)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/links", bytes.NewBuffer(body))
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "active_from must be before active_until")
+	})
+
 	t.Run("Redirect Domain Loop", func(t *testing.T) {
 		reqBody := map[string]string{
 			"slug": "loop-link-" + time.Now().Format("150405000000"),
@@ -124,14 +140,18 @@ func TestHTTP_GetLink(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		slug := "http-get-" + time.Now().Format("150405000000")
-		_ = repo.Create(ctx, slug, "https://get.com")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "https://get.com"})
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/links/"+slug, nil)
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
-		// Check Body...
+
+		var resp lhttp.LinkResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, slug, resp.Slug)
+		assert.Equal(t, string(links.StatusLive), resp.Status)
 	})
 
 	t.Run("Not Found", func(t *testing.T) {
@@ -155,7 +175,7 @@ func TestHTTP_Redirect(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		slug := "http-redir-" + time.Now().Format("150405000000")
 		target := "https://example.org"
-		_ = repo.Create(ctx, slug, target)
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: target})
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
@@ -177,10 +197,10 @@ func TestHTTP_Redirect(t *testing.T) {
 		slug := "http-inactive-" + time.Now().Format("150405000000")
 		// Manually create inactive link since repo create defaults to true
 		// We use Update to set it inactive
-		err := repo.Create(ctx, slug, "http://foo.com")
+		err := repo.Create(ctx, &links.Link{Slug: slug, URL: "http://foo.com"})
 		require.NoError(t, err)
 
-		link, err := repo.GetBySlug(ctx, slug)
+		link, err := repo.GetBySlug(ctx, 0, slug)
 		require.NoError(t, err)
 
 		link.IsActive = false
@@ -193,6 +213,47 @@ func TestHTTP_Redirect(t *testing.T) {
 
 		assert.Equal(t, http.StatusNotFound, w.Code) // Handler returns 404 for inactive
 	})
+
+	t.Run("Expired Link", func(t *testing.T) {
+		slug := "http-expired-" + time.Now().Format("150405000000")
+		expiresAt := time.Now().Add(-time.Second)
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "http://foo.com", ExpiresAt: &expiresAt}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Scheduled Link", func(t *testing.T) {
+		slug := "http-scheduled-" + time.Now().Format("150405000000")
+		activeFrom := time.Now().Add(time.Hour)
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "http://foo.com", ActiveFrom: &activeFrom}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Max Clicks Reached", func(t *testing.T) {
+		slug := "http-maxclicks-" + time.Now().Format("150405000000")
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "http://foo.com", MaxClicks: ptrInt64(2)}))
+
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusFound, w.Code)
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
 }
 
 func TestHTTP_UpdateLink(t *testing.T) {
@@ -206,7 +267,7 @@ func TestHTTP_UpdateLink(t *testing.T) {
 
 	t.Run("Success Full Update", func(t *testing.T) {
 		slug := "http-update-" + time.Now().Format("150405000000")
-		_ = repo.Create(ctx, slug, "http://old.com")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "http://old.com"})
 
 		reqBody := map[string]interface{}{
 			"url":       "http://new.com",
@@ -221,14 +282,14 @@ func TestHTTP_UpdateLink(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 
 		// Verify
-		l, _ := repo.GetBySlug(ctx, slug)
+		l, _ := repo.GetBySlug(ctx, 0, slug)
 		assert.Equal(t, "http://new.com", l.URL)
 		assert.False(t, l.IsActive)
 	})
 
 	t.Run("Success Partial Update (IsActive Only)", func(t *testing.T) {
 		slug := "http-partial-" + time.Now().Format("150405000000")
-		_ = repo.Create(ctx, slug, "http://keep-me.com")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "http://keep-me.com"})
 
 		// Only send is_active
 		reqBody := map[string]any{
@@ -243,7 +304,7 @@ func TestHTTP_UpdateLink(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 
 		// Verify
-		l, _ := repo.GetBySlug(ctx, slug)
+		l, _ := repo.GetBySlug(ctx, 0, slug)
 		assert.Equal(t, "http://keep-me.com", l.URL) // URL should handle be unchanged
 		assert.False(t, l.IsActive)
 	})
@@ -264,7 +325,7 @@ func TestHTTP_UpdateLink(t *testing.T) {
 
 	t.Run("Invalid URL", func(t *testing.T) {
 		slug := "http-update-bad-" + time.Now().Format("150405000000")
-		_ = repo.Create(ctx, slug, "http://valid.com")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "http://valid.com"})
 
 		reqBody := map[string]any{
 			"url":       "not-a-valid-url",
@@ -281,7 +342,7 @@ func TestHTTP_UpdateLink(t *testing.T) {
 
 	t.Run("Empty URL in Update", func(t *testing.T) {
 		slug := "http-update-empty-" + time.Now().Format("150405000000")
-		_ = repo.Create(ctx, slug, "http://valid.com")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "http://valid.com"})
 
 		// Sending empty string for URL should fail
 		reqBody := map[string]any{
@@ -296,9 +357,37 @@ func TestHTTP_UpdateLink(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
+	t.Run("Set and Clear Usage Limits", func(t *testing.T) {
+		slug := "http-update-limits-" + time.Now().Format("150405000000")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "http://valid.com"})
+
+		body := []byte(`{"expires_at": "2099-01-01T00:00:00Z", "max_clicks": 10}`)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/links/"+slug, bytes.NewBuffer(body))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		l, _ := repo.GetBySlug(ctx, 0, slug)
+		require.NotNil(t, l.ExpiresAt)
+		require.NotNil(t, l.MaxClicks)
+		assert.Equal(t, int64(10), *l.MaxClicks)
+
+		// Explicit null clears the expiration but leaves max_clicks untouched
+		body = []byte(`{"expires_at": null}`)
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("PATCH", "/links/"+slug, bytes.NewBuffer(body))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		l, _ = repo.GetBySlug(ctx, 0, slug)
+		assert.Nil(t, l.ExpiresAt)
+		require.NotNil(t, l.MaxClicks)
+		assert.Equal(t, int64(10), *l.MaxClicks)
+	})
+
 	t.Run("Update to Redirect Domain Loop", func(t *testing.T) {
 		slug := "http-update-loop-" + time.Now().Format("150405000000")
-		_ = repo.Create(ctx, slug, "http://valid.com")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "http://valid.com"})
 
 		reqBody := map[string]any{
 			"url": "http://localhost:8003/loop",
@@ -325,7 +414,7 @@ func TestHTTP_DeleteLink(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		slug := "http-del-" + time.Now().Format("150405000000")
-		_ = repo.Create(ctx, slug, "http://bye.com")
+		_ = repo.Create(ctx, &links.Link{Slug: slug, URL: "http://bye.com"})
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("DELETE", "/links/"+slug, nil)
@@ -333,7 +422,7 @@ func TestHTTP_DeleteLink(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		_, err := repo.GetBySlug(ctx, slug)
+		_, err := repo.GetBySlug(ctx, 0, slug)
 		assert.Equal(t, links.ErrLinkNotFound, err)
 	})
 
@@ -362,9 +451,9 @@ func TestHTTP_ListLinks(t *testing.T) {
 	slugB := "b-slug-" + time.Now().Format("150405")
 	slugC := "c-slug-" + time.Now().Format("150405")
 
-	_ = repo.Create(ctx, slugA, "https://a.com")
-	_ = repo.Create(ctx, slugC, "https://c.com") // Created second, C
-	_ = repo.Create(ctx, slugB, "https://b.com") // Created third, B
+	_ = repo.Create(ctx, &links.Link{Slug: slugA, URL: "https://a.com"})
+	_ = repo.Create(ctx, &links.Link{Slug: slugC, URL: "https://c.com"}) // Created second, C
+	_ = repo.Create(ctx, &links.Link{Slug: slugB, URL: "https://b.com"}) // Created third, B
 
 	// By default (created_at DESC): B, C, A
 
@@ -462,8 +551,90 @@ func TestHTTP_ListLinks(t *testing.T) {
 	t.Run("Search and Filter Params", func(t *testing.T) {
 		// Just ensure checking parsing works, repository logic is tested separately
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("GET", "/links?keyword=test&is_active=true", nil)
+		req, _ := http.NewRequest("GET", "/links?keyword=test&is_active=true&expired=false", nil)
 		r.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
 }
+
+func TestHTTP_RedirectStatus(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+	r := setupRouter()
+
+	redirect := func(r http.Handler, method, slug string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/redirect/"+slug, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name         string
+		status       *int
+		wantStatus   int
+		wantCacheHdr string
+	}{
+		{"Server Default", nil, http.StatusFound, "no-store"},
+		{"Moved Permanently", ptrInt(301), http.StatusMovedPermanently, "public, max-age=86400"},
+		{"Found", ptrInt(302), http.StatusFound, "no-store"},
+		{"Temporary Redirect", ptrInt(307), http.StatusTemporaryRedirect, "no-store"},
+		{"Permanent Redirect", ptrInt(308), http.StatusPermanentRedirect, "public, max-age=86400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slug := "http-status-" + time.Now().Format("150405000000")
+			require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com", RedirectStatus: tt.status}))
+
+			w := redirect(r, "GET", slug)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+			assert.Equal(t, tt.wantCacheHdr, w.Header().Get("Cache-Control"))
+		})
+	}
+
+	t.Run("Permanent Link with Click Limit Is Not Cached", func(t *testing.T) {
+		slug := "http-status-limited-" + time.Now().Format("150405000000")
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com", RedirectStatus: ptrInt(301), MaxClicks: ptrInt64(5)}))
+
+		w := redirect(r, "GET", slug)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Permanent Link Cached Until Expiration", func(t *testing.T) {
+		slug := "http-status-expiring-" + time.Now().Format("150405000000")
+		expiresAt := time.Now().Add(time.Hour)
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com", RedirectStatus: ptrInt(308), ExpiresAt: &expiresAt}))
+
+		w := redirect(r, "GET", slug)
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Regexp(t, `^public, max-age=3[56]\d\d$`, w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("POST Forwarded by 307 Link", func(t *testing.T) {
+		slug := "http-status-post-" + time.Now().Format("150405000000")
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://api.example.com/hook", RedirectStatus: ptrInt(307)}))
+
+		w := redirect(r, "POST", slug)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "https://api.example.com/hook", w.Header().Get("Location"))
+	})
+
+	t.Run("Configured Server Default", func(t *testing.T) {
+		router := gin.New()
+		svc := links.NewService(repo, "localhost:8003")
+		lhttp.RegisterRoutes(router, lhttp.NewHandler(svc, lhttp.Options{DefaultRedirectStatus: http.StatusMovedPermanently}))
+
+		slug := "http-status-default-" + time.Now().Format("150405000000")
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com"}))
+
+		w := redirect(router, "GET", slug)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	})
+}
@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{"empty", "", []string{}},
+		{"single", "en-US", []string{"en-US"}},
+		{"header order kept", "fr, de", []string{"fr", "de"}},
+		{"sorted by q", "en;q=0.5, zh-TW, ja;q=0.8", []string{"zh-TW", "ja", "en"}},
+		{"spaces", " zh-Hant-TW ; q=0.9 , en ; q=0.1", []string{"zh-Hant-TW", "en"}},
+		{"q=0 excluded", "en, fr;q=0", []string{"en"}},
+		{"wildcard skipped", "*, de;q=0.5", []string{"de"}},
+		{"malformed q skipped", "en;q=abc, fr;q=2, de", []string{"de"}},
+		{"unknown parameter skipped", "en;level=1, fr", []string{"fr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := links.ParseAcceptLanguage(tt.header)
+			if len(tt.want) == 0 {
+				assert.Empty(t, got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizeLanguageTag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{"en", "en", false},
+		{"EN-us", "en-US", false},
+		{"zh-hant-tw", "zh-Hant-TW", false},
+		{"zh-HANT", "zh-Hant", false},
+		{"es-419", "es-419", false},
+		{"haw", "haw", false},
+		{"", "", true},
+		{"e", "", true},
+		{"english", "", true},
+		{"en_US", "", true},
+		{"en-US-x-private", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, err := links.NormalizeLanguageTag(tt.tag)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, links.ErrInvalidLanguageRule)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLink_TargetURLLanguage(t *testing.T) {
+	link := &links.Link{
+		URL: "https://example.com/global",
+		LanguageRules: []links.LanguageRule{
+			{Language: "zh-TW", URL: "https://example.com/zh-tw"},
+			{Language: "zh", URL: "https://example.com/zh"},
+			{Language: "ja", URL: "https://example.com/ja"},
+		},
+		CountryRules: []links.CountryRule{
+			{Country: "JP", URL: "https://example.com/jp"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		visitor   links.Visitor
+		want      string
+		wantMatch bool
+	}{
+		{"exact", links.Visitor{Languages: []string{"zh-TW"}}, "https://example.com/zh-tw", true},
+		{"case insensitive", links.Visitor{Languages: []string{"zh-tw"}}, "https://example.com/zh-tw", true},
+		{"script dropped", links.Visitor{Languages: []string{"zh-Hant-TW"}}, "https://example.com/zh-tw", true},
+		{"region dropped", links.Visitor{Languages: []string{"zh-CN"}}, "https://example.com/zh", true},
+		{"first preference wins", links.Visitor{Languages: []string{"ja-JP", "zh-TW"}}, "https://example.com/ja", true},
+		{"later preference", links.Visitor{Languages: []string{"fr", "ja"}}, "https://example.com/ja", true},
+		{"language before country", links.Visitor{Languages: []string{"zh"}, Country: "JP"}, "https://example.com/zh", true},
+		{"country when no language matches", links.Visitor{Languages: []string{"fr"}, Country: "JP"}, "https://example.com/jp", true},
+		{"no match", links.Visitor{Languages: []string{"fr", "de"}}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := link.TargetURL(tt.visitor)
+			assert.Equal(t, tt.wantMatch, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHTTP_LanguageRules(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := gin.New()
+	svc := links.NewService(links.NewRepository(testPool), "localhost:8003")
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(svc, lhttp.Options{}))
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, &buf)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	redirectWith := func(slug, acceptLanguage string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	slug := "http-lang-" + time.Now().Format("150405000000")
+	w := send("POST", "/links", map[string]any{"slug": slug, "url": "https://example.com/global"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("Set Rules", func(t *testing.T) {
+		w := send("PUT", "/links/"+slug+"/languages/zh-tw", map[string]string{"url": "https://example.com/zh-tw"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = send("PUT", "/links/"+slug+"/languages/ja", map[string]string{"url": "https://example.com/ja"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp lhttp.LanguageRulesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []links.LanguageRule{
+			{Language: "zh-TW", URL: "https://example.com/zh-tw"},
+			{Language: "ja", URL: "https://example.com/ja"},
+		}, resp.LanguageRules)
+	})
+
+	t.Run("Replace Rule", func(t *testing.T) {
+		w := send("PUT", "/links/"+slug+"/languages/ZH-TW", map[string]string{"url": "https://example.com/tw"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = send("GET", "/links/"+slug+"/languages", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp lhttp.LanguageRulesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []links.LanguageRule{
+			{Language: "zh-TW", URL: "https://example.com/tw"},
+			{Language: "ja", URL: "https://example.com/ja"},
+		}, resp.LanguageRules)
+	})
+
+	t.Run("Redirect By Preference", func(t *testing.T) {
+		w := redirectWith(slug, "zh-Hant-TW,zh;q=0.9,en;q=0.8")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/tw", w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Values("Vary"), "Accept-Language")
+
+		w = redirectWith(slug, "en;q=0.9,ja-JP;q=0.5")
+		assert.Equal(t, "https://example.com/ja", w.Header().Get("Location"))
+	})
+
+	t.Run("Fallback To Default", func(t *testing.T) {
+		w := redirectWith(slug, "fr-FR,de;q=0.5")
+		assert.Equal(t, "https://example.com/global", w.Header().Get("Location"))
+
+		w = redirectWith(slug, "")
+		assert.Equal(t, "https://example.com/global", w.Header().Get("Location"))
+	})
+
+	t.Run("Invalid Rules Rejected", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			language string
+			body     map[string]string
+		}{
+			{"invalid tag", "english", map[string]string{"url": "https://example.com/en"}},
+			{"missing url", "en", map[string]string{}},
+			{"redirect loop", "en", map[string]string{"url": "https://localhost:8003/x"}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := send("PUT", "/links/"+slug+"/languages/"+tt.language, tt.body)
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			})
+		}
+	})
+
+	t.Run("Delete Rule", func(t *testing.T) {
+		w := send("DELETE", "/links/"+slug+"/languages/zh-TW", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = send("DELETE", "/links/"+slug+"/languages/zh-TW", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = redirectWith(slug, "zh-TW")
+		assert.Equal(t, "https://example.com/global", w.Header().Get("Location"))
+	})
+
+	t.Run("Concurrent Edits", func(t *testing.T) {
+		languages := []string{"de", "fr", "es", "it", "ko", "pt", "nl", "sv"}
+
+		var wg sync.WaitGroup
+		for _, language := range languages {
+			wg.Go(func() {
+				w := send("PUT", "/links/"+slug+"/languages/"+language, map[string]string{"url": "https://example.com/" + language})
+				assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			})
+		}
+		wg.Wait()
+
+		// No edit overwrote another
+		w := send("GET", "/links/"+slug+"/languages", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp lhttp.LanguageRulesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		got := make([]string, 0, len(resp.LanguageRules))
+		for _, rule := range resp.LanguageRules {
+			got = append(got, rule.Language)
+		}
+		assert.Subset(t, got, languages)
+	})
+
+	t.Run("Unknown Link", func(t *testing.T) {
+		w := send("GET", "/links/no-such-link-lang/languages", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -2,7 +2,10 @@ package tests
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -25,11 +28,11 @@ func TestLinksRepository(t *testing.T) {
 		url := "https://google.com"
 
 		// Create
-		err := repo.Create(ctx, slug, url)
+		err := repo.Create(ctx, &links.Link{Slug: slug, URL: url})
 		require.NoError(t, err)
 
 		// Get
-		link, err := repo.GetBySlug(ctx, slug)
+		link, err := repo.GetBySlug(ctx, 0, slug)
 		require.NoError(t, err)
 
 		assert.Equal(t, slug, link.Slug)
@@ -41,10 +44,10 @@ func TestLinksRepository(t *testing.T) {
 		slug := "test-update"
 		url := "https://original.com"
 
-		err := repo.Create(ctx, slug, url)
+		err := repo.Create(ctx, &links.Link{Slug: slug, URL: url})
 		require.NoError(t, err)
 
-		link, err := repo.GetBySlug(ctx, slug)
+		link, err := repo.GetBySlug(ctx, 0, slug)
 		require.NoError(t, err)
 
 		// Update
@@ -56,7 +59,7 @@ func TestLinksRepository(t *testing.T) {
 		require.NoError(t, err)
 
 		// Verify
-		updatedLink, err := repo.GetBySlug(ctx, slug)
+		updatedLink, err := repo.GetBySlug(ctx, 0, slug)
 		require.NoError(t, err)
 
 		assert.Equal(t, newURL, updatedLink.URL)
@@ -67,15 +70,15 @@ func TestLinksRepository(t *testing.T) {
 		slug := "test-delete"
 		url := "https://todelete.com"
 
-		err := repo.Create(ctx, slug, url)
+		err := repo.Create(ctx, &links.Link{Slug: slug, URL: url})
 		require.NoError(t, err)
 
 		// Delete
-		err = repo.Delete(ctx, slug)
+		err = repo.Delete(ctx, 0, slug)
 		require.NoError(t, err)
 
 		// Verify
-		_, err = repo.GetBySlug(ctx, slug)
+		_, err = repo.GetBySlug(ctx, 0, slug)
 		assert.ErrorIs(t, err, links.ErrLinkNotFound)
 	})
 
@@ -84,10 +87,10 @@ func TestLinksRepository(t *testing.T) {
 		slug2 := "list-2"
 
 		// We use require.NoError for setup steps to fail fast if setup fails
-		require.NoError(t, repo.Create(ctx, slug1, "http://1.com"))
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug1, URL: "http://1.com"}))
 
 		time.Sleep(time.Millisecond * 10)
-		require.NoError(t, repo.Create(ctx, slug2, "http://2.com"))
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug2, URL: "http://2.com"}))
 
 		list, total, err := repo.List(ctx, links.ListOptions{})
 		require.NoError(t, err)
@@ -112,16 +115,16 @@ func TestLinksRepository(t *testing.T) {
 		p := "search-" + time.Now().Format("150405")
 
 		// 1. Active, matches keyword
-		_ = repo.Create(ctx, p+"-apple", "http://apple.com")
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-apple", URL: "http://apple.com"})
 
 		// 2. Inactive, matches keyword
-		_ = repo.Create(ctx, p+"-banana", "http://banana.com")
-		l, _ := repo.GetBySlug(ctx, p+"-banana")
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-banana", URL: "http://banana.com"})
+		l, _ := repo.GetBySlug(ctx, 0, p+"-banana")
 		l.IsActive = false
 		_ = repo.Update(ctx, l)
 
 		// 3. Active, no match
-		_ = repo.Create(ctx, p+"-carrot", "http://carrot.com")
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-carrot", URL: "http://carrot.com"})
 
 		// Test Keyword Search (should find apple and banana)
 		list, total, err := repo.List(ctx, links.ListOptions{
@@ -170,9 +173,9 @@ func TestLinksRepository(t *testing.T) {
 
 	t.Run("SQL Escaping and Strict Sorting", func(t *testing.T) {
 		p := "esc-" + time.Now().Format("150405")
-		_ = repo.Create(ctx, p+"-100%", "http://100.com")
-		_ = repo.Create(ctx, p+"-10_0", "http://10_0.com")
-		_ = repo.Create(ctx, p+"-normal", "http://normal.com")
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-100%", URL: "http://100.com"})
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-10_0", URL: "http://10_0.com"})
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-normal", URL: "http://normal.com"})
 
 		// Search for "%" literal
 		// Should match ONLY the link with % in its slug
@@ -208,9 +211,9 @@ func TestLinksRepository(t *testing.T) {
 
 		// Strict Sorting Check
 		// Create known sortable items
-		_ = repo.Create(ctx, p+"-aaa", "http://aaa.com")
-		_ = repo.Create(ctx, p+"-bbb", "http://bbb.com")
-		_ = repo.Create(ctx, p+"-ccc", "http://ccc.com")
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-aaa", URL: "http://aaa.com"})
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-bbb", URL: "http://bbb.com"})
+		_ = repo.Create(ctx, &links.Link{Slug: p + "-ccc", URL: "http://ccc.com"})
 
 		listSort, _, err := repo.List(ctx, links.ListOptions{
 			Keyword: p + "-",
@@ -235,3 +238,166 @@ func TestLinksRepository(t *testing.T) {
 		assert.Equal(t, p+"-ccc", sortedSlugs[2])
 	})
 }
+
+func TestLinksRepository_UsageLimits(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized (POSTGRES_TEST_DB not set)")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+	p := "limits-" + time.Now().Format("150405000000")
+
+	t.Run("Create with Expiration and Max Clicks", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+		link := &links.Link{
+			Slug:      p + "-create",
+			URL:       "https://example.com",
+			ExpiresAt: &expiresAt,
+			MaxClicks: ptrInt64(3),
+		}
+		require.NoError(t, repo.Create(ctx, link))
+		assert.NotZero(t, link.ID)
+		assert.True(t, link.IsActive)
+
+		got, err := repo.GetBySlug(ctx, 0, link.Slug)
+		require.NoError(t, err)
+		require.NotNil(t, got.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*got.ExpiresAt))
+		require.NotNil(t, got.MaxClicks)
+		assert.Equal(t, int64(3), *got.MaxClicks)
+		assert.Equal(t, int64(0), got.ClickCount)
+	})
+
+	t.Run("Concurrent ConsumeClick Never Overspends", func(t *testing.T) {
+		link := &links.Link{Slug: p + "-race", URL: "https://example.com", MaxClicks: ptrInt64(5)}
+		require.NoError(t, repo.Create(ctx, link))
+
+		var wg sync.WaitGroup
+		var succeeded, exhausted atomic.Int64
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := repo.ConsumeClick(ctx, link.ID)
+				switch {
+				case err == nil:
+					succeeded.Add(1)
+				case errors.Is(err, links.ErrLinkExhausted):
+					exhausted.Add(1)
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int64(5), succeeded.Load())
+		assert.Equal(t, int64(15), exhausted.Load())
+
+		got, err := repo.GetBySlug(ctx, 0, link.Slug)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), got.ClickCount)
+		assert.ErrorIs(t, got.Availability(time.Now()), links.ErrLinkExhausted)
+	})
+
+	t.Run("ConsumeClick Keeps UpdatedAt", func(t *testing.T) {
+		link := &links.Link{Slug: p + "-touch", URL: "https://example.com", MaxClicks: ptrInt64(2)}
+		require.NoError(t, repo.Create(ctx, link))
+
+		require.NoError(t, repo.ConsumeClick(ctx, link.ID))
+
+		got, err := repo.GetBySlug(ctx, 0, link.Slug)
+		require.NoError(t, err)
+		assert.True(t, link.UpdatedAt.Equal(got.UpdatedAt))
+	})
+
+	t.Run("List Expired Filter", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		future := time.Now().Add(time.Hour)
+
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: p + "-past", URL: "https://past.com", ExpiresAt: &past}))
+		require.NoError(t, repo.Create(ctx, &links.Link{Slug: p + "-future", URL: "https://future.com", ExpiresAt: &future}))
+
+		spent := &links.Link{Slug: p + "-spent", URL: "https://spent.com", MaxClicks: ptrInt64(1)}
+		require.NoError(t, repo.Create(ctx, spent))
+		require.NoError(t, repo.ConsumeClick(ctx, spent.ID))
+
+		expired := true
+		list, _, err := repo.List(ctx, links.ListOptions{Keyword: p, Expired: &expired})
+		require.NoError(t, err)
+
+		var slugs []string
+		for _, l := range list {
+			slugs = append(slugs, l.Slug)
+		}
+		assert.ElementsMatch(t, []string{p + "-past", p + "-spent", p + "-race"}, slugs)
+
+		notExpired := false
+		list, _, err = repo.List(ctx, links.ListOptions{Keyword: p, Expired: &notExpired})
+		require.NoError(t, err)
+		for _, l := range list {
+			assert.NotContains(t, []string{p + "-past", p + "-spent", p + "-race"}, l.Slug)
+		}
+	})
+}
+
+func TestLink_Status(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		link links.Link
+		want links.Status
+	}{
+		{"live without window", links.Link{IsActive: true}, links.StatusLive},
+		{"live inside window", links.Link{IsActive: true, ActiveFrom: &past, ActiveUntil: &future}, links.StatusLive},
+		{"disabled wins over window", links.Link{IsActive: false, ActiveFrom: &future}, links.StatusDisabled},
+		{"scheduled", links.Link{IsActive: true, ActiveFrom: &future}, links.StatusScheduled},
+		{"ended by window", links.Link{IsActive: true, ActiveUntil: &past}, links.StatusEnded},
+		{"ended by expiration", links.Link{IsActive: true, ExpiresAt: &past}, links.StatusEnded},
+		{"ended by click limit", links.Link{IsActive: true, MaxClicks: ptrInt64(1), ClickCount: 1}, links.StatusEnded},
+		{"window opens exactly now", links.Link{IsActive: true, ActiveFrom: &now}, links.StatusLive},
+		{"window closes exactly now", links.Link{IsActive: true, ActiveUntil: &now}, links.StatusEnded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.link.Status(now))
+		})
+	}
+}
+
+func TestLinksRepository_StatusFilter(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized (POSTGRES_TEST_DB not set)")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+	p := "status-" + time.Now().Format("150405000000")
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: p + "-live", URL: "https://live.com", ActiveFrom: &past}))
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: p + "-scheduled", URL: "https://scheduled.com", ActiveFrom: &future}))
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: p + "-ended", URL: "https://ended.com", ActiveUntil: &past}))
+
+	disabled := &links.Link{Slug: p + "-disabled", URL: "https://disabled.com", ActiveFrom: &future}
+	require.NoError(t, repo.Create(ctx, disabled))
+	disabled.IsActive = false
+	require.NoError(t, repo.Update(ctx, disabled))
+
+	for _, status := range []links.Status{links.StatusLive, links.StatusScheduled, links.StatusEnded, links.StatusDisabled} {
+		t.Run(string(status), func(t *testing.T) {
+			list, total, err := repo.List(ctx, links.ListOptions{Keyword: p, Status: status})
+			require.NoError(t, err)
+			require.Equal(t, int64(1), total)
+			assert.Equal(t, p+"-"+string(status), list[0].Slug)
+			assert.Equal(t, status, list[0].Status(time.Now()))
+		})
+	}
+}
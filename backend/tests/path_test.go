@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		extra       string
+		want        string
+		wantErr     bool
+	}{
+		{"no extra path", "https://docs.example.com", "", "https://docs.example.com", false},
+		{"single slash", "https://docs.example.com/guide", "/", "https://docs.example.com/guide", false},
+		{"onto host", "https://docs.example.com", "api/v2", "https://docs.example.com/api/v2", false},
+		{"onto base path", "https://docs.example.com/docs/", "api/v2", "https://docs.example.com/docs/api/v2", false},
+		{"trailing slash kept", "https://docs.example.com", "api/v2/", "https://docs.example.com/api/v2/", false},
+		{"empty segments collapsed", "https://docs.example.com", "api//v2", "https://docs.example.com/api/v2", false},
+		{"query and fragment kept", "https://docs.example.com/docs?lang=en#top", "api", "https://docs.example.com/docs/api?lang=en#top", false},
+		{"segments escaped", "https://docs.example.com", "a b/c?d#e", "https://docs.example.com/a%20b/c%3Fd%23e", false},
+		{"percent escaped", "https://docs.example.com", "100%", "https://docs.example.com/100%25", false},
+		{"protocol-relative stays on host", "https://docs.example.com", "/evil.com/x", "https://docs.example.com/evil.com/x", false},
+		{"userinfo stays on host", "https://docs.example.com", "@evil.com", "https://docs.example.com/@evil.com", false},
+		{"parent segment", "https://docs.example.com/docs", "../admin", "", true},
+		{"nested parent segment", "https://docs.example.com/docs", "api/../../admin", "", true},
+		{"dot segment", "https://docs.example.com/docs", "./api", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := links.JoinPath(tt.destination, tt.extra)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, links.ErrInvalidPath)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHTTP_RedirectForwardPath(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+	r := setupRouter()
+
+	redirect := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	prefix := "http-prefix-" + time.Now().Format("150405000000")
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: prefix, URL: "https://docs.example.com", ForwardPath: true, QueryMode: links.QueryAppend}))
+
+	plain := "http-plain-" + time.Now().Format("150405000000")
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: plain, URL: "https://docs.example.com"}))
+
+	t.Run("Bare Slug", func(t *testing.T) {
+		w := redirect("/redirect/" + prefix)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://docs.example.com", w.Header().Get("Location"))
+	})
+
+	t.Run("Path Appended", func(t *testing.T) {
+		w := redirect("/redirect/" + prefix + "/api/v2?ref=abc")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://docs.example.com/api/v2?ref=abc", w.Header().Get("Location"))
+	})
+
+	t.Run("Parent Segment Rejected", func(t *testing.T) {
+		w := redirect("/redirect/" + prefix + "/api/%2e%2e/%2e%2e/admin")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Path on Plain Link", func(t *testing.T) {
+		w := redirect("/redirect/" + plain + "/api/v2")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Trailing Slash on Plain Link", func(t *testing.T) {
+		w := redirect("/redirect/" + plain + "/")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://docs.example.com", w.Header().Get("Location"))
+	})
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP_Preview(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := gin.New()
+	svc := links.NewService(links.NewRepository(testPool), "localhost:8003")
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(svc, lhttp.Options{}))
+
+	send := func(method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, &buf)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().Format("150405000000")
+	public := "http-prev-" + suffix
+	protected := "http-prev-pw-" + suffix
+
+	w := send("POST", "/links", map[string]any{"slug": public, "url": "https://example.com/docs?a=1", "max_clicks": 1}, nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = send("POST", "/links", map[string]any{"slug": protected, "url": "https://secret.example.com/", "password": "hunter2"}, nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("HTML", func(t *testing.T) {
+		w := send("GET", "/preview/"+public, nil, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), "https://example.com/docs?a=1")
+		assert.Contains(t, w.Body.String(), "example.com")
+		assert.Contains(t, w.Body.String(), "Active")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		for _, path := range []string{"/preview/" + public + "?format=json", "/preview/" + public} {
+			w := send("GET", path, nil, http.Header{"Accept": {"application/json"}})
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var resp lhttp.PreviewResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, public, resp.Slug)
+			assert.Equal(t, "https://example.com/docs?a=1", resp.URL)
+			assert.Equal(t, "example.com", resp.Host)
+			assert.Equal(t, "live", resp.Status)
+			assert.True(t, resp.IsActive)
+			assert.False(t, resp.Protected)
+			assert.False(t, resp.CreatedAt.IsZero())
+		}
+	})
+
+	t.Run("Does Not Count As Click", func(t *testing.T) {
+		w := send("GET", "/redirect/"+public, nil, nil)
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+
+	t.Run("Inactive Link", func(t *testing.T) {
+		w := send("GET", "/preview/"+public+"?format=json", nil, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp lhttp.PreviewResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "ended", resp.Status)
+		assert.False(t, resp.IsActive)
+	})
+
+	t.Run("Protected Link Hides Destination", func(t *testing.T) {
+		w := send("GET", "/preview/"+protected+"?format=json", nil, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "secret.example.com")
+
+		var resp lhttp.PreviewResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.Protected)
+		assert.Empty(t, resp.URL)
+
+		w = send("GET", "/preview/"+protected, nil, nil)
+		assert.NotContains(t, w.Body.String(), "secret.example.com")
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		w := send("GET", "/preview/no-such-preview", nil, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = send("GET", "/preview/no-such-preview?format=json", nil, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "link not found")
+	})
+}
@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQRCode_ParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{"000000", color.NRGBA{0, 0, 0, 255}, false},
+		{"#ff8000", color.NRGBA{255, 128, 0, 255}, false},
+		{"fff", color.NRGBA{255, 255, 255, 255}, false},
+		{"#00000080", color.NRGBA{0, 0, 0, 128}, false},
+		{"", color.NRGBA{}, true},
+		{"ff", color.NRGBA{}, true},
+		{"gggggg", color.NRGBA{}, true},
+		{"#12345", color.NRGBA{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := qrcode.ParseColor(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, qrcode.ErrInvalidColor)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQRCode_PNG(t *testing.T) {
+	fg := color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+	bg := color.NRGBA{R: 0xee, G: 0xee, B: 0xee, A: 0xff}
+
+	data, err := qrcode.PNG("https://sho.rt/abc", qrcode.Options{Size: 300, Margin: 4, Foreground: fg, Background: bg})
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 300, 300), img.Bounds())
+
+	// The margin is background; the top-left finder pattern starts right
+	// after it. A version 2 code is 25 modules, 33 with the margin.
+	module := 300 / 33
+	assert.Equal(t, bg, color.NRGBAModel.Convert(img.At(1, 1)))
+	assert.Equal(t, fg, color.NRGBAModel.Convert(img.At(4*module+module/2+1, 4*module+module/2+1)))
+}
+
+func TestQRCode_SVG(t *testing.T) {
+	black, _ := qrcode.ParseColor("000000")
+	white, _ := qrcode.ParseColor("ffffff")
+
+	data, err := qrcode.SVG("https://sho.rt/abc", qrcode.Options{Size: 256, Margin: 2, Foreground: black, Background: white})
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	assert.Contains(t, svg, `width="256" height="256"`)
+	assert.Contains(t, svg, `viewBox="0 0 29 29"`)
+	assert.Contains(t, svg, `fill="#000000"`)
+	assert.NotContains(t, svg, "<image")
+}
+
+func TestQRCode_Logo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logo.png")
+	logoImg := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := range 20 {
+		for x := range 40 {
+			logoImg.SetNRGBA(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, logoImg))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	logo, err := qrcode.LoadLogo(path)
+	require.NoError(t, err)
+	assert.NotEmpty(t, logo.Digest())
+
+	black, _ := qrcode.ParseColor("000000")
+	white, _ := qrcode.ParseColor("ffffff")
+	opts := qrcode.Options{Size: 400, Margin: 4, Foreground: black, Background: white, Logo: logo}
+
+	t.Run("Needs High Level", func(t *testing.T) {
+		opts := opts
+		opts.Level = qrcode.LevelMedium
+		_, err := qrcode.PNG("https://sho.rt/abc", opts)
+		assert.ErrorIs(t, err, qrcode.ErrLogoNeedsHighLevel)
+	})
+
+	t.Run("PNG Centre", func(t *testing.T) {
+		opts := opts
+		opts.Level = qrcode.LevelHigh
+		data, err := qrcode.PNG("https://sho.rt/abc", opts)
+		require.NoError(t, err)
+
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, color.NRGBA{R: 0xff, A: 0xff}, color.NRGBAModel.Convert(img.At(200, 200)))
+	})
+
+	t.Run("SVG Embeds Logo", func(t *testing.T) {
+		opts := opts
+		opts.Level = qrcode.LevelQuarter
+		data, err := qrcode.SVG("https://sho.rt/abc", opts)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `href="data:image/png;base64,`)
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		_, err := qrcode.LoadLogo(filepath.Join(t.TempDir(), "missing.png"))
+		assert.Error(t, err)
+	})
+}
+
+func TestHTTP_QRCode(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := gin.New()
+	svc := links.NewService(links.NewRepository(testPool), "localhost:8003")
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(svc, lhttp.Options{ShortURLBase: "https://sho.rt"}))
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	slug := "http-qr-" + time.Now().Format("150405000000")
+	var body bytes.Buffer
+	require.NoError(t, json.NewEncoder(&body).Encode(map[string]any{"slug": slug, "url": "https://example.com"}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/links", &body)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("PNG", func(t *testing.T) {
+		w := get("/links/"+slug+"/qr?size=128", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.NotEmpty(t, w.Header().Get("ETag"))
+
+		img, err := png.Decode(w.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 128, img.Bounds().Dx())
+	})
+
+	t.Run("SVG", func(t *testing.T) {
+		w := get("/links/"+slug+"/qr?format=svg&fg=%23ff0000&margin=0", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `fill="#ff0000"`)
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+		first := get("/links/"+slug+"/qr", nil)
+		etag := first.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		w := get("/links/"+slug+"/qr", http.Header{"If-None-Match": {etag}})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+
+		other := get("/links/"+slug+"/qr?ecc=h", nil)
+		assert.NotEqual(t, etag, other.Header().Get("ETag"))
+	})
+
+	t.Run("Invalid Parameters", func(t *testing.T) {
+		for _, query := range []string{"format=gif", "size=10", "ecc=x", "margin=-1", "fg=zzz", "logo=true"} {
+			w := get("/links/"+slug+"/qr?"+query, nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("Unknown Link", func(t *testing.T) {
+		w := get("/links/no-such-qr-link/qr", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
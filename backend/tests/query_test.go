@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		incoming    string
+		mode        links.QueryMode
+		want        string
+	}{
+		{"off drops incoming", "https://example.com/p?a=1", "utm_source=x", links.QueryOff, "https://example.com/p?a=1"},
+		{"empty mode drops incoming", "https://example.com/p", "utm_source=x", "", "https://example.com/p"},
+		{"empty incoming", "https://example.com/p?a=1", "", links.QueryAppend, "https://example.com/p?a=1"},
+
+		{"append to bare destination", "https://example.com/p", "utm_source=newsletter&ref=abc", links.QueryAppend, "https://example.com/p?utm_source=newsletter&ref=abc"},
+		{"append keeps duplicates", "https://example.com/p?a=1&b=2", "a=3&a=4", links.QueryAppend, "https://example.com/p?a=1&b=2&a=3&a=4"},
+		{"append keeps destination fragment", "https://example.com/p?a=1#section", "b=2", links.QueryAppend, "https://example.com/p?a=1&b=2#section"},
+
+		{"override replaces every duplicate", "https://example.com/p?a=1&b=2&a=5", "a=3", links.QueryOverride, "https://example.com/p?b=2&a=3"},
+		{"override keeps incoming duplicates", "https://example.com/p?a=1", "a=3&a=4", links.QueryOverride, "https://example.com/p?a=3&a=4"},
+		{"override matches decoded keys", "https://example.com/p?utm%5Fsource=a", "utm_source=b", links.QueryOverride, "https://example.com/p?utm_source=b"},
+
+		{"preserve keeps destination value", "https://example.com/p?utm_source=site", "utm_source=newsletter&ref=abc", links.QueryPreserve, "https://example.com/p?utm_source=site&ref=abc"},
+		{"preserve adds missing keys", "https://example.com/p", "a=1&a=2", links.QueryPreserve, "https://example.com/p?a=1&a=2"},
+
+		{"encoded values are not re-encoded", "https://example.com/p", "q=a%20b%26c&next=%2Fhome", links.QueryAppend, "https://example.com/p?q=a%20b%26c&next=%2Fhome"},
+		{"plus is kept verbatim", "https://example.com/p", "q=a+b", links.QueryAppend, "https://example.com/p?q=a+b"},
+		{"malformed incoming dropped", "https://example.com/p", "bad=%zz&ok=1", links.QueryAppend, "https://example.com/p?ok=1"},
+		{"only malformed incoming", "https://example.com/p?a=1", "bad=%zz", links.QueryAppend, "https://example.com/p?a=1"},
+		{"empty pairs skipped", "https://example.com/p", "&&a=1&", links.QueryAppend, "https://example.com/p?a=1"},
+		{"key without value", "https://example.com/p", "debug", links.QueryOverride, "https://example.com/p?debug"},
+		{"dangling question mark", "https://example.com/p?", "a=1", links.QueryAppend, "https://example.com/p?a=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := links.ApplyQuery(tt.destination, tt.incoming, tt.mode)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHTTP_RedirectQueryPassthrough(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+	r := setupRouter()
+
+	tests := []struct {
+		name string
+		mode links.QueryMode
+		want string
+	}{
+		{"Off", links.QueryOff, "https://example.com/landing?utm_source=site"},
+		{"Append", links.QueryAppend, "https://example.com/landing?utm_source=site&utm_source=newsletter&ref=abc"},
+		{"Override", links.QueryOverride, "https://example.com/landing?utm_source=newsletter&ref=abc"},
+		{"Preserve", links.QueryPreserve, "https://example.com/landing?utm_source=site&ref=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slug := "http-query-" + time.Now().Format("150405000000")
+			require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com/landing?utm_source=site", QueryMode: tt.mode}))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/redirect/"+slug+"?utm_source=newsletter&ref=abc", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
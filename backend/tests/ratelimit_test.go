@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRateLimitStore takes a burst of 2 from a bucket refilling every 50ms.
+func testRateLimitStore(t *testing.T, store ratelimit.Store, key string) {
+	ctx := context.Background()
+	limit := ratelimit.PerMinute(1200, 2)
+
+	for i := range 2 {
+		result, err := store.Take(ctx, key, limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed, "take %d", i+1)
+	}
+
+	result, err := store.Take(ctx, key, limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "burst spent")
+	assert.Positive(t, result.RetryAfter)
+	assert.LessOrEqual(t, result.RetryAfter, 50*time.Millisecond)
+
+	result, err = store.Check(ctx, key, limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// Other keys have their own bucket
+	result, err = store.Take(ctx, key+"-other", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	time.Sleep(60 * time.Millisecond)
+
+	result, err = store.Check(ctx, key, limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "refilled")
+
+	result, err = store.Check(ctx, key, limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "checking takes nothing")
+
+	result, err = store.Take(ctx, key, limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = store.Take(ctx, key, limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "one token refilled")
+}
+
+func TestRateLimit_MemoryStore(t *testing.T) {
+	testRateLimitStore(t, ratelimit.NewMemoryStore(), "memory")
+}
+
+func TestRateLimit_PostgresStore(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	testRateLimitStore(t, ratelimit.NewPostgresStore(testPool), "postgres-"+time.Now().Format("150405000000"))
+}
+
+func TestRateLimit_Middleware(t *testing.T) {
+	setup := func(limiter *ratelimit.Limiter) *gin.Engine {
+		r := gin.New()
+		limited := r.Group("", limiter.Middleware())
+		limited.GET("/ok", func(c *gin.Context) { c.Status(http.StatusFound) })
+		limited.GET("/missing", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+		limited.GET("/fallback", func(c *gin.Context) {
+			ratelimit.MarkNotFound(c)
+			c.Status(http.StatusFound)
+		})
+		return r
+	}
+
+	get := func(r *gin.Engine, path, remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Requests", func(t *testing.T) {
+		limiter := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Options{
+			Requests: ratelimit.PerMinute(1, 3),
+		})
+		r := setup(limiter)
+
+		for range 3 {
+			assert.Equal(t, http.StatusFound, get(r, "/ok", "192.0.2.1:1234").Code)
+		}
+
+		w := get(r, "/ok", "192.0.2.1:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.InDelta(t, 60, retryAfter, 1)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+		assert.Equal(t, http.StatusFound, get(r, "/ok", "192.0.2.2:1234").Code, "other clients are unaffected")
+		assert.Equal(t, uint64(1), limiter.Stats().Limited)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		limiter := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Options{
+			Requests: ratelimit.PerMinute(600, 100),
+			NotFound: ratelimit.PerMinute(1, 2),
+		})
+		r := setup(limiter)
+
+		assert.Equal(t, http.StatusNotFound, get(r, "/missing", "192.0.2.1:1234").Code)
+		assert.Equal(t, http.StatusFound, get(r, "/fallback", "192.0.2.1:1234").Code)
+
+		// Out of not found budget, the client is refused everywhere
+		assert.Equal(t, http.StatusTooManyRequests, get(r, "/missing", "192.0.2.1:1234").Code)
+		w := get(r, "/ok", "192.0.2.1:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		for range 5 {
+			assert.Equal(t, http.StatusFound, get(r, "/ok", "192.0.2.2:1234").Code, "found links spend no not found budget")
+		}
+		assert.Equal(t, uint64(2), limiter.Stats().LimitedNotFound)
+	})
+
+	t.Run("IPv6 Per /64", func(t *testing.T) {
+		r := setup(ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Options{
+			Requests: ratelimit.PerMinute(1, 1),
+		}))
+
+		assert.Equal(t, http.StatusFound, get(r, "/ok", "[2001:db8:1:2::1]:1234").Code)
+		assert.Equal(t, http.StatusTooManyRequests, get(r, "/ok", "[2001:db8:1:2::ffff]:1234").Code)
+		assert.Equal(t, http.StatusFound, get(r, "/ok", "[2001:db8:1:3::1]:1234").Code)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		r := setup(nil)
+		for range 20 {
+			assert.Equal(t, http.StatusNotFound, get(r, "/missing", "192.0.2.1:1234").Code)
+		}
+
+		r = setup(ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Options{}))
+		for range 20 {
+			assert.Equal(t, http.StatusNotFound, get(r, "/missing", "192.0.2.1:1234").Code)
+		}
+	})
+}
@@ -1,12 +1,19 @@
 package tests
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/nekogravitycat/linkhub/internal/api"
 	"github.com/nekogravitycat/linkhub/internal/config"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewRouter_CORS(t *testing.T) {
@@ -77,7 +84,7 @@ func TestNewRouter_CORS(t *testing.T) {
 
 			// Pass nil for handler since we only test middleware
 			// Method values from nil pointer are allowed in Go as long as they are not invoked
-			router := api.NewRouter(cfg, nil)
+			router := api.NewRouter(cfg, nil, nil)
 
 			req := httptest.NewRequest(http.MethodOptions, "/links", nil)
 			req.Host = "api.linkhub.com"
@@ -100,3 +107,110 @@ func TestNewRouter_CORS(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRedirectRouter_TrustedProxies(t *testing.T) {
+	repo := &countingRepo{links: map[string]*links.Link{
+		"proxied": {ID: 1, Slug: "proxied", URL: "https://example.com/", IsActive: true},
+	}}
+
+	// One redirect per client, so a second one shows two requests were
+	// taken for the same client
+	newRouter := func(trusted []string) http.Handler {
+		handler := lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{
+			RateLimiter: ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Options{Requests: ratelimit.PerMinute(1, 1)}),
+		})
+		return api.NewRedirectRouter(&config.Config{TrustedProxies: trusted}, handler)
+	}
+	get := func(router http.Handler, remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/proxied", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Untrusted Peer", func(t *testing.T) {
+		router := newRouter(nil)
+		assert.Equal(t, http.StatusFound, get(router, "198.51.100.4:1234", "203.0.113.1"))
+		assert.Equal(t, http.StatusTooManyRequests, get(router, "198.51.100.4:1234", "203.0.113.2"), "a spoofed header must not make a new client")
+	})
+
+	t.Run("Trusted Proxy", func(t *testing.T) {
+		router := newRouter([]string{"127.0.0.1"})
+		assert.Equal(t, http.StatusFound, get(router, "127.0.0.1:1234", "203.0.113.1"))
+		assert.Equal(t, http.StatusFound, get(router, "127.0.0.1:1234", "203.0.113.2"))
+		assert.Equal(t, http.StatusTooManyRequests, get(router, "127.0.0.1:1234", "198.51.100.9, 203.0.113.1"), "only the address the proxy added counts")
+	})
+}
+
+func TestNewMetricsRouter(t *testing.T) {
+	router := api.NewMetricsRouter(&config.Config{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"memstats"`)
+}
+
+func TestNewRedirectRouter(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	ctx := context.Background()
+	repo := links.NewRepository(testPool)
+	handler := lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{
+		RootRedirectURL: "https://example.com/home",
+	})
+	router := api.NewRedirectRouter(&config.Config{}, handler)
+
+	slug := "native-" + time.Now().Format("150405000000")
+	require.NoError(t, repo.Create(ctx, &links.Link{Slug: slug, URL: "https://example.com/docs", ForwardPath: true}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Redirect", func(t *testing.T) {
+		w := get("/" + slug)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/docs", w.Header().Get("Location"))
+	})
+
+	t.Run("Prefix Path", func(t *testing.T) {
+		w := get("/" + slug + "/guide")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/docs/guide", w.Header().Get("Location"))
+	})
+
+	t.Run("Preview", func(t *testing.T) {
+		w := get("/" + slug + "+")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "https://example.com/docs")
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		w := get("/")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com/home", w.Header().Get("Location"))
+	})
+
+	t.Run("Invalid Slug", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/not.a.slug").Code)
+		assert.Equal(t, http.StatusNotFound, get("/"+slug+"++").Code)
+	})
+
+	t.Run("No Admin Routes", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/links/"+slug, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		_, err := repo.GetBySlug(ctx, 0, slug)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,245 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/slugs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlugs_Strategies(t *testing.T) {
+	t.Run("Random", func(t *testing.T) {
+		seen := make(map[string]bool)
+		for range 100 {
+			slug := slugs.Random{}.Slug(0, 6)
+			assert.Len(t, slug, 6)
+			assert.NoError(t, lhttp.ValidateSlug(slug))
+			seen[slug] = true
+		}
+		assert.Len(t, seen, 100)
+	})
+
+	t.Run("Words", func(t *testing.T) {
+		for size := 1; size <= (slugs.Words{}).MaxSize(); size++ {
+			slug := slugs.Words{}.Slug(0, size)
+			assert.Len(t, strings.Split(slug, "-"), size)
+			assert.NoError(t, lhttp.ValidateSlug(slug))
+		}
+	})
+
+	t.Run("HashID", func(t *testing.T) {
+		h := slugs.NewHashID("salt")
+		assert.Equal(t, h.Slug(42, 6), h.Slug(42, 6))
+		assert.NotEqual(t, h.Slug(42, 6), slugs.NewHashID("pepper").Slug(42, 6))
+		assert.Len(t, h.Slug(1, 6), 6)
+
+		// Every ID gets its own slug
+		seen := make(map[string]bool)
+		for id := range int64(62 * 62) {
+			slug := h.Slug(id, 2)
+			require.NoError(t, lhttp.ValidateSlug(slug))
+			require.False(t, seen[slug], "duplicate slug %s", slug)
+			seen[slug] = true
+		}
+
+		// IDs beyond the size get longer slugs
+		assert.Len(t, h.Slug(62*62, 2), 3)
+		assert.Len(t, h.Slug(1<<62, 6), h.MaxSize())
+	})
+}
+
+func TestSlugs_Profane(t *testing.T) {
+	for _, slug := range []string{"Sh1tty", "xBUTTx", "5EX", "gl-ass"} {
+		assert.True(t, slugs.Profane(slug), slug)
+	}
+	for _, slug := range []string{"brave-quiet-otter", "Ab3Xz9", "harbor"} {
+		assert.False(t, slugs.Profane(slug), slug)
+	}
+}
+
+func TestSlugs_Generator(t *testing.T) {
+	t.Run("Options", func(t *testing.T) {
+		g, err := slugs.New(slugs.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, 6, g.Size())
+		assert.False(t, g.NeedsID())
+
+		g, err = slugs.New(slugs.Options{Strategy: slugs.StrategyHashID, Size: 4})
+		require.NoError(t, err)
+		assert.True(t, g.NeedsID())
+		slug, ok := g.Next(7)
+		if ok {
+			assert.Len(t, slug, 4)
+		}
+
+		_, err = slugs.New(slugs.Options{Strategy: "uuid"})
+		assert.ErrorIs(t, err, slugs.ErrUnknownStrategy)
+		_, err = slugs.New(slugs.Options{Strategy: slugs.StrategyWords, Size: 5})
+		assert.Error(t, err)
+	})
+
+	t.Run("Grow", func(t *testing.T) {
+		g, err := slugs.New(slugs.Options{Strategy: slugs.StrategyWords, Size: 3})
+		require.NoError(t, err)
+
+		assert.True(t, g.Grow())
+		assert.Equal(t, 4, g.Size())
+		assert.False(t, g.Grow(), "four words is the most that fits")
+	})
+}
+
+// slugRepo records created links and hands out IDs. Slugs in taken, or
+// every slug if full, are reported as taken.
+type slugRepo struct {
+	links.Repository
+
+	mu      sync.Mutex
+	taken   map[string]bool
+	full    bool
+	created []*links.Link
+	nextID  int64
+}
+
+func (r *slugRepo) Create(_ context.Context, link *links.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.full || r.taken[link.Slug] {
+		return links.ErrSlugTaken
+	}
+	r.taken[link.Slug] = true
+	r.created = append(r.created, link)
+	return nil
+}
+
+func (r *slugRepo) NextID(context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	return r.nextID, nil
+}
+
+func TestService_GeneratedSlugs(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Generated", func(t *testing.T) {
+		repo := &slugRepo{taken: map[string]bool{}}
+		svc := links.NewService(repo, "localhost:8003")
+
+		link, _, err := svc.Create(ctx, links.CreateLinkInput{URL: "https://example.com/"})
+		require.NoError(t, err)
+		assert.Len(t, link.Slug, 6)
+		assert.Equal(t, link, repo.created[0])
+
+		link, _, err = svc.Create(ctx, links.CreateLinkInput{Slug: "custom", URL: "https://example.com/"})
+		require.NoError(t, err)
+		assert.Equal(t, "custom", link.Slug)
+
+		_, _, err = svc.Create(ctx, links.CreateLinkInput{Slug: "custom", URL: "https://example.com/"})
+		assert.ErrorIs(t, err, links.ErrSlugTaken)
+	})
+
+	t.Run("Hash IDs", func(t *testing.T) {
+		repo := &slugRepo{taken: map[string]bool{}}
+		generator, err := slugs.New(slugs.Options{Strategy: slugs.StrategyHashID, Salt: "s"})
+		require.NoError(t, err)
+		svc := links.NewServiceWithOptions(repo, "localhost:8003", links.ServiceOptions{Slugs: generator})
+
+		// A custom slug holds the first ID's slug
+		first := slugs.NewHashID("s").Slug(1, 6)
+		repo.taken[first] = true
+
+		link, _, err := svc.Create(ctx, links.CreateLinkInput{URL: "https://example.com/"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), link.ID)
+		assert.Equal(t, slugs.NewHashID("s").Slug(2, 6), link.Slug)
+	})
+
+	t.Run("Collisions Grow Slugs", func(t *testing.T) {
+		repo := &slugRepo{taken: map[string]bool{}}
+		generator, err := slugs.New(slugs.Options{Size: 1})
+		require.NoError(t, err)
+		svc := links.NewServiceWithOptions(repo, "localhost:8003", links.ServiceOptions{Slugs: generator})
+
+		// Take every one-character slug
+		for _, c := range "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz" {
+			repo.taken[string(c)] = true
+		}
+
+		link, _, err := svc.Create(ctx, links.CreateLinkInput{URL: "https://example.com/"})
+		require.NoError(t, err)
+		assert.Len(t, link.Slug, 2)
+		assert.Equal(t, 2, generator.Size(), "later slugs start longer")
+	})
+
+	t.Run("No Free Slug", func(t *testing.T) {
+		// Every create collides, as if the keyspace were full
+		repo := &slugRepo{full: true}
+		generator, err := slugs.New(slugs.Options{Strategy: slugs.StrategyWords, Size: 4})
+		require.NoError(t, err)
+		svc := links.NewServiceWithOptions(repo, "localhost:8003", links.ServiceOptions{Slugs: generator})
+
+		_, _, err = svc.Create(ctx, links.CreateLinkInput{URL: "https://example.com/"})
+		assert.ErrorIs(t, err, links.ErrNoFreeSlug)
+		assert.Empty(t, repo.created)
+	})
+}
+
+func TestHTTP_GeneratedSlugs(t *testing.T) {
+	t.Run("No Free Slug", func(t *testing.T) {
+		// Every create collides, as if the keyspace were full
+		r := gin.New()
+		lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(&slugRepo{full: true}, "localhost:8003"), lhttp.Options{}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/links", strings.NewReader(`{"url": "https://example.com/"}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.JSONEq(t, `{"error": "no free slug could be generated, choose a slug"}`, w.Body.String())
+	})
+
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	generator, err := slugs.New(slugs.Options{Strategy: slugs.StrategyHashID, Salt: "tests"})
+	require.NoError(t, err)
+
+	r := gin.New()
+	svc := links.NewServiceWithOptions(links.NewRepository(testPool), "localhost:8003", links.ServiceOptions{Slugs: generator})
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(svc, lhttp.Options{ShortURLBase: "https://localhost:8003"}))
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/links", map[string]any{"url": "https://example.com/generated"})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created lhttp.LinkResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Len(t, created.Slug, 6)
+	assert.Equal(t, "https://localhost:8003/"+created.Slug, created.ShortURL)
+	assert.Equal(t, "https://example.com/generated", created.URL)
+
+	w = send("GET", "/links/"+created.Slug, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func postUnlock(t *testing.T, r http.Handler, slug, password, remoteAddr string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"password": {password}}
+	req, _ := http.NewRequest("POST", "/redirect/"+slug, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHTTP_UnlockConcurrentGuesses(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("open-sesame"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	repo := &countingRepo{links: map[string]*links.Link{
+		"guarded": {ID: 1, Slug: "guarded", URL: "https://secret.example.com/", IsActive: true, PasswordHash: string(hash)},
+	}}
+
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{}))
+
+	// Guesses sent at once must not all pass the check before any fails
+	codes := make([]int, 20)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Go(func() {
+			codes[i] = postUnlock(t, r, "guarded", "wrong", "198.51.100.4:1234").Code
+		})
+	}
+	wg.Wait()
+
+	counts := make(map[int]int)
+	for _, code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusUnauthorized: 5, http.StatusTooManyRequests: 15}, counts)
+}
+
+func TestHTTP_PasswordProtectedLink(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := setupRouter()
+	ctx := context.Background()
+	svc := links.NewService(links.NewRepository(testPool), "localhost:8003")
+
+	createProtected := func(t *testing.T, prefix string, maxClicks *int64) string {
+		slug := prefix + "-" + time.Now().Format("150405000000")
+		_, _, err := svc.Create(ctx, links.CreateLinkInput{
+			Slug:      slug,
+			URL:       "https://secret.example.com/doc",
+			MaxClicks: maxClicks,
+			Password:  "open-sesame",
+		})
+		require.NoError(t, err)
+		return slug
+	}
+
+	t.Run("Prompts Instead of Redirecting", func(t *testing.T) {
+		slug := createProtected(t, "pw-prompt", ptrInt64(1))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), `<form method="post">`)
+
+		// Showing the form must not spend the only click
+		link, err := svc.Get(ctx, 0, slug)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), link.ClickCount)
+	})
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		slug := createProtected(t, "pw-wrong", nil)
+
+		w := postUnlock(t, r, slug, "guess", "198.51.100.1:1234")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Body.String(), "Incorrect password")
+	})
+
+	t.Run("Unlock Sets Cookie for Repeat Visits", func(t *testing.T) {
+		slug := createProtected(t, "pw-unlock", nil)
+
+		w := postUnlock(t, r, slug, "open-sesame", "198.51.100.2:1234")
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, "https://secret.example.com/doc", w.Header().Get("Location"))
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.True(t, cookies[0].HttpOnly)
+
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.AddCookie(cookies[0])
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://secret.example.com/doc", w.Header().Get("Location"))
+
+		// A tampered cookie is ignored
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: cookies[0].Value + "x"})
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Changing Password Revokes Cookies", func(t *testing.T) {
+		slug := createProtected(t, "pw-rotate", nil)
+
+		w := postUnlock(t, r, slug, "open-sesame", "198.51.100.3:1234")
+		require.Equal(t, http.StatusSeeOther, w.Code)
+		cookie := w.Result().Cookies()[0]
+
+		newPassword := "new-secret"
+		_, err := svc.Update(ctx, 0, slug, links.UpdateLinkInput{
+			Password: requestNullable(&newPassword),
+		})
+		require.NoError(t, err)
+
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.AddCookie(cookie)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Brute Force Throttling", func(t *testing.T) {
+		slug := createProtected(t, "pw-throttle", nil)
+		attacker := "198.51.100.4:1234"
+
+		for i := 0; i < 5; i++ {
+			w := postUnlock(t, r, slug, "wrong", attacker)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+
+		// Locked out, even with the right password
+		w := postUnlock(t, r, slug, "open-sesame", attacker)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		// Other clients are not affected
+		w = postUnlock(t, r, slug, "open-sesame", "198.51.100.5:1234")
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+	})
+
+	t.Run("Hash Never Returned by API", func(t *testing.T) {
+		slug := createProtected(t, "pw-api", nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/links/"+slug, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"has_password":true`)
+		assert.NotContains(t, w.Body.String(), "$2a$")
+		assert.NotContains(t, w.Body.String(), "password_hash")
+	})
+
+	t.Run("Create via API", func(t *testing.T) {
+		slug := "pw-create-" + time.Now().Format("150405000000")
+		body := []byte(`{"slug": "` + slug + `", "url": "https://example.com", "password": "hunter22"}`)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/links", bytes.NewBuffer(body))
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		link, err := svc.Get(ctx, 0, slug)
+		require.NoError(t, err)
+		assert.True(t, link.HasPassword())
+		assert.True(t, link.CheckPassword("hunter22"))
+		assert.False(t, link.CheckPassword("hunter2"))
+	})
+}
@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/urlpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLPolicy_Default(t *testing.T) {
+	policy := urlpolicy.Default()
+
+	tests := []struct {
+		url  string
+		code string
+	}{
+		{"https://example.com/a", ""},
+		{"http://example.com:8080/", ""},
+		{"HTTPS://EXAMPLE.COM/", ""},
+		{"https://8.8.8.8/", ""},
+		{"https://[2001:4860:4860::8888]/", ""},
+		{"javascript:alert(1)", urlpolicy.CodeSchemeNotAllowed},
+		{"data:text/html,<script>alert(1)</script>", urlpolicy.CodeSchemeNotAllowed},
+		{"file:///etc/passwd", urlpolicy.CodeSchemeNotAllowed},
+		{"ftp://example.com/", urlpolicy.CodeSchemeNotAllowed},
+		{"example.com/a", urlpolicy.CodeInvalidURL},
+		{"https:///a", urlpolicy.CodeInvalidURL},
+		{"http://localhost/", urlpolicy.CodePrivateAddress},
+		{"http://LOCALHOST./", urlpolicy.CodePrivateAddress},
+		{"http://app.localhost:3000/", urlpolicy.CodePrivateAddress},
+		{"http://127.0.0.1/", urlpolicy.CodePrivateAddress},
+		{"http://10.0.0.5/", urlpolicy.CodePrivateAddress},
+		{"http://172.16.1.1/", urlpolicy.CodePrivateAddress},
+		{"http://192.168.1.1/", urlpolicy.CodePrivateAddress},
+		{"http://169.254.169.254/latest/meta-data/", urlpolicy.CodePrivateAddress},
+		{"http://0.0.0.0/", urlpolicy.CodePrivateAddress},
+		{"http://[::1]/", urlpolicy.CodePrivateAddress},
+		{"http://[fe80::1]/", urlpolicy.CodePrivateAddress},
+		{"http://[fd00::1]/", urlpolicy.CodePrivateAddress},
+		{"http://[::ffff:10.0.0.1]/", urlpolicy.CodePrivateAddress},
+		// Numeric hosts browsers read as 127.0.0.1 or 10.0.0.1
+		{"http://2130706433/", urlpolicy.CodePrivateAddress},
+		{"http://0x7f.1/", urlpolicy.CodePrivateAddress},
+		{"http://0177.0.0.1/", urlpolicy.CodePrivateAddress},
+		{"http://10.1/", urlpolicy.CodePrivateAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := policy.Check(tt.url)
+			if tt.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var violation *urlpolicy.Violation
+			require.ErrorAs(t, err, &violation)
+			assert.Equal(t, tt.code, violation.Code)
+			assert.ErrorIs(t, err, urlpolicy.ErrNotAllowed)
+		})
+	}
+}
+
+func TestURLPolicy_Options(t *testing.T) {
+	t.Run("Schemes", func(t *testing.T) {
+		policy, err := urlpolicy.New(urlpolicy.Options{Schemes: []string{"HTTPS", "mailto"}})
+		require.NoError(t, err)
+
+		_, err = policy.Check("https://example.com/")
+		assert.NoError(t, err)
+		_, err = policy.Check("mailto:team@example.com")
+		assert.NoError(t, err)
+		_, err = policy.Check("http://example.com/")
+		assert.ErrorIs(t, err, urlpolicy.ErrNotAllowed)
+	})
+
+	t.Run("Allow Private", func(t *testing.T) {
+		policy, err := urlpolicy.New(urlpolicy.Options{AllowPrivate: true})
+		require.NoError(t, err)
+
+		_, err = policy.Check("http://10.0.0.5/wiki")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Host Lists", func(t *testing.T) {
+		policy, err := urlpolicy.New(urlpolicy.Options{
+			AllowHosts: []string{"example.com", "Example.ORG."},
+			DenyHosts:  []string{"evil.example.com"},
+		})
+		require.NoError(t, err)
+
+		tests := []struct {
+			url  string
+			code string
+		}{
+			{"https://example.com/", ""},
+			{"https://docs.example.com/", ""},
+			{"https://www.example.org/", ""},
+			{"https://evil.example.com/", urlpolicy.CodeHostDenied},
+			{"https://a.evil.example.com/", urlpolicy.CodeHostDenied},
+			{"https://notexample.com/", urlpolicy.CodeHostNotAllowed},
+			{"https://example.com.evil.net/", urlpolicy.CodeHostNotAllowed},
+		}
+		for _, tt := range tests {
+			_, err := policy.Check(tt.url)
+			if tt.code == "" {
+				assert.NoError(t, err, tt.url)
+				continue
+			}
+			var violation *urlpolicy.Violation
+			if assert.ErrorAs(t, err, &violation, tt.url) {
+				assert.Equal(t, tt.code, violation.Code, tt.url)
+			}
+		}
+	})
+
+	t.Run("IDN Hosts Match Their Punycode", func(t *testing.T) {
+		policy, err := urlpolicy.New(urlpolicy.Options{DenyHosts: []string{"bücher.example"}})
+		require.NoError(t, err)
+
+		_, err = policy.Check("https://xn--bcher-kva.example/")
+		assert.ErrorIs(t, err, urlpolicy.ErrNotAllowed)
+		_, err = policy.Check("https://BÜCHER.example/")
+		assert.ErrorIs(t, err, urlpolicy.ErrNotAllowed)
+	})
+}
+
+func TestURLPolicy_Homographs(t *testing.T) {
+	policy := urlpolicy.Default()
+
+	tests := []struct {
+		name string
+		url  string
+		warn bool
+	}{
+		{"ascii", "https://apple.com/", false},
+		{"german", "https://bücher.example/", false},
+		{"japanese", "https://例え.jp/", false},
+		{"japanese with latin", "https://ソニーstore.jp/", false},
+		{"russian word", "https://пример.рф/", false},
+		{"cyrillic lookalikes", "https://аррӏе.com/", true},
+		{"cyrillic lookalikes in punycode", "https://xn--80ak6aa92e.com/", true},
+		{"mixed latin and cyrillic", "https://pаypal.com/", true},
+		{"mixed latin and greek", "https://gοogle.com/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := policy.Check(tt.url)
+			require.NoError(t, err, "homographs are allowed")
+			if !tt.warn {
+				assert.Empty(t, warnings)
+				return
+			}
+			require.Len(t, warnings, 1)
+			assert.Equal(t, urlpolicy.CodeIDNHomograph, warnings[0].Code)
+			assert.Equal(t, tt.url, warnings[0].URL)
+		})
+	}
+}
+
+func TestService_URLPolicy(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepo{links: map[string]*links.Link{
+		"policy": {ID: 1, Slug: "policy", URL: "https://example.com/a", IsActive: true},
+	}}
+
+	t.Run("Default Policy", func(t *testing.T) {
+		svc := links.NewService(repo, "localhost:8003")
+
+		_, err := svc.Update(ctx, 0, "policy", links.UpdateLinkInput{URL: ptrString("javascript:alert(1)")})
+		assert.ErrorIs(t, err, urlpolicy.ErrNotAllowed)
+
+		_, err = svc.Update(ctx, 0, "policy", links.UpdateLinkInput{DeviceRules: &[]links.DeviceRule{
+			{OS: "ios", URL: "http://192.168.0.1/"},
+		}})
+		assert.ErrorIs(t, err, urlpolicy.ErrNotAllowed, "rule destinations are checked too")
+
+		// The redirect domain is reported as a loop, not a private address
+		_, err = svc.Update(ctx, 0, "policy", links.UpdateLinkInput{URL: ptrString("http://localhost:8003/x")})
+		assert.ErrorIs(t, err, links.ErrRedirectLoop)
+
+		// App URLs may use the app's own scheme
+		_, err = svc.Update(ctx, 0, "policy", links.UpdateLinkInput{DeepLink: requestNullable(&links.DeepLink{IOSURL: "myapp://item/1"})})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Custom Policy", func(t *testing.T) {
+		policy, err := urlpolicy.New(urlpolicy.Options{DenyHosts: []string{"example.net"}})
+		require.NoError(t, err)
+		svc := links.NewServiceWithOptions(repo, "localhost:8003", links.ServiceOptions{Policy: policy})
+
+		_, err = svc.Update(ctx, 0, "policy", links.UpdateLinkInput{URL: ptrString("https://www.example.net/")})
+		var violation *urlpolicy.Violation
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, urlpolicy.CodeHostDenied, violation.Code)
+	})
+
+	t.Run("Warnings", func(t *testing.T) {
+		svc := links.NewService(repo, "localhost:8003")
+
+		warnings, err := svc.Update(ctx, 0, "policy", links.UpdateLinkInput{URL: ptrString("https://аррӏе.com/")})
+		require.NoError(t, err)
+		require.Len(t, warnings, 1)
+		assert.Equal(t, urlpolicy.CodeIDNHomograph, warnings[0].Code)
+
+		warnings, err = svc.Update(ctx, 0, "policy", links.UpdateLinkInput{URL: ptrString("https://example.com/a")})
+		require.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+}
+
+func TestHTTP_PolicyWarnings(t *testing.T) {
+	repo := &countingRepo{links: map[string]*links.Link{
+		"warned": {ID: 1, Slug: "warned", URL: "https://example.com/", IsActive: true},
+	}}
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(repo, "localhost:8003"), lhttp.Options{}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/links/warned", strings.NewReader(`{"url": "https://bit.ly/abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body lhttp.WarningsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Warnings, 1)
+	assert.Equal(t, urlpolicy.CodeShortener, body.Warnings[0].Code)
+	assert.Equal(t, "https://bit.ly/abc", body.Warnings[0].URL)
+	assert.NotEmpty(t, body.Warnings[0].Reason)
+	assert.Empty(t, w.Header().Get("Warning"))
+}
+
+func TestHTTP_URLPolicy(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := gin.New()
+	lhttp.RegisterRoutes(r, lhttp.NewHandler(links.NewService(links.NewRepository(testPool), "localhost:8003"), lhttp.Options{}))
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	slug := "policy-" + time.Now().Format("150405000000")
+
+	t.Run("Violation Code", func(t *testing.T) {
+		w := send("POST", "/links", map[string]any{"slug": slug, "url": "http://10.0.0.5/admin"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var body struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, urlpolicy.CodePrivateAddress, body.Code)
+		assert.Contains(t, body.Error, "10.0.0.5")
+	})
+
+	t.Run("Warnings", func(t *testing.T) {
+		w := send("POST", "/links", map[string]any{"slug": slug, "url": "https://xn--80ak6aa92e.com/"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var created lhttp.LinkResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		require.Len(t, created.Warnings, 1)
+		assert.Equal(t, urlpolicy.CodeIDNHomograph, created.Warnings[0].Code)
+		assert.Equal(t, "https://xn--80ak6aa92e.com/", created.Warnings[0].URL)
+
+		w = send("PATCH", "/links/"+slug, map[string]any{"url": "https://example.com/"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{}`, w.Body.String())
+
+		w = send("POST", "/links/"+slug+"/variants", map[string]any{"url": "javascript:alert(1)", "weight": 1})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), urlpolicy.CodeSchemeNotAllowed)
+	})
+}
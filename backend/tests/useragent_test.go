@@ -0,0 +1,306 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/links"
+	"github.com/nekogravitycat/linkhub/internal/useragent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAgent_Parse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want useragent.Client
+	}{
+		{
+			"Safari on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			useragent.Client{OS: "ios", Device: "mobile", Browser: "safari"},
+		},
+		{
+			"Chrome on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/123.0.6312.52 Mobile/15E148 Safari/604.1",
+			useragent.Client{OS: "ios", Device: "mobile", Browser: "chrome"},
+		},
+		{
+			"Firefox on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/124.0 Mobile/15E148 Safari/605.1.15",
+			useragent.Client{OS: "ios", Device: "mobile", Browser: "firefox"},
+		},
+		{
+			"Edge on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 EdgiOS/123.2420.56 Mobile/15E148 Safari/605.1.15",
+			useragent.Client{OS: "ios", Device: "mobile", Browser: "edge"},
+		},
+		{
+			"Safari on iPad",
+			"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			useragent.Client{OS: "ios", Device: "tablet", Browser: "safari"},
+		},
+		{
+			"Instagram in-app browser on iPhone",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_3_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Instagram 321.0.2.23.111 (iPhone14,5; iOS 17_3_1; en_US; en; scale=3.00; 1170x2532; 576563442)",
+			useragent.Client{OS: "ios", Device: "mobile", Browser: ""},
+		},
+		{
+			"Chrome on Android phone",
+			"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			useragent.Client{OS: "android", Device: "mobile", Browser: "chrome"},
+		},
+		{
+			"Samsung Internet on Galaxy",
+			"Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			useragent.Client{OS: "android", Device: "mobile", Browser: "samsung"},
+		},
+		{
+			"Firefox on Android",
+			"Mozilla/5.0 (Android 14; Mobile; rv:125.0) Gecko/125.0 Firefox/125.0",
+			useragent.Client{OS: "android", Device: "mobile", Browser: "firefox"},
+		},
+		{
+			"Opera on Android",
+			"Mozilla/5.0 (Linux; Android 10; VOG-L29) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36 OPR/80.4.4244.77666",
+			useragent.Client{OS: "android", Device: "mobile", Browser: "opera"},
+		},
+		{
+			"Chrome on Android tablet",
+			"Mozilla/5.0 (Linux; Android 12; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			useragent.Client{OS: "android", Device: "tablet", Browser: "chrome"},
+		},
+		{
+			"Chrome on Windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			useragent.Client{OS: "windows", Device: "desktop", Browser: "chrome"},
+		},
+		{
+			"Edge on Windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			useragent.Client{OS: "windows", Device: "desktop", Browser: "edge"},
+		},
+		{
+			"Firefox on Windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			useragent.Client{OS: "windows", Device: "desktop", Browser: "firefox"},
+		},
+		{
+			"Safari on macOS",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15",
+			useragent.Client{OS: "macos", Device: "desktop", Browser: "safari"},
+		},
+		{
+			"Chrome on macOS",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			useragent.Client{OS: "macos", Device: "desktop", Browser: "chrome"},
+		},
+		{
+			"Opera on macOS",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36 OPR/109.0.0.0",
+			useragent.Client{OS: "macos", Device: "desktop", Browser: "opera"},
+		},
+		{
+			"Firefox on Linux",
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			useragent.Client{OS: "linux", Device: "desktop", Browser: "firefox"},
+		},
+		{
+			"Chrome on ChromeOS",
+			"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			useragent.Client{OS: "chromeos", Device: "desktop", Browser: "chrome"},
+		},
+		{
+			"Edge on Windows Phone",
+			"Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.15063",
+			useragent.Client{OS: "windows", Device: "mobile", Browser: "edge"},
+		},
+		{
+			"curl",
+			"curl/8.4.0",
+			useragent.Client{OS: "", Device: "desktop", Browser: ""},
+		},
+		{
+			"empty",
+			"",
+			useragent.Client{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, useragent.Parse(tt.ua, nil))
+		})
+	}
+}
+
+func TestUserAgent_ParseClientHints(t *testing.T) {
+	// Chromium freezes the User-Agent string, so hints take precedence
+	reducedAndroid := "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	reducedDesktop := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+	tests := []struct {
+		name  string
+		ua    string
+		hints map[string]string
+		want  useragent.Client
+	}{
+		{
+			"Edge brand",
+			reducedDesktop,
+			map[string]string{
+				"Sec-CH-UA":          `"Chromium";v="124", "Microsoft Edge";v="124", "Not-A.Brand";v="99"`,
+				"Sec-CH-UA-Mobile":   "?0",
+				"Sec-CH-UA-Platform": `"Windows"`,
+			},
+			useragent.Client{OS: "windows", Device: "desktop", Browser: "edge"},
+		},
+		{
+			"Platform overrides frozen string",
+			reducedDesktop,
+			map[string]string{
+				"Sec-CH-UA":          `"Google Chrome";v="124", "Chromium";v="124", "Not-A.Brand";v="99"`,
+				"Sec-CH-UA-Platform": `"macOS"`,
+			},
+			useragent.Client{OS: "macos", Device: "desktop", Browser: "chrome"},
+		},
+		{
+			"Android tablet reports non-mobile",
+			reducedAndroid,
+			map[string]string{
+				"Sec-CH-UA-Mobile":   "?0",
+				"Sec-CH-UA-Platform": `"Android"`,
+			},
+			useragent.Client{OS: "android", Device: "tablet", Browser: "chrome"},
+		},
+		{
+			"Mobile hint",
+			reducedAndroid,
+			map[string]string{
+				"Sec-CH-UA-Mobile":   "?1",
+				"Sec-CH-UA-Platform": `"Android"`,
+			},
+			useragent.Client{OS: "android", Device: "mobile", Browser: "chrome"},
+		},
+		{
+			"Unknown hints ignored",
+			reducedAndroid,
+			map[string]string{
+				"Sec-CH-UA":          `"Not-A.Brand";v="99"`,
+				"Sec-CH-UA-Platform": `"Unknown"`,
+			},
+			useragent.Client{OS: "android", Device: "mobile", Browser: "chrome"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.hints {
+				header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, useragent.Parse(tt.ua, header))
+		})
+	}
+}
+
+func TestLink_TargetURL(t *testing.T) {
+	link := &links.Link{
+		URL: "https://example.com/app",
+		DeviceRules: []links.DeviceRule{
+			{OS: "ios", URL: "https://apps.apple.com/app/id123"},
+			{OS: "android", URL: "https://play.google.com/store/apps/details?id=com.example"},
+			{Device: "tablet", URL: "https://example.com/tablet"},
+		},
+		CountryRules: []links.CountryRule{
+			{Country: "TW", URL: "https://example.com/zh-tw/app"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		visitor links.Visitor
+		want    string
+	}{
+		{"iPhone", links.Visitor{Client: useragent.Client{OS: "ios", Device: "mobile"}}, "https://apps.apple.com/app/id123"},
+		{"first matching rule wins", links.Visitor{Client: useragent.Client{OS: "ios", Device: "tablet"}}, "https://apps.apple.com/app/id123"},
+		{"Android", links.Visitor{Client: useragent.Client{OS: "android", Device: "mobile"}}, "https://play.google.com/store/apps/details?id=com.example"},
+		{"device rules before country rules", links.Visitor{Country: "TW", Client: useragent.Client{OS: "android"}}, "https://play.google.com/store/apps/details?id=com.example"},
+		{"desktop falls through to country", links.Visitor{Country: "TW", Client: useragent.Client{OS: "windows", Device: "desktop"}}, "https://example.com/zh-tw/app"},
+		{"desktop without match", links.Visitor{Client: useragent.Client{OS: "windows", Device: "desktop"}}, ""},
+		{"unknown client", links.Visitor{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := link.TargetURL(tt.visitor)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want != "", ok)
+		})
+	}
+}
+
+func TestHTTP_DeviceRules(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := setupRouter()
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	redirectAs := func(slug, ua string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+		req.Header.Set("User-Agent", ua)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	slug := "http-device-" + time.Now().Format("150405000000")
+	w := send("POST", "/links", `{
+		"slug": "`+slug+`",
+		"url": "https://example.com/app",
+		"device_rules": [
+			{"os": "ios", "url": "https://apps.apple.com/app/id123"},
+			{"os": "android", "url": "https://play.google.com/store/apps/details?id=com.example"}
+		]
+	}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("iPhone", func(t *testing.T) {
+		w := redirectAs(slug, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1")
+		assert.Equal(t, "https://apps.apple.com/app/id123", w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Get("Vary"), "User-Agent")
+	})
+
+	t.Run("Android", func(t *testing.T) {
+		w := redirectAs(slug, "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36")
+		assert.Equal(t, "https://play.google.com/store/apps/details?id=com.example", w.Header().Get("Location"))
+	})
+
+	t.Run("Desktop", func(t *testing.T) {
+		w := redirectAs(slug, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36")
+		assert.Equal(t, "https://example.com/app", w.Header().Get("Location"))
+	})
+
+	t.Run("Invalid Rules Rejected", func(t *testing.T) {
+		for _, rules := range []string{
+			`[{"url": "https://example.com/any"}]`,
+			`[{"os": "symbian", "url": "https://example.com/a"}]`,
+			`[{"os": "ios"}]`,
+		} {
+			w := send("PATCH", "/links/"+slug, `{"device_rules": `+rules+`}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code, rules)
+		}
+	})
+}
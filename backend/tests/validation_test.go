@@ -3,12 +3,21 @@ package tests
 import (
 	"strings"
 	"testing"
+	"time"
 
 	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/nekogravitycat/linkhub/internal/pkg/request"
 )
 
-func ptrString(s string) *string { return &s }
-func ptrBool(b bool) *bool       { return &b }
+func ptrString(s string) *string     { return &s }
+func ptrBool(b bool) *bool           { return &b }
+func ptrInt(n int) *int              { return &n }
+func ptrInt64(n int64) *int64        { return &n }
+func ptrTime(t time.Time) *time.Time { return &t }
+
+func requestNullable[T any](v *T) request.Nullable[T] {
+	return request.Nullable[T]{Set: true, Value: v}
+}
 
 func TestValidateSlug(t *testing.T) {
 	tests := []struct {
@@ -84,6 +93,70 @@ func TestCreateLinkRequest_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid usage limits",
+			req: lhttp.CreateLinkRequest{
+				Slug:      "valid-slug",
+				URL:       "https://example.com",
+				ExpiresAt: ptrTime(time.Now().Add(time.Hour)),
+				MaxClicks: ptrInt64(1),
+			},
+			wantErr: false,
+		},
+		{
+			name: "expires in the past",
+			req: lhttp.CreateLinkRequest{
+				Slug:      "valid-slug",
+				URL:       "https://example.com",
+				ExpiresAt: ptrTime(time.Now().Add(-time.Hour)),
+			},
+			wantErr: true,
+		},
+		{
+			name: "password too short",
+			req: lhttp.CreateLinkRequest{
+				Slug:     "valid-slug",
+				URL:      "https://example.com",
+				Password: "abc",
+			},
+			wantErr: true,
+		},
+		{
+			name: "password too long",
+			req: lhttp.CreateLinkRequest{
+				Slug:     "valid-slug",
+				URL:      "https://example.com",
+				Password: strings.Repeat("a", 73),
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid redirect status",
+			req: lhttp.CreateLinkRequest{
+				Slug:           "valid-slug",
+				URL:            "https://example.com",
+				RedirectStatus: ptrInt(308),
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported redirect status",
+			req: lhttp.CreateLinkRequest{
+				Slug:           "valid-slug",
+				URL:            "https://example.com",
+				RedirectStatus: ptrInt(303),
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero max clicks",
+			req: lhttp.CreateLinkRequest{
+				Slug:      "valid-slug",
+				URL:       "https://example.com",
+				MaxClicks: ptrInt64(0),
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -134,6 +207,34 @@ func TestUpdateLinkRequest_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "clear max clicks",
+			req: lhttp.UpdateLinkRequest{
+				MaxClicks: request.Nullable[int64]{Set: true},
+			},
+			wantErr: false,
+		},
+		{
+			name: "remove password",
+			req: lhttp.UpdateLinkRequest{
+				Password: request.Nullable[string]{Set: true},
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty password",
+			req: lhttp.UpdateLinkRequest{
+				Password: requestNullable(ptrString("")),
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max clicks",
+			req: lhttp.UpdateLinkRequest{
+				MaxClicks: request.Nullable[int64]{Set: true, Value: ptrInt64(-1)},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
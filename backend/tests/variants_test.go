@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nekogravitycat/linkhub/internal/links"
+	lhttp "github.com/nekogravitycat/linkhub/internal/links/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickVariant(t *testing.T) {
+	variants := []links.Variant{
+		{ID: 1, Weight: 1},
+		{ID: 2, Weight: 0},
+		{ID: 3, Weight: 3},
+	}
+
+	assert.Equal(t, 4, links.TotalWeight(variants))
+
+	tests := []struct {
+		n      int
+		wantID int64
+	}{
+		{0, 1},
+		{1, 3},
+		{2, 3},
+		{3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.n), func(t *testing.T) {
+			variant := links.PickVariant(variants, tt.n)
+			require.NotNil(t, variant)
+			assert.Equal(t, tt.wantID, variant.ID)
+		})
+	}
+
+	assert.Nil(t, links.PickVariant(variants, 4))
+	assert.Nil(t, links.PickVariant(variants, -1))
+	assert.Nil(t, links.PickVariant(nil, 0))
+	assert.Zero(t, links.TotalWeight([]links.Variant{{Weight: 0}}))
+}
+
+// hitsRepo records the variant hits written, failing while fail is set.
+type hitsRepo struct {
+	links.Repository
+
+	mu     sync.Mutex
+	fail   bool
+	writes []map[int64]int64
+}
+
+func (r *hitsRepo) AddVariantHits(_ context.Context, hits map[int64]int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fail {
+		return errors.New("database is down")
+	}
+	r.writes = append(r.writes, maps.Clone(hits))
+	return nil
+}
+
+func TestHitCounter(t *testing.T) {
+	t.Run("Batches Hits", func(t *testing.T) {
+		repo := &hitsRepo{}
+		counter := links.NewHitCounter(repo, time.Hour)
+
+		var wg sync.WaitGroup
+		for i := range 100 {
+			wg.Go(func() { counter.Add(int64(i%2 + 1)) })
+		}
+		wg.Wait()
+
+		require.NoError(t, counter.Close(context.Background()))
+		assert.Equal(t, []map[int64]int64{{1: 50, 2: 50}}, repo.writes)
+		assert.ErrorIs(t, counter.Close(context.Background()), links.ErrHitCounterClosed)
+	})
+
+	t.Run("Keeps Failed Hits", func(t *testing.T) {
+		repo := &hitsRepo{fail: true}
+		counter := links.NewHitCounter(repo, 10*time.Millisecond)
+
+		counter.Add(1)
+		counter.Add(1)
+		time.Sleep(50 * time.Millisecond)
+
+		repo.mu.Lock()
+		repo.fail = false
+		repo.mu.Unlock()
+		counter.Add(1)
+
+		require.NoError(t, counter.Close(context.Background()))
+		var total int64
+		for _, hits := range repo.writes {
+			total += hits[1]
+		}
+		assert.Equal(t, int64(3), total)
+	})
+}
+
+func TestHTTP_Variants(t *testing.T) {
+	if testPool == nil {
+		t.Skip("Postgres test pool not initialized")
+	}
+
+	r := setupRouter()
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	createVariant := func(t *testing.T, slug, url string, weight int) links.Variant {
+		w := send("POST", "/links/"+slug+"/variants", `{"url": "`+url+`", "weight": `+strconv.Itoa(weight)+`}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var variant links.Variant
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &variant))
+		return variant
+	}
+
+	listVariants := func(t *testing.T, slug string) lhttp.VariantListResponse {
+		w := send("GET", "/links/"+slug+"/variants", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp lhttp.VariantListResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	newLink := func(t *testing.T, prefix string, sticky bool) string {
+		slug := prefix + "-" + time.Now().Format("150405000000")
+		w := send("POST", "/links", `{"slug": "`+slug+`", "url": "https://example.com/original", "sticky_variants": `+strconv.FormatBool(sticky)+`}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		return slug
+	}
+
+	t.Run("Split by Weight", func(t *testing.T) {
+		slug := newLink(t, "ab-split", false)
+		a := createVariant(t, slug, "https://example.com/a", 1)
+		b := createVariant(t, slug, "https://example.com/b", 1)
+		createVariant(t, slug, "https://example.com/paused", 0)
+
+		seen := map[string]int{}
+		for range 40 {
+			w := send("GET", "/redirect/"+slug, "")
+			require.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			seen[w.Header().Get("Location")]++
+		}
+
+		assert.Len(t, seen, 2)
+		assert.NotContains(t, seen, "https://example.com/paused")
+		assert.NotContains(t, seen, "https://example.com/original")
+
+		resp := listVariants(t, slug)
+		require.Len(t, resp.Variants, 3)
+		assert.Equal(t, 2, resp.TotalWeight)
+		assert.Equal(t, int64(40), resp.TotalHits)
+		assert.Equal(t, int64(seen[a.URL]), resp.Variants[0].HitCount)
+		assert.Equal(t, int64(seen[b.URL]), resp.Variants[1].HitCount)
+	})
+
+	t.Run("Sticky Assignment", func(t *testing.T) {
+		slug := newLink(t, "ab-sticky", true)
+		createVariant(t, slug, "https://example.com/a", 1)
+		createVariant(t, slug, "https://example.com/b", 1)
+
+		w := send("GET", "/redirect/"+slug, "")
+		require.Equal(t, http.StatusFound, w.Code)
+		first := w.Header().Get("Location")
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "lh_variant_"+slug, cookies[0].Name)
+
+		for range 10 {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/redirect/"+slug, nil)
+			req.AddCookie(cookies[0])
+			r.ServeHTTP(w, req)
+			assert.Equal(t, first, w.Header().Get("Location"))
+		}
+	})
+
+	t.Run("All Paused Falls Back to Link URL", func(t *testing.T) {
+		slug := newLink(t, "ab-paused", false)
+		variant := createVariant(t, slug, "https://example.com/a", 1)
+
+		w := send("PATCH", "/links/"+slug+"/variants/"+strconv.FormatInt(variant.ID, 10), `{"weight": 0}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = send("GET", "/redirect/"+slug, "")
+		assert.Equal(t, "https://example.com/original", w.Header().Get("Location"))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		slug := newLink(t, "ab-delete", false)
+		variant := createVariant(t, slug, "https://example.com/a", 1)
+		path := "/links/" + slug + "/variants/" + strconv.FormatInt(variant.ID, 10)
+
+		assert.Equal(t, http.StatusOK, send("DELETE", path, "").Code)
+		assert.Equal(t, http.StatusNotFound, send("DELETE", path, "").Code)
+		assert.Empty(t, listVariants(t, slug).Variants)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		slug := newLink(t, "ab-invalid", false)
+
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/links/"+slug+"/variants", `{"url": "https://example.com/a"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/links/"+slug+"/variants", `{"url": "https://example.com/a", "weight": -1}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/links/"+slug+"/variants", `{"url": "https://localhost:8003/x", "weight": 1}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", "/links/missing-link/variants", `{"url": "https://example.com/a", "weight": 1}`).Code)
+
+		for range 10 {
+			createVariant(t, slug, "https://example.com/a", 1)
+		}
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/links/"+slug+"/variants", `{"url": "https://example.com/a", "weight": 1}`).Code)
+	})
+
+	t.Run("Concurrent Creates", func(t *testing.T) {
+		slug := newLink(t, "ab-concurrent", false)
+
+		var mu sync.Mutex
+		codes := make(map[int]int)
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Go(func() {
+				w := send("POST", "/links/"+slug+"/variants", `{"url": "https://example.com/a", "weight": 1}`)
+				mu.Lock()
+				codes[w.Code]++
+				mu.Unlock()
+			})
+		}
+		wg.Wait()
+
+		assert.Equal(t, map[int]int{http.StatusCreated: 10, http.StatusBadRequest: 10}, codes)
+		assert.Len(t, listVariants(t, slug).Variants, 10)
+	})
+}